@@ -0,0 +1,140 @@
+// Pluggable backends that verify the credentials passed to `GenerateToken`
+package authentication
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+
+	"server/env"
+	"server/helpers"
+	"server/models"
+)
+
+// Returned by a backend when the username or password is wrong,
+// the next configured backend is tried
+var ErrInvalidCredentials = errors.New("Invalid Credentials Passed")
+
+// A user whose credentials were verified by a backend
+type AuthenticatedUser struct {
+	Email string
+	Roles []string
+
+	// Name of the `RoleResolver` that owns the roles, empty if they are not refreshed
+	Backend string
+}
+
+// Verifies a username and password
+type Authenticator interface {
+	Authenticate(username string, password string) (*AuthenticatedUser, error)
+}
+
+// Implemented by backends whose roles come from an external source that can change,
+// `RefreshToken` resolves them again instead of copying them from the refresh token
+type RoleResolver interface {
+	Name() string
+
+	// Returns `ErrInvalidCredentials` when the user is no longer known to the backend
+	ResolveRoles(email string) ([]string, error)
+}
+
+// Backends tried in order by `GenerateToken`
+var authenticators = []Authenticator{&PasswordAuthenticator{}}
+
+// Configures the authentication backends from `env.Config`
+func InitAuthenticators(config env.Config) error {
+	var configured []Authenticator
+
+	for _, backend := range config.AUTH_BACKENDS {
+		switch backend {
+		case "password":
+			configured = append(configured, &PasswordAuthenticator{})
+		case "ldap":
+			ldapAuthenticator, err := NewLDAPAuthenticator(config.LDAP)
+			if err != nil {
+				return err
+			}
+
+			configured = append(configured, ldapAuthenticator)
+		default:
+			return fmt.Errorf("unknown authentication backend %q", backend)
+		}
+	}
+
+	if len(configured) > 0 {
+		authenticators = configured
+	}
+
+	return nil
+}
+
+// Tries each backend in order until one accepts the credentials
+func authenticate(username string, password string) (*AuthenticatedUser, error) {
+	for _, authenticator := range authenticators {
+		authenticatedUser, err := authenticator.Authenticate(username, password)
+
+		if errors.Is(err, ErrInvalidCredentials) {
+			continue
+		}
+
+		return authenticatedUser, err
+	}
+
+	return nil, ErrInvalidCredentials
+}
+
+// Returns the current roles of the user from the configured backend with the given name
+func resolveRoles(backend string, email string) ([]string, error) {
+	for _, authenticator := range authenticators {
+		if resolver, ok := authenticator.(RoleResolver); ok && resolver.Name() == backend {
+			return resolver.ResolveRoles(email)
+		}
+	}
+
+	log.Info().Msgf("No configured backend %q resolves roles", backend)
+
+	return nil, ErrInvalidCredentials
+}
+
+// Verifies credentials against the bcrypt hashes in the users table
+// Roles come from the `user_roles` table
+type PasswordAuthenticator struct{}
+
+func (a *PasswordAuthenticator) Authenticate(username string, password string) (*AuthenticatedUser, error) {
+	var user models.User
+
+	currentUser, err := user.FindByEmail(username)
+	if errors.Is(err, models.ErrUserNotFound) {
+		log.Info().Msg("Password backend: user not found")
+		return nil, ErrInvalidCredentials
+	}
+
+	// Any other error fails the sign in instead of trying the next backend
+	if err != nil {
+		return nil, err
+	}
+
+	//validate user credentials
+	if !helpers.ComparePasswords(currentUser.Password, password) {
+		return nil, ErrInvalidCredentials
+	}
+
+	roles, err := user.FindRoles(currentUser.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthenticatedUser{Email: currentUser.Email, Roles: roles, Backend: a.Name()}, nil
+}
+
+func (a *PasswordAuthenticator) Name() string {
+	return "password"
+}
+
+// Returns the roles stored for the user
+func (a *PasswordAuthenticator) ResolveRoles(email string) ([]string, error) {
+	var user models.User
+
+	return user.FindRoles(email)
+}
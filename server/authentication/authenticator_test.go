@@ -0,0 +1,127 @@
+package authentication
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+
+	"server/helpers"
+	"server/models"
+)
+
+var passwordUserColumns = []string{"id", "name", "email", "password", "created_at", "updated_at", "reputation"}
+
+func setupPasswordTest(t *testing.T) sqlmock.Sqlmock {
+	dbMock, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating DB mock: %s", err)
+	}
+	t.Cleanup(func() { dbMock.Close() })
+
+	models.New(dbMock)
+
+	return mock
+}
+
+func TestPasswordAuthenticator(t *testing.T) {
+	hash, _ := helpers.HashPassword("secret")
+	outage := errors.New("connection refused")
+
+	tests := []struct {
+		name     string
+		password string
+		expect   func(mock sqlmock.Sqlmock)
+		err      error
+		user     *AuthenticatedUser
+	}{
+		{
+			name:     "valid credentials",
+			password: "secret",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT (.+) FROM users WHERE LOWER\\(email\\)").WithArgs("alice@example.com").
+					WillReturnRows(sqlmock.NewRows(passwordUserColumns).
+						AddRow("9b2c1e0e-6f55-4c4b-9a0b-3f1f4a8b2c11", "Alice", "alice@example.com", hash, time.Now(), time.Now(), 0))
+				mock.ExpectQuery("SELECT r.role FROM user_roles").WithArgs("alice@example.com").
+					WillReturnRows(sqlmock.NewRows([]string{"role"}))
+			},
+			user: &AuthenticatedUser{Email: "alice@example.com", Backend: "password"},
+		},
+		{
+			name:     "stored admin role",
+			password: "secret",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT (.+) FROM users WHERE LOWER\\(email\\)").WithArgs("alice@example.com").
+					WillReturnRows(sqlmock.NewRows(passwordUserColumns).
+						AddRow("9b2c1e0e-6f55-4c4b-9a0b-3f1f4a8b2c11", "Alice", "alice@example.com", hash, time.Now(), time.Now(), 0))
+				mock.ExpectQuery("SELECT r.role FROM user_roles").WithArgs("alice@example.com").
+					WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow("admin").AddRow("moderator"))
+			},
+			user: &AuthenticatedUser{Email: "alice@example.com", Roles: []string{"admin", "moderator"}, Backend: "password"},
+		},
+		{
+			name:     "wrong password",
+			password: "guess",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT (.+) FROM users WHERE LOWER\\(email\\)").
+					WillReturnRows(sqlmock.NewRows(passwordUserColumns).
+						AddRow("9b2c1e0e-6f55-4c4b-9a0b-3f1f4a8b2c11", "Alice", "alice@example.com", hash, time.Now(), time.Now(), 0))
+			},
+			err: ErrInvalidCredentials,
+		},
+		{
+			name:     "unknown user",
+			password: "secret",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT (.+) FROM users WHERE LOWER\\(email\\)").WillReturnRows(sqlmock.NewRows(passwordUserColumns))
+			},
+			err: ErrInvalidCredentials,
+		},
+		{
+			name:     "database unavailable",
+			password: "secret",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT (.+) FROM users WHERE LOWER\\(email\\)").WillReturnError(outage)
+			},
+			err: outage,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := setupPasswordTest(t)
+			tt.expect(mock)
+
+			authenticator := &PasswordAuthenticator{}
+			user, err := authenticator.Authenticate("alice@example.com", tt.password)
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				assert.Nil(t, user)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.user, user)
+		})
+	}
+}
+
+func TestAuthenticateStopsOnDatabaseErrors(t *testing.T) {
+	defer func(previous []Authenticator) { authenticators = previous }(authenticators)
+
+	mock := setupPasswordTest(t)
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE LOWER\\(email\\)").WillReturnError(errors.New("connection refused"))
+
+	directory := &stubAuthenticator{user: &AuthenticatedUser{Email: "alice@example.com", Roles: []string{"admin"}}}
+	authenticators = []Authenticator{&PasswordAuthenticator{}, directory}
+
+	user, err := authenticate("alice@example.com", "secret")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrInvalidCredentials)
+	assert.Nil(t, user)
+}
@@ -0,0 +1,224 @@
+// Sign in through external OAuth2/OIDC identity providers
+package authentication
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+
+	"server/env"
+	"server/federation"
+	"server/helpers"
+	"server/models"
+	"server/redis"
+)
+
+// How long a user has to complete the sign in at the provider
+const externalStateTTL = 10 * time.Minute
+
+const externalStateKeyPrefix = "oauth:state:"
+
+var externalProviders = map[string]*federation.Provider{}
+
+var identityModel models.UserIdentity
+
+// Returned when the provider did not assert a verified email to link the identity with
+var ErrUnverifiedEmail = errors.New("The identity provider did not return a verified email")
+
+// Login attempt persisted between the start and callback requests
+type externalLoginState struct {
+	Provider     string `json:"provider"`
+	CodeVerifier string `json:"code_verifier"`
+}
+
+// Configures the external identity providers from `env.Config`
+func InitExternalProviders(configs map[string]env.OAuthProvider) error {
+	providers, err := federation.NewProviders(configs)
+	if err != nil {
+		return err
+	}
+
+	externalProviders = providers
+	return nil
+}
+
+// Start External Login
+//
+//	@Summary      Start External Login
+//	@Description  Redirects to the external identity provider to sign in
+//	@Tags         oauth
+//	@Param provider path string true "Provider, e.g. google, github or gitlab"
+//	@Router       /oauth/external/{provider}/start [get]
+//	@Success 302
+//	@Failure 404 {object} string
+func StartExternalLogin(w http.ResponseWriter, r *http.Request) {
+	provider, ok := externalProviders[chi.URLParam(r, "provider")]
+	if !ok {
+		helpers.ErrorJSON(w, errors.New("Unknown identity provider"), http.StatusNotFound)
+		return
+	}
+
+	state, err := helpers.RandomToken(32)
+	if err != nil {
+		log.Error().Err(err).Msg("Error generating state")
+		helpers.ErrorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	codeVerifier, err := helpers.RandomToken(32)
+	if err != nil {
+		log.Error().Err(err).Msg("Error generating code verifier")
+		helpers.ErrorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload, _ := json.Marshal(externalLoginState{Provider: provider.Name, CodeVerifier: codeVerifier})
+
+	err = redis.SetCache(externalStateKeyPrefix+state, string(payload), externalStateTTL)
+	if err != nil {
+		log.Error().Err(err).Msg("Error saving login state to redis")
+		helpers.ErrorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, provider.AuthCodeURL(state, codeVerifier), http.StatusFound)
+}
+
+// External Login Callback
+//
+//	@Summary      External Login Callback
+//	@Description  Completes the sign in at the external identity provider and issues a token pair.
+//	@Description  The identity is linked to the user with the same verified email, or a new user is provisioned.
+//	@Tags         oauth
+//	@Produce      json
+//	@Param provider path string true "Provider, e.g. google, github or gitlab"
+//	@Param code query string true "Authorization code"
+//	@Param state query string true "State returned by the provider"
+//	@Router       /oauth/external/{provider}/callback [get]
+//	@Success 200 {object} string
+//	@Failure 400 {object} string
+//	@Failure 401 {object} string
+//	@Failure 500 {object} string
+func ExternalLoginCallback(w http.ResponseWriter, r *http.Request) {
+	provider, ok := externalProviders[chi.URLParam(r, "provider")]
+	if !ok {
+		helpers.ErrorJSON(w, errors.New("Unknown identity provider"), http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+
+	if query.Get("error") != "" {
+		helpers.ErrorJSON(w, errors.New("Sign in was cancelled or denied: "+query.Get("error")), http.StatusUnauthorized)
+		return
+	}
+
+	state, code := query.Get("state"), query.Get("code")
+	if state == "" || code == "" {
+		helpers.ErrorJSON(w, errors.New("Missing code or state"), http.StatusBadRequest)
+		return
+	}
+
+	// The state is single use
+	cached, _ := redis.GetCache(externalStateKeyPrefix + state)
+	_ = redis.DeleteCache(externalStateKeyPrefix + state)
+
+	var loginState externalLoginState
+	if cached == "" || json.Unmarshal([]byte(cached), &loginState) != nil || loginState.Provider != provider.Name {
+		helpers.ErrorJSON(w, errors.New("Invalid or expired state"), http.StatusBadRequest)
+		return
+	}
+
+	accessToken, err := provider.Exchange(r.Context(), code, loginState.CodeVerifier)
+	if err != nil {
+		log.Error().Err(err).Msgf("Error exchanging code with %s", provider.Name)
+		helpers.ErrorJSON(w, errors.New("Unable to sign in with "+provider.Name), http.StatusUnauthorized)
+		return
+	}
+
+	identity, err := provider.FetchIdentity(r.Context(), accessToken)
+	if err != nil {
+		log.Error().Err(err).Msgf("Error fetching identity from %s", provider.Name)
+		helpers.ErrorJSON(w, errors.New("Unable to sign in with "+provider.Name), http.StatusUnauthorized)
+		return
+	}
+
+	linkedUser, err := linkExternalIdentity(identity)
+	if errors.Is(err, ErrUnverifiedEmail) || errors.Is(err, models.ErrUserNotFound) {
+		helpers.ErrorJSON(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error linking external identity")
+		helpers.ErrorJSON(w, errors.New("Unable to sign in with "+provider.Name), http.StatusInternalServerError)
+		return
+	}
+
+	issueTokenPair(w, AuthenticatedUser{Email: linkedUser.Email})
+}
+
+// Returns the user linked to the identity
+// Links it to the user with the same verified email, or provisions a new user
+func linkExternalIdentity(identity *federation.Identity) (*models.User, error) {
+	existing, err := identityModel.FindByProviderSubject(identity.Provider, identity.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing != nil {
+		return userModel.FindByID(existing.UserID)
+	}
+
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, ErrUnverifiedEmail
+	}
+
+	var linkedUser *models.User
+
+	found, err := userModel.FindByEmail(identity.Email)
+	if err != nil && !errors.Is(err, models.ErrUserNotFound) {
+		// Provisioning on a failed lookup would duplicate the user
+		return nil, err
+	}
+
+	if found != nil {
+		linkedUser = &models.User{ID: found.ID, Email: found.Email}
+	} else {
+		// Just in time provisioning, the random password can only be replaced by a reset
+		password, err := helpers.RandomToken(32)
+		if err != nil {
+			return nil, err
+		}
+
+		name := identity.Name
+		if name == "" {
+			name = identity.Email
+		}
+
+		created, err := userModel.Create(models.User{Name: name, Email: identity.Email, Password: password})
+		if err != nil {
+			return nil, err
+		}
+
+		linkedUser = &models.User{ID: created.ID, Email: created.Email}
+
+		log.Info().Msgf("Provisioned user %s from %s", linkedUser.ID, identity.Provider)
+	}
+
+	_, err = identityModel.Create(models.UserIdentity{
+		UserID:   linkedUser.ID,
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return linkedUser, nil
+}
@@ -0,0 +1,277 @@
+package authentication
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v4"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+
+	"server/env"
+	"server/federation"
+	"server/federation/federationtest"
+	"server/models"
+	"server/redis"
+)
+
+const (
+	externalSubject = "10769150350006150715113082367"
+	externalUserID  = "9b2c1e0e-6f55-4c4b-9a0b-3f1f4a8b2c11"
+)
+
+var identityColumns = []string{"id", "user_id", "provider", "subject", "email", "created_at", "updated_at"}
+
+// Serves the external login routes with the google and github providers backed by one mock IdP
+func setupExternalTest(t *testing.T, userinfo map[string]interface{}) (sqlmock.Sqlmock, *federationtest.IdP, http.Handler) {
+	dbMock, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating DB mock: %s", err)
+	}
+	t.Cleanup(func() { dbMock.Close() })
+
+	models.New(dbMock)
+
+	redisServer := miniredis.RunT(t)
+	redis.SetClient(goredis.NewClient(&goredis.Options{Addr: redisServer.Addr()}))
+
+	previousConfig, previousProviders := env.DefaultConfig, externalProviders
+	t.Cleanup(func() { env.DefaultConfig, externalProviders = previousConfig, previousProviders })
+
+	env.DefaultConfig.JWT_SECRET = "test-secret"
+
+	idp := federationtest.NewIdP(t, "", userinfo, nil)
+
+	externalProviders = map[string]*federation.Provider{}
+	for _, name := range []string{"google", "github"} {
+		provider, err := federation.NewProvider(name, env.OAuthProvider{
+			CLIENT_ID:     federationtest.ClientID,
+			CLIENT_SECRET: federationtest.ClientSecret,
+			REDIRECT_URL:  "http://localhost:5000/oauth/external/" + name + "/callback",
+			AUTH_URL:      idp.URL + "/authorize",
+			TOKEN_URL:     idp.URL + "/token",
+			USERINFO_URL:  idp.URL + "/userinfo",
+		})
+		if err != nil {
+			t.Fatalf("Error creating provider: %s", err)
+		}
+
+		externalProviders[name] = provider
+	}
+
+	router := chi.NewRouter()
+	router.Get("/oauth/external/{provider}/start", StartExternalLogin)
+	router.Get("/oauth/external/{provider}/callback", ExternalLoginCallback)
+
+	return mock, idp, router
+}
+
+// Starts a sign in at the provider and returns the state of the redirect
+// The IdP is set up to expect the code verifier of the login
+func startExternalLogin(t *testing.T, router http.Handler, idp *federationtest.IdP, provider string) string {
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/oauth/external/"+provider+"/start", nil))
+
+	if !assert.Equal(t, http.StatusFound, rec.Code) {
+		t.FailNow()
+	}
+
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("Error parsing redirect: %s", err)
+	}
+
+	state := location.Query().Get("state")
+
+	cached, err := redis.GetCache(externalStateKeyPrefix + state)
+	if err != nil {
+		t.Fatalf("Error reading login state: %s", err)
+	}
+
+	var loginState externalLoginState
+	assert.NoError(t, json.Unmarshal([]byte(cached), &loginState))
+	assert.Equal(t, provider, loginState.Provider)
+	assert.Equal(t, federation.CodeChallenge(loginState.CodeVerifier), location.Query().Get("code_challenge"))
+
+	idp.Verifier = loginState.CodeVerifier
+
+	return state
+}
+
+func externalCallback(router http.Handler, provider string, state string) *httptest.ResponseRecorder {
+	query := url.Values{"code": {federationtest.Code}, "state": {state}}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/oauth/external/"+provider+"/callback?"+query.Encode(), nil))
+
+	return rec
+}
+
+func expectIdentityLookup(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery("SELECT (.+) FROM user_identities WHERE provider").WithArgs("google", externalSubject).
+		WillReturnRows(sqlmock.NewRows(identityColumns))
+}
+
+func expectIdentityCreate(mock sqlmock.Sqlmock, email string) {
+	mock.ExpectQuery("INSERT INTO user_identities").WithArgs(externalUserID, "google", externalSubject, email, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(identityColumns).
+			AddRow("5f0c3a52-8d0e-4b8e-9a61-0c6b7a1d2e3f", externalUserID, "google", externalSubject, email, time.Now(), time.Now()))
+}
+
+// Returns the subject of the access token issued by the callback
+func accessTokenSubject(t *testing.T, rec *httptest.ResponseRecorder) string {
+	var response struct {
+		AccessToken string `json:"access_token"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(response.AccessToken, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte("test-secret"), nil
+	})
+	if !assert.NoError(t, err) {
+		return ""
+	}
+
+	subject, _ := claims["sub"].(string)
+	return subject
+}
+
+func TestExternalLoginCallback(t *testing.T) {
+	userColumns := []string{"id", "name", "email", "password", "created_at", "updated_at", "reputation"}
+
+	tests := []struct {
+		name     string
+		userinfo map[string]interface{}
+		expect   func(mock sqlmock.Sqlmock)
+		status   int
+		subject  string
+	}{
+		{
+			name:     "linked to the user with the same verified email",
+			userinfo: map[string]interface{}{"sub": externalSubject, "email": "Alice@example.com", "email_verified": true, "name": "Alice"},
+			expect: func(mock sqlmock.Sqlmock) {
+				expectIdentityLookup(mock)
+				mock.ExpectQuery("SELECT (.+) FROM users WHERE LOWER\\(email\\)").WithArgs("alice@example.com").
+					WillReturnRows(sqlmock.NewRows(userColumns).AddRow(externalUserID, "Alice", "alice@example.com", "hash", time.Now(), time.Now(), 0))
+				expectIdentityCreate(mock, "alice@example.com")
+			},
+			status:  http.StatusOK,
+			subject: "alice@example.com",
+		},
+		{
+			name:     "provisioned just in time",
+			userinfo: map[string]interface{}{"sub": externalSubject, "email": "carol@example.com", "email_verified": true, "name": "Carol"},
+			expect: func(mock sqlmock.Sqlmock) {
+				expectIdentityLookup(mock)
+				mock.ExpectQuery("SELECT (.+) FROM users WHERE LOWER\\(email\\)").WithArgs("carol@example.com").
+					WillReturnRows(sqlmock.NewRows(userColumns))
+				mock.ExpectQuery("INSERT INTO users").WithArgs("Carol", "carol@example.com", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "created_at", "updated_at", "reputation"}).
+						AddRow(externalUserID, "Carol", "carol@example.com", time.Now(), time.Now(), 0))
+				expectIdentityCreate(mock, "carol@example.com")
+			},
+			status:  http.StatusOK,
+			subject: "carol@example.com",
+		},
+		{
+			name:     "linked identity signs in",
+			userinfo: map[string]interface{}{"sub": externalSubject, "email": "renamed@example.com", "email_verified": false},
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT (.+) FROM user_identities WHERE provider").WithArgs("google", externalSubject).
+					WillReturnRows(sqlmock.NewRows(identityColumns).
+						AddRow("5f0c3a52-8d0e-4b8e-9a61-0c6b7a1d2e3f", externalUserID, "google", externalSubject, "alice@example.com", time.Now(), time.Now()))
+				mock.ExpectQuery("SELECT (.+) FROM users WHERE id").WithArgs(externalUserID).
+					WillReturnRows(sqlmock.NewRows(userColumns).AddRow(externalUserID, "Alice", "alice@example.com", "hash", time.Now(), time.Now(), 0))
+			},
+			status:  http.StatusOK,
+			subject: "alice@example.com",
+		},
+		{
+			name:     "unverified email rejected",
+			userinfo: map[string]interface{}{"sub": externalSubject, "email": "alice@example.com", "email_verified": false},
+			expect:   expectIdentityLookup,
+			status:   http.StatusUnauthorized,
+		},
+		{
+			name:     "failed user lookup does not provision",
+			userinfo: map[string]interface{}{"sub": externalSubject, "email": "alice@example.com", "email_verified": true},
+			expect: func(mock sqlmock.Sqlmock) {
+				expectIdentityLookup(mock)
+				mock.ExpectQuery("SELECT (.+) FROM users WHERE LOWER\\(email\\)").WillReturnError(errors.New("connection refused"))
+			},
+			status: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, idp, router := setupExternalTest(t, tt.userinfo)
+			tt.expect(mock)
+
+			state := startExternalLogin(t, router, idp, "google")
+			rec := externalCallback(router, "google", state)
+
+			assert.Equal(t, tt.status, rec.Code)
+			assert.NoError(t, mock.ExpectationsWereMet())
+
+			if tt.status == http.StatusOK {
+				assert.Equal(t, tt.subject, accessTokenSubject(t, rec))
+			}
+		})
+	}
+}
+
+func TestExternalLoginStateIsSingleUse(t *testing.T) {
+	mock, idp, router := setupExternalTest(t, map[string]interface{}{"sub": externalSubject, "email": "alice@example.com", "email_verified": false})
+
+	mock.ExpectQuery("SELECT (.+) FROM user_identities WHERE provider").WithArgs("google", externalSubject).
+		WillReturnRows(sqlmock.NewRows(identityColumns).
+			AddRow("5f0c3a52-8d0e-4b8e-9a61-0c6b7a1d2e3f", externalUserID, "google", externalSubject, "alice@example.com", time.Now(), time.Now()))
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id").WithArgs(externalUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "password", "created_at", "updated_at", "reputation"}).
+			AddRow(externalUserID, "Alice", "alice@example.com", "hash", time.Now(), time.Now(), 0))
+
+	state := startExternalLogin(t, router, idp, "google")
+
+	assert.Equal(t, http.StatusOK, externalCallback(router, "google", state).Code)
+
+	rec := externalCallback(router, "google", state)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Invalid or expired state")
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExternalLoginStateProviderMismatch(t *testing.T) {
+	mock, idp, router := setupExternalTest(t, map[string]interface{}{"sub": externalSubject, "email": "alice@example.com", "email_verified": true})
+
+	state := startExternalLogin(t, router, idp, "google")
+
+	rec := externalCallback(router, "github", state)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Invalid or expired state")
+
+	// The state is consumed by the failed attempt
+	rec = externalCallback(router, "google", state)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStartExternalLoginUnknownProvider(t *testing.T) {
+	_, _, router := setupExternalTest(t, nil)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/oauth/external/myspace/start", nil))
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,244 @@
+package authentication
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/rs/zerolog/log"
+
+	"server/env"
+	"server/helpers"
+	"server/models"
+)
+
+const (
+	defaultLDAPUserFilter  = "(&(objectClass=person)(|(sAMAccountName=%[1]s)(uid=%[1]s)(mail=%[1]s)))"
+	defaultLDAPGroupFilter = "(&(|(objectClass=group)(objectClass=groupOfNames))(member=%s))"
+)
+
+// Verifies credentials with an LDAP bind and maps the user's groups to roles
+// Users are provisioned into the users table on their first sign in
+type LDAPAuthenticator struct {
+	Config env.LDAPConfig
+
+	// Creates the local user if it does not exist yet
+	Provision func(email string, name string) error
+}
+
+// Returns an LDAP backend with defaults for the optional settings
+func NewLDAPAuthenticator(config env.LDAPConfig) (*LDAPAuthenticator, error) {
+	if config.URL == "" || config.USER_BASE_DN == "" {
+		return nil, errors.New("the ldap backend requires $LDAP_URL and $LDAP_USER_BASE_DN")
+	}
+
+	if config.USER_FILTER == "" {
+		config.USER_FILTER = defaultLDAPUserFilter
+	}
+	if config.GROUP_FILTER == "" {
+		config.GROUP_FILTER = defaultLDAPGroupFilter
+	}
+	if config.GROUP_BASE_DN == "" {
+		config.GROUP_BASE_DN = config.USER_BASE_DN
+	}
+	if config.EMAIL_ATTRIBUTE == "" {
+		config.EMAIL_ATTRIBUTE = "mail"
+	}
+	if config.NAME_ATTRIBUTE == "" {
+		config.NAME_ATTRIBUTE = "cn"
+	}
+
+	return &LDAPAuthenticator{Config: config, Provision: provisionUser}, nil
+}
+
+func (a *LDAPAuthenticator) Authenticate(username string, password string) (*AuthenticatedUser, error) {
+	// An empty password would be an unauthenticated bind, which most servers accept
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := a.dial()
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	err = a.bindServiceAccount(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := a.findUser(conn, fmt.Sprintf(a.Config.USER_FILTER, ldap.EscapeFilter(username)))
+	if err != nil {
+		return nil, err
+	}
+
+	err = conn.Bind(entry.DN, password)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	email := helpers.NormalizeEmail(entry.GetAttributeValue(a.Config.EMAIL_ATTRIBUTE))
+	if email == "" {
+		return nil, fmt.Errorf("ldap entry %s has no %s attribute", entry.DN, a.Config.EMAIL_ATTRIBUTE)
+	}
+
+	// Look groups up with the service account, users may not be allowed to
+	err = a.bindServiceAccount(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := a.roles(conn, entry.DN)
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.Provision(email, entry.GetAttributeValue(a.Config.NAME_ATTRIBUTE))
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthenticatedUser{Email: email, Roles: roles, Backend: a.Name()}, nil
+}
+
+func (a *LDAPAuthenticator) Name() string {
+	return "ldap"
+}
+
+// Looks the user up by email with the service account and returns the roles of its current groups
+func (a *LDAPAuthenticator) ResolveRoles(email string) ([]string, error) {
+	conn, err := a.dial()
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	err = a.bindServiceAccount(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := a.findUser(conn, fmt.Sprintf("(%s=%s)", a.Config.EMAIL_ATTRIBUTE, ldap.EscapeFilter(email)))
+	if err != nil {
+		return nil, err
+	}
+
+	return a.roles(conn, entry.DN)
+}
+
+func (a *LDAPAuthenticator) dial() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(a.Config.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.Config.START_TLS {
+		host := strings.Split(strings.TrimPrefix(a.Config.URL, "ldap://"), ":")[0]
+
+		err = conn.StartTLS(&tls.Config{ServerName: host})
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+// Returns the only entry below the user base DN matching the filter
+// Returns `ErrInvalidCredentials` if there is none or more than one
+func (a *LDAPAuthenticator) findUser(conn *ldap.Conn, filter string) (*ldap.Entry, error) {
+	result, err := conn.Search(ldap.NewSearchRequest(
+		a.Config.USER_BASE_DN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		filter,
+		[]string{a.Config.EMAIL_ATTRIBUTE, a.Config.NAME_ATTRIBUTE},
+		nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, err
+	}
+
+	if result == nil || len(result.Entries) != 1 {
+		log.Info().Msg("LDAP backend: no unique entry found for user")
+		return nil, ErrInvalidCredentials
+	}
+
+	return result.Entries[0], nil
+}
+
+func (a *LDAPAuthenticator) bindServiceAccount(conn *ldap.Conn) error {
+	if a.Config.BIND_DN == "" {
+		return conn.UnauthenticatedBind("")
+	}
+
+	return conn.Bind(a.Config.BIND_DN, a.Config.BIND_PASSWORD)
+}
+
+// Returns the roles mapped to the groups the user is a member of
+// Groups are matched by their DN or CN, case-insensitively
+func (a *LDAPAuthenticator) roles(conn *ldap.Conn, userDN string) ([]string, error) {
+	result, err := conn.Search(ldap.NewSearchRequest(
+		a.Config.GROUP_BASE_DN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		fmt.Sprintf(a.Config.GROUP_FILTER, ldap.EscapeFilter(userDN)),
+		[]string{"cn"},
+		nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	var roles []string
+
+	for _, group := range result.Entries {
+		for name, role := range a.Config.GROUP_ROLES {
+			matches := strings.EqualFold(name, group.DN) || strings.EqualFold(name, group.GetAttributeValue("cn"))
+
+			if matches && !helpers.Contains(roles, role) {
+				roles = append(roles, role)
+			}
+		}
+	}
+
+	sort.Strings(roles)
+
+	return roles, nil
+}
+
+// Creates a user for a directory account signing in for the first time
+// Its random password can't be used, the directory stays the source of truth
+func provisionUser(email string, name string) error {
+	var user models.User
+
+	if _, err := user.FindByEmail(email); err == nil {
+		return nil
+	}
+
+	password, err := helpers.RandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	if name == "" {
+		name = email
+	}
+
+	_, err = user.Create(models.User{Name: name, Email: email, Password: password})
+	if err != nil {
+		return err
+	}
+
+	log.Info().Msgf("Provisioned user %s from LDAP", email)
+
+	return nil
+}
@@ -0,0 +1,520 @@
+package authentication
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/golang-jwt/jwt/v4"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+
+	"server/env"
+	"server/models"
+	"server/redis"
+)
+
+// LDAP protocol operations handled by `fakeLDAPServer`
+const (
+	ldapBindRequest      = 0
+	ldapBindResponse     = 1
+	ldapUnbindRequest    = 2
+	ldapSearchRequest    = 3
+	ldapSearchResultItem = 4
+	ldapSearchResultDone = 5
+
+	ldapSuccess            = 0
+	ldapInvalidCredentials = 49
+)
+
+type fakeLDAPEntry struct {
+	dn         string
+	password   string
+	attributes map[string][]string
+}
+
+// In-process LDAP server supporting simple binds and subtree searches
+type fakeLDAPServer struct {
+	listener net.Listener
+	entries  []fakeLDAPEntry
+}
+
+func newFakeLDAPServer(t *testing.T, entries []fakeLDAPEntry) *fakeLDAPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error starting LDAP server: %s", err)
+	}
+
+	server := &fakeLDAPServer{listener: listener, entries: entries}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go server.serve(conn)
+		}
+	}()
+
+	return server
+}
+
+func (s *fakeLDAPServer) URL() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *fakeLDAPServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		request, err := ber.ReadPacket(conn)
+		if err != nil || len(request.Children) < 2 {
+			return
+		}
+
+		messageID := request.Children[0].Value
+		op := request.Children[1]
+
+		switch op.Tag {
+		case ldapBindRequest:
+			dn := op.Children[1].Value.(string)
+			password := op.Children[2].Data.String()
+
+			code := ldapInvalidCredentials
+			if dn == "" && password == "" {
+				code = ldapSuccess
+			}
+
+			for _, entry := range s.entries {
+				if strings.EqualFold(entry.dn, dn) && entry.password != "" && entry.password == password {
+					code = ldapSuccess
+				}
+			}
+
+			conn.Write(ldapResponse(messageID, ldapBindResponse, code).Bytes())
+		case ldapSearchRequest:
+			base := op.Children[0].Value.(string)
+			filter := op.Children[6]
+
+			for _, entry := range s.entries {
+				if !strings.HasSuffix(strings.ToLower(entry.dn), strings.ToLower(base)) || !matchesFilter(entry, filter) {
+					continue
+				}
+
+				conn.Write(searchResultEntry(messageID, entry).Bytes())
+			}
+
+			conn.Write(ldapResponse(messageID, ldapSearchResultDone, ldapSuccess).Bytes())
+		case ldapUnbindRequest:
+			return
+		}
+	}
+}
+
+func ldapResponse(messageID interface{}, op ber.Tag, code int) *ber.Packet {
+	response := ber.NewSequence("LDAP Response")
+	response.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "Message ID"))
+
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, op, nil, "Result")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "Result Code"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+	response.AppendChild(result)
+
+	return response
+}
+
+func searchResultEntry(messageID interface{}, entry fakeLDAPEntry) *ber.Packet {
+	response := ber.NewSequence("LDAP Response")
+	response.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "Message ID"))
+
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldapSearchResultItem, nil, "Search Result Entry")
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, "DN"))
+
+	attributes := ber.NewSequence("Attributes")
+	for name, values := range entry.attributes {
+		attribute := ber.NewSequence("Attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+		}
+
+		attribute.AppendChild(set)
+		attributes.AppendChild(attribute)
+	}
+
+	result.AppendChild(attributes)
+	response.AppendChild(result)
+
+	return response
+}
+
+// Evaluates the and, or, not, equality and presence filters
+func matchesFilter(entry fakeLDAPEntry, filter *ber.Packet) bool {
+	switch filter.Tag {
+	case 0:
+		for _, child := range filter.Children {
+			if !matchesFilter(entry, child) {
+				return false
+			}
+		}
+		return true
+	case 1:
+		for _, child := range filter.Children {
+			if matchesFilter(entry, child) {
+				return true
+			}
+		}
+		return false
+	case 2:
+		return !matchesFilter(entry, filter.Children[0])
+	case 3:
+		name, value := filter.Children[0].Value.(string), filter.Children[1].Value.(string)
+		for _, v := range attributeValues(entry, name) {
+			if strings.EqualFold(v, value) {
+				return true
+			}
+		}
+		return false
+	case 7:
+		return len(attributeValues(entry, filter.Data.String())) > 0
+	}
+
+	return false
+}
+
+func attributeValues(entry fakeLDAPEntry, name string) []string {
+	for key, values := range entry.attributes {
+		if strings.EqualFold(key, name) {
+			return values
+		}
+	}
+
+	return nil
+}
+
+const testServiceDN = "cn=svc,dc=example,dc=com"
+
+var testDirectory = []fakeLDAPEntry{
+	{dn: testServiceDN, password: "svc-secret", attributes: map[string][]string{"objectClass": {"person"}, "cn": {"svc"}}},
+	{dn: "uid=alice,ou=people,dc=example,dc=com", password: "alice-secret", attributes: map[string][]string{
+		"objectClass": {"person", "inetOrgPerson"},
+		"uid":         {"alice"},
+		"cn":          {"Alice Admin"},
+		"mail":        {"alice@example.com"},
+	}},
+	{dn: "uid=bob,ou=people,dc=example,dc=com", password: "bob-secret", attributes: map[string][]string{
+		"objectClass": {"person"},
+		"uid":         {"bob"},
+		"cn":          {"Bob"},
+		"mail":        {"bob@example.com"},
+	}},
+	{dn: "cn=Domain Admins,ou=groups,dc=example,dc=com", attributes: map[string][]string{
+		"objectClass": {"group"},
+		"cn":          {"Domain Admins"},
+		"member":      {"uid=alice,ou=people,dc=example,dc=com"},
+	}},
+	{dn: "cn=Support,ou=groups,dc=example,dc=com", attributes: map[string][]string{
+		"objectClass": {"groupOfNames"},
+		"cn":          {"Support"},
+		"member":      {"uid=alice,ou=people,dc=example,dc=com", "uid=bob,ou=people,dc=example,dc=com"},
+	}},
+	{dn: "cn=Unmapped,ou=groups,dc=example,dc=com", attributes: map[string][]string{
+		"objectClass": {"group"},
+		"cn":          {"Unmapped"},
+		"member":      {"uid=bob,ou=people,dc=example,dc=com"},
+	}},
+}
+
+type provisioned struct {
+	email string
+	name  string
+}
+
+func newTestLDAPAuthenticator(t *testing.T) (*LDAPAuthenticator, *[]provisioned) {
+	server := newFakeLDAPServer(t, testDirectory)
+
+	authenticator, err := NewLDAPAuthenticator(env.LDAPConfig{
+		URL:           server.URL(),
+		BIND_DN:       testServiceDN,
+		BIND_PASSWORD: "svc-secret",
+		USER_BASE_DN:  "ou=people,dc=example,dc=com",
+		GROUP_BASE_DN: "ou=groups,dc=example,dc=com",
+		GROUP_ROLES: map[string]string{
+			"domain admins":                          "admin",
+			"cn=Support,ou=groups,dc=example,dc=com": "support",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Error creating LDAP authenticator: %s", err)
+	}
+
+	var calls []provisioned
+	authenticator.Provision = func(email string, name string) error {
+		calls = append(calls, provisioned{email, name})
+		return nil
+	}
+
+	return authenticator, &calls
+}
+
+func TestLDAPAuthenticator(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		password string
+		err      error
+		user     *AuthenticatedUser
+		provName string
+	}{
+		{
+			name:     "groups mapped by cn and dn",
+			username: "alice",
+			password: "alice-secret",
+			user:     &AuthenticatedUser{Email: "alice@example.com", Roles: []string{"admin", "support"}, Backend: "ldap"},
+			provName: "Alice Admin",
+		},
+		{
+			name:     "sign in with email, unmapped groups ignored",
+			username: "bob@example.com",
+			password: "bob-secret",
+			user:     &AuthenticatedUser{Email: "bob@example.com", Roles: []string{"support"}, Backend: "ldap"},
+			provName: "Bob",
+		},
+		{name: "wrong password", username: "alice", password: "bob-secret", err: ErrInvalidCredentials},
+		{name: "empty password", username: "alice", password: "", err: ErrInvalidCredentials},
+		{name: "unknown user", username: "mallory", password: "secret", err: ErrInvalidCredentials},
+		{name: "filter injection", username: "*", password: "alice-secret", err: ErrInvalidCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authenticator, calls := newTestLDAPAuthenticator(t)
+
+			user, err := authenticator.Authenticate(tt.username, tt.password)
+
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				assert.Nil(t, user)
+				assert.Empty(t, *calls)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.user, user)
+			assert.Equal(t, []provisioned{{tt.user.Email, tt.provName}}, *calls)
+		})
+	}
+}
+
+func TestLDAPAuthenticatorServiceAccount(t *testing.T) {
+	authenticator, _ := newTestLDAPAuthenticator(t)
+	authenticator.Config.BIND_PASSWORD = "wrong"
+
+	_, err := authenticator.Authenticate("alice", "alice-secret")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestLDAPAuthenticatorResolveRoles(t *testing.T) {
+	tests := []struct {
+		name  string
+		email string
+		err   error
+		roles []string
+	}{
+		{name: "groups mapped by cn and dn", email: "alice@example.com", roles: []string{"admin", "support"}},
+		{name: "email matched case-insensitively", email: "Bob@example.com", roles: []string{"support"}},
+		{name: "removed from the directory", email: "carol@example.com", err: ErrInvalidCredentials},
+		{name: "filter injection", email: "*", err: ErrInvalidCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authenticator, _ := newTestLDAPAuthenticator(t)
+
+			roles, err := authenticator.ResolveRoles(tt.email)
+
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.roles, roles)
+		})
+	}
+}
+
+func TestRefreshTokenResolvesRoles(t *testing.T) {
+	tests := []struct {
+		name   string
+		email  string
+		claims jwt.MapClaims
+		status int
+		roles  []string
+	}{
+		{
+			name:   "ldap user gets the current directory roles",
+			email:  "bob@example.com",
+			claims: jwt.MapClaims{"backend": "ldap"},
+			status: http.StatusOK,
+			roles:  []string{"support"},
+		},
+		{
+			name:   "roles carried in the refresh token are ignored",
+			email:  "bob@example.com",
+			claims: jwt.MapClaims{"backend": "ldap", "roles": []string{"admin"}},
+			status: http.StatusOK,
+			roles:  []string{"support"},
+		},
+		{
+			name:   "password user gets the stored roles",
+			email:  "bob@example.com",
+			claims: jwt.MapClaims{"backend": "password"},
+			status: http.StatusOK,
+			roles:  []string{"moderator"},
+		},
+		{
+			name:   "token without a backend has no roles",
+			email:  "bob@example.com",
+			claims: jwt.MapClaims{"roles": []string{"admin"}},
+			status: http.StatusOK,
+		},
+		{
+			name:   "removed from the directory",
+			email:  "carol@example.com",
+			claims: jwt.MapClaims{"backend": "ldap"},
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "backend no longer configured",
+			email:  "bob@example.com",
+			claims: jwt.MapClaims{"backend": "radius"},
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(previous []Authenticator) { authenticators = previous }(authenticators)
+
+			authenticator, _ := newTestLDAPAuthenticator(t)
+			authenticators = []Authenticator{authenticator, &PasswordAuthenticator{}}
+
+			dbMock, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("Error creating DB mock: %s", err)
+			}
+			defer dbMock.Close()
+
+			models.New(dbMock)
+
+			redisServer := miniredis.RunT(t)
+			redis.SetClient(goredis.NewClient(&goredis.Options{Addr: redisServer.Addr()}))
+
+			defer func(previous env.Config) { env.DefaultConfig = previous }(env.DefaultConfig)
+			env.DefaultConfig.JWT_SECRET = "test-secret"
+
+			claims := jwt.MapClaims{"sub": tt.email, "exp": time.Now().Add(time.Hour).Unix(), "jti": "refresh-id"}
+			for key, value := range tt.claims {
+				claims[key] = value
+			}
+
+			refreshToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test-secret"))
+			if err != nil {
+				t.Fatalf("Error signing refresh token: %s", err)
+			}
+
+			assert.NoError(t, redis.SetCache(tt.email, "refresh-id", time.Hour))
+
+			mock.ExpectQuery("SELECT (.+) FROM users WHERE LOWER\\(email\\)").WithArgs(tt.email).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "password", "created_at", "updated_at", "reputation"}).
+					AddRow("9b2c1e0e-6f55-4c4b-9a0b-3f1f4a8b2c11", "Bob", tt.email, "", time.Now(), time.Now(), 0))
+			if tt.claims["backend"] == "password" {
+				mock.ExpectQuery("SELECT r.role FROM user_roles").WithArgs(tt.email).
+					WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow("moderator"))
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/oauth/token/refresh", nil)
+			req.Header.Set("Authorization", "Bearer "+refreshToken)
+
+			rec := httptest.NewRecorder()
+			RefreshToken(rec, req)
+
+			assert.Equal(t, tt.status, rec.Code)
+			assert.NoError(t, mock.ExpectationsWereMet())
+
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				AccessToken string `json:"access_token"`
+			}
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+
+			accessToken, err := jwt.Parse(response.AccessToken, func(token *jwt.Token) (interface{}, error) {
+				return []byte("test-secret"), nil
+			})
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			var accessClaims struct {
+				AppMetadata models.AppMetadata `json:"app_metadata"`
+			}
+			payload, _ := json.Marshal(accessToken.Claims)
+			assert.NoError(t, json.Unmarshal(payload, &accessClaims))
+			assert.Equal(t, tt.roles, accessClaims.AppMetadata.Authorization.Roles)
+		})
+	}
+}
+
+type stubAuthenticator struct {
+	user *AuthenticatedUser
+	err  error
+}
+
+func (a *stubAuthenticator) Authenticate(username string, password string) (*AuthenticatedUser, error) {
+	return a.user, a.err
+}
+
+func TestAuthenticateTriesBackendsInOrder(t *testing.T) {
+	defer func(previous []Authenticator) { authenticators = previous }(authenticators)
+
+	staff := &AuthenticatedUser{Email: "staff@example.com", Roles: []string{"admin"}}
+	customer := &AuthenticatedUser{Email: "customer@example.com"}
+	unavailable := errors.New("directory unavailable")
+
+	authenticators = []Authenticator{&stubAuthenticator{err: ErrInvalidCredentials}, &stubAuthenticator{user: customer}}
+	user, err := authenticate("customer@example.com", "secret")
+	assert.NoError(t, err)
+	assert.Equal(t, customer, user)
+
+	authenticators = []Authenticator{&stubAuthenticator{user: staff}, &stubAuthenticator{user: customer}}
+	user, err = authenticate("staff", "secret")
+	assert.NoError(t, err)
+	assert.Equal(t, staff, user)
+
+	authenticators = []Authenticator{&stubAuthenticator{err: unavailable}, &stubAuthenticator{user: customer}}
+	_, err = authenticate("customer@example.com", "secret")
+	assert.ErrorIs(t, err, unavailable)
+
+	authenticators = []Authenticator{&stubAuthenticator{err: ErrInvalidCredentials}}
+	_, err = authenticate("nobody", "secret")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
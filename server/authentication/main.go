@@ -62,95 +62,97 @@ func GenerateToken(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	current_user, err := userModel.FindByEmail(user.UserName)
-	if err != nil {
-		log.Error().Err(err).Msg("Error finding user")
-		helpers.ErrorJSON(w, err, http.StatusInternalServerError)
+	current_user, err := authenticate(user.UserName, user.Password)
+	if errors.Is(err, ErrInvalidCredentials) {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
 		return
 	}
 
-	//validate user credentials
-	verified := helpers.ComparePasswords(current_user.Password, user.Password)
-	if !verified {
-		helpers.ErrorJSON(w, errors.New("Invalid Credentials Passed"), http.StatusBadRequest)
+	if err != nil {
+		log.Error().Err(err).Msg("Error authenticating user")
+		helpers.ErrorJSON(w, errors.New("Unable to verify credentials"), http.StatusInternalServerError)
 		return
 	}
 
-	// roles := []string{current_user.UserRole}
-
-	if verified {
-		//create token
-		var token models.JWTClaims = models.JWTClaims{
-			Email: user.UserName,
-			AppMetadata: models.AppMetadata{
-				Authorization: models.Authorization{
-					// Roles: roles,
-				},
-			},
-			Subject:    user.UserName,
-			Audience:   "HOST", //TODO: Add audience from env
-			Expiration: time.Now().Add(time.Hour * 24).Unix(),
-			IssuedAt:   time.Now().Unix(),
-			//TODO: Generate JWTID from database
-		}
+	issueTokenPair(w, *current_user)
+}
 
-		log.Info().Msgf("token: %v", token)
+// Issues an access and refresh token pair for the user and writes it to the response
+// Shared by every way of signing in
+func issueTokenPair(w http.ResponseWriter, user AuthenticatedUser) {
+	email := helpers.NormalizeEmail(user.Email)
 
-		//Create JWT token
-		jwtToken := jwt.New(jwt.GetSigningMethod("HS256"))
+	//create token
+	var token models.JWTClaims = models.JWTClaims{
+		Email: email,
+		AppMetadata: models.AppMetadata{
+			Authorization: models.Authorization{
+				Roles: user.Roles,
+			},
+		},
+		Subject:    email,
+		Audience:   jwt.ClaimStrings{"HOST"}, //TODO: Add audience from env
+		Expiration: time.Now().Add(time.Hour * 24).Unix(),
+		IssuedAt:   time.Now().Unix(),
+		//TODO: Generate JWTID from database
+	}
 
-		jwtToken.Claims = token
+	log.Info().Msgf("token: %v", token)
 
-		signedToken, err := jwtToken.SignedString([]byte(env.DefaultConfig.JWT_SECRET))
+	//Create JWT token
+	jwtToken := jwt.New(jwt.GetSigningMethod("HS256"))
 
-		if err != nil {
-			log.Error().Err(err).Msg("Error signing token")
-			helpers.ErrorJSON(w, err, http.StatusInternalServerError)
-			return
-		}
+	jwtToken.Claims = token
 
-		log.Info().Msgf("signedToken: %v", signedToken)
+	signedToken, err := jwtToken.SignedString([]byte(env.DefaultConfig.JWT_SECRET))
 
-		jti := uuid.Must(uuid.NewV4()).String()
+	if err != nil {
+		log.Error().Err(err).Msg("Error signing token")
+		helpers.ErrorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
 
-		refreshToken := jwt.New(jwt.GetSigningMethod("HS256"))
-		rtClaims := refreshToken.Claims.(jwt.MapClaims)
-		rtClaims["sub"] = user.UserName
-		rtClaims["exp"] = time.Now().Add(time.Hour * 24 * 7).Unix()
-		rtClaims["jti"] = jti
+	log.Info().Msgf("signedToken: %v", signedToken)
 
-		rt, err := refreshToken.SignedString([]byte(env.DefaultConfig.JWT_SECRET))
-		if err != nil {
-			log.Error().Err(err).Msg("Error signing refresh token")
-			helpers.ErrorJSON(w, err, http.StatusInternalServerError)
-			return
-		}
+	jti := uuid.Must(uuid.NewV4()).String()
 
-		log.Info().Msgf("refreshToken: %v", rt)
+	refreshToken := jwt.New(jwt.GetSigningMethod("HS256"))
+	rtClaims := refreshToken.Claims.(jwt.MapClaims)
+	rtClaims["sub"] = email
+	rtClaims["exp"] = time.Now().Add(time.Hour * 24 * 7).Unix()
+	rtClaims["jti"] = jti
+	if user.Backend != "" {
+		rtClaims["backend"] = user.Backend // Roles are resolved again on refresh, not copied
+	}
 
-		//save JTI to redis
-		// err = redis.SetCache(jti, "true", rtClaims["exp"].(time.Duration))
-		err = redis.SetCache(user.UserName, jti, time.Hour*24*7)
+	rt, err := refreshToken.SignedString([]byte(env.DefaultConfig.JWT_SECRET))
+	if err != nil {
+		log.Error().Err(err).Msg("Error signing refresh token")
+		helpers.ErrorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
 
-		if err != nil {
-			log.Error().Err(err).Msg("Error saving JTI to redis")
-			helpers.ErrorJSON(w, err, http.StatusInternalServerError)
-			return
-		}
+	log.Info().Msgf("refreshToken: %v", rt)
 
-		response := struct {
-			AccessToken  string `json:"access_token"`
-			RefreshToken string `json:"refresh_token"`
-		}{
-			AccessToken:  signedToken,
-			RefreshToken: rt,
-		}
+	//save JTI to redis
+	// err = redis.SetCache(jti, "true", rtClaims["exp"].(time.Duration))
+	err = redis.SetCache(email, jti, time.Hour*24*7)
 
-		_ = helpers.WriteJSON(w, http.StatusOK, response)
+	if err != nil {
+		log.Error().Err(err).Msg("Error saving JTI to redis")
+		helpers.ErrorJSON(w, err, http.StatusInternalServerError)
 		return
 	}
 
-	helpers.ErrorJSON(w, errors.New("Invalid Credentials Passed"), http.StatusBadRequest)
+	response := struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+	}{
+		AccessToken:  signedToken,
+		RefreshToken: rt,
+	}
+
+	_ = helpers.WriteJSON(w, http.StatusOK, response)
 }
 
 // Refreshes a JWT token for the user
@@ -203,18 +205,33 @@ func RefreshToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// roles := []string{user.UserRole}
+	//re-read the roles so group changes apply to refreshed access tokens
+	var roles []string
+	if backend, ok := refreshTokenClaims.Claims.(jwt.MapClaims)["backend"].(string); ok {
+		roles, err = resolveRoles(backend, user.Email)
+
+		if errors.Is(err, ErrInvalidCredentials) {
+			helpers.ErrorJSON(w, errors.New("Invalid refresh token"), http.StatusBadRequest)
+			return
+		}
+
+		if err != nil {
+			log.Error().Err(err).Msg("Error resolving roles")
+			helpers.ErrorJSON(w, errors.New("Unable to verify credentials"), http.StatusInternalServerError)
+			return
+		}
+	}
 
 	//create token
 	var token models.JWTClaims = models.JWTClaims{
 		Email: user.Email,
 		AppMetadata: models.AppMetadata{
 			Authorization: models.Authorization{
-				// Roles: roles,
+				Roles: roles,
 			},
 		},
 		Subject:    user.Email,
-		Audience:   "HOST", //TODO: Add audience from env
+		Audience:   jwt.ClaimStrings{"HOST"}, //TODO: Add audience from env
 		Expiration: time.Now().Add(time.Hour * 24).Unix(),
 		IssuedAt:   time.Now().Unix(),
 	}
@@ -285,7 +302,7 @@ func RevokeToken(w http.ResponseWriter, r *http.Request) {
 	}
 
 	//revoke token
-	err = redis.DeleteCache(body.Email)
+	err = redis.DeleteCache(helpers.NormalizeEmail(body.Email))
 
 	if err != nil {
 		log.Error().Err(err).Msg("Error revoking token")
@@ -12,11 +12,8 @@ import (
 // Returns a pointer to the JWTAuth instance
 // Ensure that a `JWT_SECRET` environment variable is set
 func InitJWTAuth() *jwtauth.JWTAuth {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
-		os.Exit(1)
-	}
+	// The variables may also come from the environment alone
+	_ = godotenv.Load()
 
 	jwtSecret := os.Getenv("JWT_SECRET")
 	if jwtSecret == "" {
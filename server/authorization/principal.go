@@ -0,0 +1,77 @@
+package authorization
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gofrs/uuid"
+
+	"server/helpers"
+)
+
+// Ways a principal can have authenticated the current request
+const (
+	AuthMethodJWT = "jwt"
+)
+
+// Role allowed to manage every user
+const RoleAdmin = "admin"
+
+// Role allowed to review flagged content, admins have it implicitly
+const RoleModerator = "moderator"
+
+// The authenticated caller of the current request
+type Principal struct {
+	UserID     uuid.UUID `json:"user_id"`
+	Email      string    `json:"email"`
+	Roles      []string  `json:"roles"`
+	Scopes     []string  `json:"scopes"`
+	TokenID    string    `json:"token_id,omitempty"`
+	AuthMethod string    `json:"auth_method"`
+}
+
+// Unexported so only this package can set or read the principal
+type contextKey struct{ name string }
+
+var principalKey = &contextKey{"principal"}
+
+// Returns a copy of ctx carrying the principal
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey, principal)
+}
+
+// Returns the principal stored in ctx, if any
+func FromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey).(*Principal)
+	return principal, ok && principal != nil
+}
+
+// Checks if the principal has been granted the role
+func (p *Principal) HasRole(role string) bool {
+	return helpers.Contains(p.Roles, role)
+}
+
+// Checks if the principal has been granted the scope
+func (p *Principal) HasScope(scope string) bool {
+	return helpers.Contains(p.Scopes, scope)
+}
+
+// Checks if the principal may modify the user, users may only modify themselves
+// while admins may modify anyone
+func (p *Principal) CanManageUser(id uuid.UUID, email string) bool {
+	if id != uuid.Nil || p.HasRole(RoleAdmin) {
+		return p.CanModify(id)
+	}
+
+	return email != "" && strings.EqualFold(p.Email, email)
+}
+
+// Checks if the principal may modify a resource owned by the given user
+func (p *Principal) CanModify(ownerID uuid.UUID) bool {
+	return p.HasRole(RoleAdmin) || (ownerID != uuid.Nil && p.UserID == ownerID)
+}
+
+// Checks if the principal may review and change the status of any content
+func (p *Principal) CanModerate() bool {
+	return p.HasRole(RoleModerator) || p.HasRole(RoleAdmin)
+}
@@ -0,0 +1,67 @@
+package env
+
+import (
+	"os"
+	"strings"
+)
+
+// Settings of the LDAP / Active Directory authentication backend
+type LDAPConfig struct {
+	URL             string
+	START_TLS       bool
+	BIND_DN         string
+	BIND_PASSWORD   string
+	USER_BASE_DN    string
+	USER_FILTER     string
+	EMAIL_ATTRIBUTE string
+	NAME_ATTRIBUTE  string
+	GROUP_BASE_DN   string
+	GROUP_FILTER    string
+	GROUP_ROLES     map[string]string
+}
+
+// Loads the ordered list of authentication backends from `$AUTH_BACKENDS` (comma separated)
+// Defaults to the `password` backend
+func loadAuthBackends() []string {
+	var backends []string
+
+	for _, backend := range strings.Split(os.Getenv("AUTH_BACKENDS"), ",") {
+		backend = strings.ToLower(strings.TrimSpace(backend))
+		if backend != "" {
+			backends = append(backends, backend)
+		}
+	}
+
+	if len(backends) == 0 {
+		backends = []string{"password"}
+	}
+
+	return backends
+}
+
+// Loads the LDAP backend settings from `$LDAP_*` variables
+// `$LDAP_GROUP_ROLES` maps groups to roles, e.g. `Domain Admins=admin,Support=support`
+func loadLDAPConfig() LDAPConfig {
+	config := LDAPConfig{
+		URL:             os.Getenv("LDAP_URL"),
+		START_TLS:       os.Getenv("LDAP_START_TLS") == "true",
+		BIND_DN:         os.Getenv("LDAP_BIND_DN"),
+		BIND_PASSWORD:   os.Getenv("LDAP_BIND_PASSWORD"),
+		USER_BASE_DN:    os.Getenv("LDAP_USER_BASE_DN"),
+		USER_FILTER:     os.Getenv("LDAP_USER_FILTER"),
+		EMAIL_ATTRIBUTE: os.Getenv("LDAP_EMAIL_ATTRIBUTE"),
+		NAME_ATTRIBUTE:  os.Getenv("LDAP_NAME_ATTRIBUTE"),
+		GROUP_BASE_DN:   os.Getenv("LDAP_GROUP_BASE_DN"),
+		GROUP_FILTER:    os.Getenv("LDAP_GROUP_FILTER"),
+		GROUP_ROLES:     map[string]string{},
+	}
+
+	for _, mapping := range strings.Split(os.Getenv("LDAP_GROUP_ROLES"), ",") {
+		group, role, found := strings.Cut(mapping, "=")
+		if found && strings.TrimSpace(group) != "" && strings.TrimSpace(role) != "" {
+			config.GROUP_ROLES[strings.TrimSpace(group)] = strings.TrimSpace(role)
+		}
+	}
+
+	return config
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/rs/zerolog/log"
 	"errors"
 	"os"
+	"time"
 )
 
 // Config struct with environment variables
@@ -20,6 +21,24 @@ type Config struct {
 	ENVIRONMENT string
 	REDIS_HOST  string
 	REDIS_PORT  string
+
+	OAUTH_PROVIDERS map[string]OAuthProvider
+	AUTH_BACKENDS   []string
+	LDAP            LDAPConfig
+
+	SELF_REGISTRATION bool // Enables the public `/api/v1/register` endpoint
+
+	USER_RETENTION      time.Duration // How long soft deleted users are kept
+	USER_PURGE_INTERVAL time.Duration
+
+	VOTE_RECONCILE_INTERVAL time.Duration // How often scores and reputations are recomputed from the votes
+
+	MODERATION_FLAG_THRESHOLD int // Open flags after which content is hidden until a moderator reviews it
+
+	EXPORT_DIR            string        // Where data export archives are written
+	EXPORT_PURGE_INTERVAL time.Duration // How often expired archives are deleted
+
+	STORAGE StorageConfig
 }
 
 var DefaultConfig Config
@@ -126,6 +145,24 @@ func Load() (Config, error) {
 		ENVIRONMENT: environment,
 		REDIS_HOST:  redis_host,
 		REDIS_PORT:  redis_port,
+
+		OAUTH_PROVIDERS: loadOAuthProviders(),
+		AUTH_BACKENDS:   loadAuthBackends(),
+		LDAP:            loadLDAPConfig(),
+
+		SELF_REGISTRATION: os.Getenv("SELF_REGISTRATION") == "true",
+
+		USER_RETENTION:      loadDuration("USER_RETENTION", defaultUserRetention),
+		USER_PURGE_INTERVAL: loadDuration("USER_PURGE_INTERVAL", defaultUserPurgeInterval),
+
+		VOTE_RECONCILE_INTERVAL: loadDuration("VOTE_RECONCILE_INTERVAL", defaultVoteReconcileInterval),
+
+		MODERATION_FLAG_THRESHOLD: loadPositiveInt("MODERATION_FLAG_THRESHOLD", defaultModerationFlagThreshold),
+
+		EXPORT_DIR:            loadExportDir(),
+		EXPORT_PURGE_INTERVAL: loadDuration("EXPORT_PURGE_INTERVAL", defaultExportPurgeInterval),
+
+		STORAGE: loadStorageConfig(jwt_secret),
 	}
 
 	// log.Info().Msgf("Successfully loaded environment variables: %v", DefaultConfig)
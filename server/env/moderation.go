@@ -0,0 +1,27 @@
+package env
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Number of open flags hiding content by default
+const defaultModerationFlagThreshold = 3
+
+// Loads a positive integer from the variable, `fallback` if it is unset or invalid
+func loadPositiveInt(name string, fallback int) int {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback
+	}
+
+	value, err := strconv.Atoi(raw)
+	if err != nil || value <= 0 {
+		log.Warn().Err(err).Msgf("Invalid $%s, using %d", name, fallback)
+		return fallback
+	}
+
+	return value
+}
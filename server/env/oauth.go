@@ -0,0 +1,49 @@
+package env
+
+import (
+	"os"
+	"strings"
+)
+
+// Settings of an external OAuth2/OIDC identity provider
+// Endpoints may be left empty for providers with built-in defaults
+type OAuthProvider struct {
+	CLIENT_ID     string
+	CLIENT_SECRET string
+	REDIRECT_URL  string
+	AUTH_URL      string
+	TOKEN_URL     string
+	USERINFO_URL  string
+	EMAILS_URL    string
+	SCOPES        []string
+}
+
+// Loads the providers listed in `$OAUTH_PROVIDERS` (comma separated)
+// Each provider is read from `$OAUTH_<NAME>_*` variables, e.g. `$OAUTH_GOOGLE_CLIENT_ID`
+func loadOAuthProviders() map[string]OAuthProvider {
+	providers := map[string]OAuthProvider{}
+
+	for _, name := range strings.Split(os.Getenv("OAUTH_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OAUTH_" + strings.ToUpper(name) + "_"
+
+		provider := OAuthProvider{
+			CLIENT_ID:     os.Getenv(prefix + "CLIENT_ID"),
+			CLIENT_SECRET: os.Getenv(prefix + "CLIENT_SECRET"),
+			REDIRECT_URL:  os.Getenv(prefix + "REDIRECT_URL"),
+			AUTH_URL:      os.Getenv(prefix + "AUTH_URL"),
+			TOKEN_URL:     os.Getenv(prefix + "TOKEN_URL"),
+			USERINFO_URL:  os.Getenv(prefix + "USERINFO_URL"),
+			EMAILS_URL:    os.Getenv(prefix + "EMAILS_URL"),
+			SCOPES:        strings.Fields(strings.ReplaceAll(os.Getenv(prefix+"SCOPES"), ",", " ")),
+		}
+
+		providers[name] = provider
+	}
+
+	return providers
+}
@@ -0,0 +1,47 @@
+package env
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Defaults for the purge of soft deleted rows
+const (
+	defaultUserRetention     = 30 * 24 * time.Hour
+	defaultUserPurgeInterval = time.Hour
+)
+
+// Default interval of the reconciliation of vote scores and reputations
+const defaultVoteReconcileInterval = 6 * time.Hour
+
+// Default interval of the deletion of expired data exports
+const defaultExportPurgeInterval = time.Hour
+
+// Loads a duration such as `720h` from the variable, `fallback` if it is unset or invalid
+func loadDuration(name string, fallback time.Duration) time.Duration {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback
+	}
+
+	value, err := time.ParseDuration(raw)
+	if err != nil || value <= 0 {
+		log.Warn().Err(err).Msgf("Invalid $%s, using %s", name, fallback)
+		return fallback
+	}
+
+	return value
+}
+
+// Loads `$EXPORT_DIR`, defaults to a directory in the system temp dir
+func loadExportDir() string {
+	dir := os.Getenv("EXPORT_DIR")
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "data-exports")
+	}
+
+	return dir
+}
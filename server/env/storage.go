@@ -0,0 +1,103 @@
+package env
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Defaults for uploaded files
+const (
+	defaultStorageURLTTL     = 15 * time.Minute
+	defaultMaxUploadSize     = 10 << 20
+	defaultBlobGracePeriod   = time.Hour
+	defaultBlobPurgeInterval = time.Hour
+	defaultStorageS3Region   = "us-east-1"
+	defaultStorageLocalPath  = "uploads"
+)
+
+// Where uploaded files are stored
+type StorageConfig struct {
+	BACKEND string // `local` (default) or `s3`
+
+	DIR string // Root of the local backend
+
+	S3_ENDPOINT   string // e.g. `https://s3.eu-west-1.amazonaws.com` or a MinIO URL
+	S3_REGION     string
+	S3_BUCKET     string
+	S3_ACCESS_KEY string
+	S3_SECRET_KEY string
+	S3_PATH_STYLE bool // Bucket in the path rather than the host name, required by most S3 compatible servers
+
+	URL_SECRET string        // Signs the download URLs of the local backend, defaults to a key derived from $JWT_SECRET
+	URL_TTL    time.Duration // How long download URLs stay valid
+
+	MAX_UPLOAD_SIZE int64         // Largest attachment accepted, in bytes
+	GRACE_PERIOD    time.Duration // How long unreferenced files are kept before they are deleted
+	PURGE_INTERVAL  time.Duration // How often unreferenced files are deleted
+}
+
+// Loads the storage settings from `$STORAGE_*` variables
+func loadStorageConfig(jwtSecret string) StorageConfig {
+	config := StorageConfig{
+		BACKEND:        os.Getenv("STORAGE_BACKEND"),
+		DIR:            os.Getenv("STORAGE_DIR"),
+		S3_ENDPOINT:    os.Getenv("STORAGE_S3_ENDPOINT"),
+		S3_REGION:      os.Getenv("STORAGE_S3_REGION"),
+		S3_BUCKET:      os.Getenv("STORAGE_S3_BUCKET"),
+		S3_ACCESS_KEY:  os.Getenv("STORAGE_S3_ACCESS_KEY"),
+		S3_SECRET_KEY:  os.Getenv("STORAGE_S3_SECRET_KEY"),
+		S3_PATH_STYLE:  os.Getenv("STORAGE_S3_PATH_STYLE") == "true",
+		URL_SECRET:     os.Getenv("STORAGE_URL_SECRET"),
+		URL_TTL:        loadDuration("STORAGE_URL_TTL", defaultStorageURLTTL),
+		GRACE_PERIOD:   loadDuration("STORAGE_GRACE_PERIOD", defaultBlobGracePeriod),
+		PURGE_INTERVAL: loadDuration("STORAGE_PURGE_INTERVAL", defaultBlobPurgeInterval),
+	}
+
+	if config.BACKEND == "" {
+		config.BACKEND = "local"
+	}
+	if config.DIR == "" {
+		config.DIR = filepath.Join(os.TempDir(), defaultStorageLocalPath)
+	}
+	if config.S3_REGION == "" {
+		config.S3_REGION = defaultStorageS3Region
+	}
+	if config.URL_SECRET == "" {
+		// A URL signature must never verify as a token, so the JWT secret is not used as is
+		config.URL_SECRET = deriveSecret(jwtSecret, "storage-url-secret")
+
+		if config.BACKEND == "local" {
+			log.Warn().Msg("$STORAGE_URL_SECRET is not set, deriving it from $JWT_SECRET")
+		}
+	}
+
+	config.MAX_UPLOAD_SIZE = defaultMaxUploadSize
+	if raw := os.Getenv("STORAGE_MAX_UPLOAD_SIZE"); raw != "" {
+		size, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || size <= 0 {
+			log.Warn().Err(err).Msgf("Invalid $STORAGE_MAX_UPLOAD_SIZE, using %d", config.MAX_UPLOAD_SIZE)
+		} else {
+			config.MAX_UPLOAD_SIZE = size
+		}
+	}
+
+	return config
+}
+
+// Returns a hex encoded key for `purpose` derived from the secret with HKDF-SHA256
+func deriveSecret(secret string, purpose string) string {
+	key := make([]byte, 32)
+
+	// Only fails when reading more than 255 hashes
+	_, _ = io.ReadFull(hkdf.New(sha256.New, []byte(secret), nil, []byte(purpose)), key)
+
+	return hex.EncodeToString(key)
+}
@@ -0,0 +1,20 @@
+package env
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStorageURLSecret(t *testing.T) {
+	t.Setenv("STORAGE_URL_SECRET", "")
+
+	derived := loadStorageConfig("jwt-secret").URL_SECRET
+	assert.NotEqual(t, "jwt-secret", derived)
+	assert.Len(t, derived, 64)
+	assert.Equal(t, derived, loadStorageConfig("jwt-secret").URL_SECRET)
+	assert.NotEqual(t, derived, loadStorageConfig("other-secret").URL_SECRET)
+
+	t.Setenv("STORAGE_URL_SECRET", "url-secret")
+	assert.Equal(t, "url-secret", loadStorageConfig("jwt-secret").URL_SECRET)
+}
@@ -0,0 +1,76 @@
+// Local identity provider for testing sign ins through `federation.Provider`
+package federationtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	ClientID     = "client-id"
+	ClientSecret = "client-secret"
+	Code         = "valid-code"
+	AccessToken  = "provider-access-token"
+)
+
+// Identity provider issuing `AccessToken` for `Code` and the PKCE `Verifier`,
+// and serving `Userinfo` and `Emails` for it
+type IdP struct {
+	*httptest.Server
+
+	Verifier string
+	Userinfo map[string]interface{}
+	Emails   []map[string]interface{}
+}
+
+// Starts an identity provider, closed when the test finishes
+func NewIdP(t *testing.T, verifier string, userinfo map[string]interface{}, emails []map[string]interface{}) *IdP {
+	idp := &IdP{Verifier: verifier, Userinfo: userinfo, Emails: emails}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.PostForm.Get("code") != Code ||
+			r.PostForm.Get("client_id") != ClientID ||
+			r.PostForm.Get("client_secret") != ClientSecret ||
+			r.PostForm.Get("code_verifier") != idp.Verifier {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"access_token": AccessToken, "token_type": "bearer"})
+	})
+
+	authorized := func(next func(w http.ResponseWriter)) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer "+AccessToken {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			next(w)
+		}
+	}
+
+	mux.HandleFunc("/userinfo", authorized(func(w http.ResponseWriter) {
+		json.NewEncoder(w).Encode(idp.Userinfo)
+	}))
+
+	mux.HandleFunc("/emails", authorized(func(w http.ResponseWriter) {
+		json.NewEncoder(w).Encode(idp.Emails)
+	}))
+
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Server.Close)
+
+	return idp
+}
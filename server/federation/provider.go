@@ -0,0 +1,276 @@
+// Generic OAuth2/OIDC client used to sign users in with external identity providers
+package federation
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"server/env"
+)
+
+const httpTimeout = 10 * time.Second
+
+// Built-in endpoints for well-known providers, overridable through `env.OAuthProvider`
+var presets = map[string]env.OAuthProvider{
+	"google": {
+		AUTH_URL:     "https://accounts.google.com/o/oauth2/v2/auth",
+		TOKEN_URL:    "https://oauth2.googleapis.com/token",
+		USERINFO_URL: "https://openidconnect.googleapis.com/v1/userinfo",
+		SCOPES:       []string{"openid", "email", "profile"},
+	},
+	"github": {
+		AUTH_URL:     "https://github.com/login/oauth/authorize",
+		TOKEN_URL:    "https://github.com/login/oauth/access_token",
+		USERINFO_URL: "https://api.github.com/user",
+		EMAILS_URL:   "https://api.github.com/user/emails",
+		SCOPES:       []string{"read:user", "user:email"},
+	},
+	"gitlab": {
+		AUTH_URL:     "https://gitlab.com/oauth/authorize",
+		TOKEN_URL:    "https://gitlab.com/oauth/token",
+		USERINFO_URL: "https://gitlab.com/oauth/userinfo",
+		SCOPES:       []string{"openid", "email", "profile"},
+	},
+}
+
+// An external identity provider
+type Provider struct {
+	Name   string
+	Config env.OAuthProvider
+	Client *http.Client
+}
+
+// The identity asserted by a provider for the signed in user
+type Identity struct {
+	Provider      string `json:"provider"`
+	Subject       string `json:"subject"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+}
+
+// Returns a provider with its config merged over the built-in preset, if any
+func NewProvider(name string, config env.OAuthProvider) (*Provider, error) {
+	preset := presets[name]
+
+	if config.AUTH_URL == "" {
+		config.AUTH_URL = preset.AUTH_URL
+	}
+	if config.TOKEN_URL == "" {
+		config.TOKEN_URL = preset.TOKEN_URL
+	}
+	if config.USERINFO_URL == "" {
+		config.USERINFO_URL = preset.USERINFO_URL
+	}
+	if config.EMAILS_URL == "" {
+		config.EMAILS_URL = preset.EMAILS_URL
+	}
+	if len(config.SCOPES) == 0 {
+		config.SCOPES = preset.SCOPES
+	}
+
+	if config.CLIENT_ID == "" || config.REDIRECT_URL == "" || config.AUTH_URL == "" || config.TOKEN_URL == "" || config.USERINFO_URL == "" {
+		return nil, fmt.Errorf("oauth provider %q is missing its client id, redirect url or endpoints", name)
+	}
+
+	return &Provider{
+		Name:   name,
+		Config: config,
+		Client: &http.Client{Timeout: httpTimeout},
+	}, nil
+}
+
+// Returns the providers configured in `env.Config`
+func NewProviders(configs map[string]env.OAuthProvider) (map[string]*Provider, error) {
+	providers := map[string]*Provider{}
+
+	for name, config := range configs {
+		provider, err := NewProvider(name, config)
+		if err != nil {
+			return nil, err
+		}
+
+		providers[name] = provider
+	}
+
+	return providers, nil
+}
+
+// Returns the PKCE S256 challenge for the verifier
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Returns the URL the user is redirected to in order to sign in at the provider
+func (p *Provider) AuthCodeURL(state string, codeVerifier string) string {
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.Config.CLIENT_ID)
+	params.Set("redirect_uri", p.Config.REDIRECT_URL)
+	params.Set("scope", strings.Join(p.Config.SCOPES, " "))
+	params.Set("state", state)
+	params.Set("code_challenge", CodeChallenge(codeVerifier))
+	params.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(p.Config.AUTH_URL, "?") {
+		separator = "&"
+	}
+
+	return p.Config.AUTH_URL + separator + params.Encode()
+}
+
+// Exchanges an authorization code for the provider's access token
+func (p *Provider) Exchange(ctx context.Context, code string, codeVerifier string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.Config.REDIRECT_URL)
+	form.Set("client_id", p.Config.CLIENT_ID)
+	form.Set("client_secret", p.Config.CLIENT_SECRET)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.Config.TOKEN_URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var token struct {
+		AccessToken      string `json:"access_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+
+	status, err := p.doJSON(req, &token)
+	if err != nil {
+		return "", err
+	}
+
+	if token.Error != "" {
+		return "", fmt.Errorf("token exchange failed: %s %s", token.Error, token.ErrorDescription)
+	}
+
+	if status != http.StatusOK || token.AccessToken == "" {
+		return "", fmt.Errorf("token exchange failed with status %d", status)
+	}
+
+	return token.AccessToken, nil
+}
+
+// Fetches the identity of the user the access token was issued to
+func (p *Provider) FetchIdentity(ctx context.Context, accessToken string) (*Identity, error) {
+	var claims map[string]interface{}
+
+	err := p.get(ctx, p.Config.USERINFO_URL, accessToken, &claims)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{
+		Provider:      p.Name,
+		Subject:       claimString(claims, "sub", "id"),
+		Email:         claimString(claims, "email"),
+		Name:          claimString(claims, "name", "login", "preferred_username"),
+		EmailVerified: claims["email_verified"] == true,
+	}
+
+	if identity.Subject == "" {
+		return nil, errors.New("provider did not return a subject")
+	}
+
+	// Providers such as GitHub only list verified emails on a separate endpoint
+	if p.Config.EMAILS_URL != "" {
+		var emails []struct {
+			Email    string `json:"email"`
+			Primary  bool   `json:"primary"`
+			Verified bool   `json:"verified"`
+		}
+
+		err := p.get(ctx, p.Config.EMAILS_URL, accessToken, &emails)
+		if err != nil {
+			return nil, err
+		}
+
+		identity.Email, identity.EmailVerified = "", false
+
+		for _, email := range emails {
+			if email.Primary && email.Verified {
+				identity.Email, identity.EmailVerified = email.Email, true
+			}
+		}
+	}
+
+	return identity, nil
+}
+
+func (p *Provider) get(ctx context.Context, endpoint string, accessToken string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	status, err := p.doJSON(req, out)
+	if err != nil {
+		return err
+	}
+
+	if status != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", endpoint, status)
+	}
+
+	return nil
+}
+
+func (p *Provider) doJSON(req *http.Request, out interface{}) (int, error) {
+	res, err := p.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return res.StatusCode, err
+	}
+
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, out); err != nil && res.StatusCode == http.StatusOK {
+			return res.StatusCode, err
+		}
+	}
+
+	return res.StatusCode, nil
+}
+
+// Returns the first of the keys present in claims, formatted as a string
+func claimString(claims map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		switch value := claims[key].(type) {
+		case string:
+			if value != "" {
+				return value
+			}
+		case float64:
+			return fmt.Sprintf("%.0f", value)
+		}
+	}
+
+	return ""
+}
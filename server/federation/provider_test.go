@@ -0,0 +1,126 @@
+package federation
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"server/env"
+	"server/federation/federationtest"
+)
+
+func newTestProvider(t *testing.T, name string, idp *federationtest.IdP, emails bool) *Provider {
+	config := env.OAuthProvider{
+		CLIENT_ID:     federationtest.ClientID,
+		CLIENT_SECRET: federationtest.ClientSecret,
+		REDIRECT_URL:  "http://localhost:5000/oauth/external/" + name + "/callback",
+		AUTH_URL:      idp.URL + "/authorize",
+		TOKEN_URL:     idp.URL + "/token",
+		USERINFO_URL:  idp.URL + "/userinfo",
+	}
+
+	if emails {
+		config.EMAILS_URL = idp.URL + "/emails"
+	}
+
+	provider, err := NewProvider(name, config)
+	if err != nil {
+		t.Fatalf("Error creating provider: %s", err)
+	}
+
+	return provider
+}
+
+func TestNewProvider(t *testing.T) {
+	provider, err := NewProvider("google", env.OAuthProvider{CLIENT_ID: federationtest.ClientID, REDIRECT_URL: "http://localhost/callback"})
+	assert.NoError(t, err)
+	assert.Equal(t, presets["google"].TOKEN_URL, provider.Config.TOKEN_URL)
+	assert.Equal(t, []string{"openid", "email", "profile"}, provider.Config.SCOPES)
+
+	_, err = NewProvider("custom", env.OAuthProvider{CLIENT_ID: federationtest.ClientID, REDIRECT_URL: "http://localhost/callback"})
+	assert.Error(t, err)
+
+	_, err = NewProvider("github", env.OAuthProvider{REDIRECT_URL: "http://localhost/callback"})
+	assert.Error(t, err)
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	idp := federationtest.NewIdP(t, "", nil, nil)
+	provider := newTestProvider(t, "custom", idp, false)
+	provider.Config.SCOPES = []string{"openid", "email"}
+
+	authURL, err := url.Parse(provider.AuthCodeURL("the-state", "the-verifier"))
+	assert.NoError(t, err)
+
+	params := authURL.Query()
+	assert.Equal(t, "/authorize", authURL.Path)
+	assert.Equal(t, "code", params.Get("response_type"))
+	assert.Equal(t, federationtest.ClientID, params.Get("client_id"))
+	assert.Equal(t, provider.Config.REDIRECT_URL, params.Get("redirect_uri"))
+	assert.Equal(t, "openid email", params.Get("scope"))
+	assert.Equal(t, "the-state", params.Get("state"))
+	assert.Equal(t, CodeChallenge("the-verifier"), params.Get("code_challenge"))
+	assert.Equal(t, "S256", params.Get("code_challenge_method"))
+}
+
+func TestOIDCLogin(t *testing.T) {
+	idp := federationtest.NewIdP(t, "the-verifier", map[string]interface{}{
+		"sub":            "10769150350006150715113082367",
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"name":           "Alice",
+	}, nil)
+	provider := newTestProvider(t, "google", idp, false)
+
+	accessToken, err := provider.Exchange(context.Background(), federationtest.Code, "the-verifier")
+	assert.NoError(t, err)
+	assert.Equal(t, federationtest.AccessToken, accessToken)
+
+	identity, err := provider.FetchIdentity(context.Background(), accessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, &Identity{
+		Provider:      "google",
+		Subject:       "10769150350006150715113082367",
+		Email:         "alice@example.com",
+		EmailVerified: true,
+		Name:          "Alice",
+	}, identity)
+}
+
+func TestOAuth2LoginWithEmailsEndpoint(t *testing.T) {
+	idp := federationtest.NewIdP(t, "the-verifier", map[string]interface{}{
+		"id":    583231,
+		"login": "octocat",
+		"email": "public@example.com",
+	}, []map[string]interface{}{
+		{"email": "unverified@example.com", "primary": false, "verified": false},
+		{"email": "octocat@example.com", "primary": true, "verified": true},
+	})
+	provider := newTestProvider(t, "github", idp, true)
+
+	accessToken, err := provider.Exchange(context.Background(), federationtest.Code, "the-verifier")
+	assert.NoError(t, err)
+
+	identity, err := provider.FetchIdentity(context.Background(), accessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, "583231", identity.Subject)
+	assert.Equal(t, "octocat", identity.Name)
+	assert.Equal(t, "octocat@example.com", identity.Email)
+	assert.True(t, identity.EmailVerified)
+}
+
+func TestExchangeRejected(t *testing.T) {
+	idp := federationtest.NewIdP(t, "the-verifier", nil, nil)
+	provider := newTestProvider(t, "gitlab", idp, false)
+
+	_, err := provider.Exchange(context.Background(), "stolen-code", "the-verifier")
+	assert.ErrorContains(t, err, "invalid_grant")
+
+	_, err = provider.Exchange(context.Background(), federationtest.Code, "wrong-verifier")
+	assert.ErrorContains(t, err, "invalid_grant")
+
+	_, err = provider.FetchIdentity(context.Background(), "forged-token")
+	assert.Error(t, err)
+}
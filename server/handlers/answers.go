@@ -0,0 +1,351 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/rs/zerolog/log"
+
+	"server/authorization"
+	"server/helpers"
+	"server/models"
+)
+
+var answer models.Answer
+
+// Returns the answer named in the URL, writing an error unless it answers the question and is visible to the caller
+func findURLAnswer(w http.ResponseWriter, r *http.Request, questionID uuid.UUID) (*models.Answer, bool) {
+	id, err := uuid.FromString(chi.URLParam(r, "answerID"))
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Invalid answer ID"), http.StatusBadRequest)
+		return nil, false
+	}
+
+	found, err := answer.FindByID(id)
+	if err != nil || found.QuestionID != questionID || !canSee(r, found.Status, found.UserID) {
+		helpers.ErrorJSON(w, errors.New("No answer found"), http.StatusNotFound)
+		return nil, false
+	}
+
+	return found, true
+}
+
+// Get Answers
+//
+//	@Summary      Get the Answers to a Question
+//	@Description  Get a page of the Answers to a Question. Pages are linked by `next_cursor` and the `Link` header.
+//	@Tags         answers
+//	@Produce      json
+//	@Param id path string true "Question ID"
+//	@Param limit query int false "Page size, 1-100" default(20)
+//	@Param cursor query string false "Cursor returned as next_cursor"
+//	@Param sort query string false "score or created_at, prefixed with - for descending order" default(-score)
+//	@Router       /api/v1/questions/{id}/answers [get]
+//	@Success 200 {object} types.Page{data=[]models.Answer}
+//	@Failure 400 {object} string
+//	@Failure 404 {object} string
+func GetAnswers(w http.ResponseWriter, r *http.Request) {
+	params := models.AnswerListParams{Sort: r.URL.Query().Get("sort")}
+
+	if params.Sort != "" && !models.ValidAnswerSort(params.Sort) {
+		helpers.ErrorJSON(w, errors.New("sort must be one of score or created_at, optionally prefixed with -"), http.StatusBadRequest)
+		return
+	}
+
+	limit, err := helpers.ParseLimit(r, models.MaxPageLimit)
+	if err != nil {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+	params.Limit = limit
+
+	if raw := r.URL.Query().Get("cursor"); raw != "" {
+		params.Cursor, err = models.DecodeCursor(raw)
+		if err != nil {
+			helpers.ErrorJSON(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	found, ok := findURLQuestion(w, r)
+	if !ok {
+		return
+	}
+	params.QuestionID = found.ID
+
+	answers, next, err := answer.List(params)
+
+	if errors.Is(err, models.ErrInvalidCursor) {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error getting answers")
+		helpers.ErrorJSON(w, errors.New("No answers found"), http.StatusInternalServerError)
+		return
+	}
+
+	var cursor string
+	if next != nil {
+		cursor = next.Encode()
+	}
+
+	helpers.WritePage(w, r, answers, cursor)
+}
+
+// Get Answer
+//
+//	@Summary      Get Answer
+//	@Description  Get an Answer to a Question by ID
+//	@Tags         answers
+//	@Produce      json
+//	@Param id path string true "Question ID"
+//	@Param answerID path string true "Answer ID"
+//	@Router       /api/v1/questions/{id}/answers/{answerID} [get]
+//	@Success 200 {object} models.Answer
+//	@Failure 400 {object} string
+//	@Failure 404 {object} string
+func GetAnswer(w http.ResponseWriter, r *http.Request) {
+	found, ok := findURLQuestion(w, r)
+	if !ok {
+		return
+	}
+
+	foundAnswer, ok := findURLAnswer(w, r, found.ID)
+	if !ok {
+		return
+	}
+
+	_ = helpers.WriteJSON(w, http.StatusOK, foundAnswer)
+}
+
+// Create Answer
+//
+//	@Summary      Create Answer
+//	@Description  Answer a Question as the authenticated User
+//	@Tags         answers
+//	@Accept       json
+//	@Produce      json
+//	@Param id path string true "Question ID"
+//	@Param answer body models.AnswerInput true "Answer"
+//	@Security     BearerAuth
+//	@Router       /api/v1/questions/{id}/answers [post]
+//	@Success 201 {object} models.Answer
+//	@Failure 400 {object} string
+//	@Failure 401 {object} string
+//	@Failure 404 {object} string
+func CreateAnswer(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authorization.FromContext(r.Context())
+	if !ok || principal.UserID == uuid.Nil {
+		helpers.ErrorJSON(w, errors.New("Unauthorized"), http.StatusUnauthorized)
+		return
+	}
+
+	found, ok := findURLQuestion(w, r)
+	if !ok {
+		return
+	}
+
+	var input models.AnswerInput
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Invalid JSON"), http.StatusBadRequest)
+		return
+	}
+
+	err = helpers.ValidateStruct(input)
+	if err != nil {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	created, err := answer.Create(input.ToAnswer(found.ID, principal.UserID))
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Error creating answer"), http.StatusInternalServerError)
+		return
+	}
+
+	_ = helpers.WriteJSON(w, http.StatusCreated, created)
+}
+
+// Returns the answer named in the URL if the principal may modify it, writing an error otherwise
+func findModifiableAnswer(w http.ResponseWriter, r *http.Request) (*models.Answer, bool) {
+	principal, ok := authorization.FromContext(r.Context())
+	if !ok {
+		helpers.ErrorJSON(w, errors.New("Unauthorized"), http.StatusUnauthorized)
+		return nil, false
+	}
+
+	found, ok := findURLQuestion(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	foundAnswer, ok := findURLAnswer(w, r, found.ID)
+	if !ok {
+		return nil, false
+	}
+
+	if !principal.CanModify(foundAnswer.UserID) {
+		helpers.ErrorJSON(w, errors.New("You can only modify your own answers"), http.StatusForbidden)
+		return nil, false
+	}
+
+	return foundAnswer, true
+}
+
+// Update Answer
+//
+//	@Summary      Update Answer
+//	@Description  Update an Answer, only its author or an admin may
+//	@Tags         answers
+//	@Accept       json
+//	@Produce      json
+//	@Param id path string true "Question ID"
+//	@Param answerID path string true "Answer ID"
+//	@Param answer body models.AnswerInput true "Answer"
+//	@Security     BearerAuth
+//	@Router       /api/v1/questions/{id}/answers/{answerID} [put]
+//	@Success 200 {object} models.Answer
+//	@Failure 400 {object} string
+//	@Failure 401 {object} string
+//	@Failure 403 {object} string
+//	@Failure 404 {object} string
+func UpdateAnswer(w http.ResponseWriter, r *http.Request) {
+	found, ok := findModifiableAnswer(w, r)
+	if !ok {
+		return
+	}
+
+	var input models.AnswerInput
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Invalid JSON"), http.StatusBadRequest)
+		return
+	}
+
+	err = helpers.ValidateStruct(input)
+	if err != nil {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	updated, err := answer.Update(found.ID, input.ToAnswer(found.QuestionID, found.UserID))
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Error updating answer"), http.StatusInternalServerError)
+		return
+	}
+
+	_ = helpers.WriteJSON(w, http.StatusOK, updated)
+}
+
+// Delete Answer
+//
+//	@Summary      Delete Answer
+//	@Description  Delete an Answer, only its author or an admin may
+//	@Tags         answers
+//	@Param id path string true "Question ID"
+//	@Param answerID path string true "Answer ID"
+//	@Security     BearerAuth
+//	@Router       /api/v1/questions/{id}/answers/{answerID} [delete]
+//	@Success 204
+//	@Failure 401 {object} string
+//	@Failure 403 {object} string
+//	@Failure 404 {object} string
+func DeleteAnswer(w http.ResponseWriter, r *http.Request) {
+	found, ok := findModifiableAnswer(w, r)
+	if !ok {
+		return
+	}
+
+	err := answer.DeleteByID(found.ID)
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Error deleting answer"), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Accept Answer
+//
+//	@Summary      Accept Answer
+//	@Description  Mark an Answer as the accepted one, only the author of the Question may. Replaces the previously accepted Answer.
+//	@Tags         answers
+//	@Produce      json
+//	@Param id path string true "Question ID"
+//	@Param answerID path string true "Answer ID"
+//	@Security     BearerAuth
+//	@Router       /api/v1/questions/{id}/answers/{answerID}/accept [put]
+//	@Success 200 {object} models.Question
+//	@Failure 401 {object} string
+//	@Failure 403 {object} string
+//	@Failure 404 {object} string
+func AcceptAnswer(w http.ResponseWriter, r *http.Request) {
+	setAcceptedAnswer(w, r, true)
+}
+
+// Unaccept Answer
+//
+//	@Summary      Unaccept Answer
+//	@Description  Clear the accepted Answer of a Question, only the author of the Question may
+//	@Tags         answers
+//	@Produce      json
+//	@Param id path string true "Question ID"
+//	@Param answerID path string true "Answer ID"
+//	@Security     BearerAuth
+//	@Router       /api/v1/questions/{id}/answers/{answerID}/accept [delete]
+//	@Success 200 {object} models.Question
+//	@Failure 401 {object} string
+//	@Failure 403 {object} string
+//	@Failure 404 {object} string
+func UnacceptAnswer(w http.ResponseWriter, r *http.Request) {
+	setAcceptedAnswer(w, r, false)
+}
+
+// Accepting is the asker's call, admins included can't do it on their behalf
+func setAcceptedAnswer(w http.ResponseWriter, r *http.Request, accept bool) {
+	principal, ok := authorization.FromContext(r.Context())
+	if !ok {
+		helpers.ErrorJSON(w, errors.New("Unauthorized"), http.StatusUnauthorized)
+		return
+	}
+
+	found, ok := findURLQuestion(w, r)
+	if !ok {
+		return
+	}
+
+	foundAnswer, ok := findURLAnswer(w, r, found.ID)
+	if !ok {
+		return
+	}
+
+	if principal.UserID == uuid.Nil || principal.UserID != found.UserID {
+		helpers.ErrorJSON(w, errors.New("Only the author of the question can accept an answer"), http.StatusForbidden)
+		return
+	}
+
+	var acceptedID *uuid.UUID
+	if accept {
+		acceptedID = &foundAnswer.ID
+	} else if found.AcceptedAnswerID == nil || *found.AcceptedAnswerID != foundAnswer.ID {
+		// Already not accepted, nothing to clear
+		_ = helpers.WriteJSON(w, http.StatusOK, found)
+		return
+	}
+
+	updated, err := question.SetAcceptedAnswer(found.ID, acceptedID)
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Error accepting answer"), http.StatusInternalServerError)
+		return
+	}
+	updated.Tags = found.Tags
+
+	_ = helpers.WriteJSON(w, http.StatusOK, updated)
+}
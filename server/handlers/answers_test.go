@@ -0,0 +1,154 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"server/authorization"
+	"server/models"
+)
+
+const testAnswerID = "c3d2e1f0-7a6b-4c5d-8e9f-0a1b2c3d4e5f"
+
+func answerRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "question_id", "user_id", "body", "score", "created_at", "updated_at", "status"})
+}
+
+func answerRow(questionID string, authorID string) *sqlmock.Rows {
+	now := time.Now()
+
+	return answerRows().AddRow(testAnswerID, questionID, authorID, "A language", 0, now, now, "published")
+}
+
+func TestCreateAnswerUsesPrincipal(t *testing.T) {
+	otherUserID := "7a1d2c3b-4e5f-4a6b-8c7d-9e0f1a2b3c4d"
+
+	mock := setupUserTest(t)
+	mock.ExpectQuery("SELECT (.+) FROM questions WHERE id").WithArgs(testQuestionID).WillReturnRows(questionRow(otherUserID))
+	expectQuestionTags(mock)
+	mock.ExpectQuery("INSERT INTO answers").
+		WithArgs(testQuestionID, testUserID, "A language", sqlmock.AnyArg()).
+		WillReturnRows(answerRow(testQuestionID, testUserID))
+
+	rec := httptest.NewRecorder()
+	testRouter().ServeHTTP(rec, asTestUser(t, httptest.NewRequest(http.MethodPost, "/api/v1/questions/"+testQuestionID+"/answers",
+		strings.NewReader(`{"body": "A language", "user_id": "`+otherUserID+`"}`))))
+
+	assert.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	assert.Contains(t, rec.Body.String(), testAnswerID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateAnswerOfAnotherQuestion(t *testing.T) {
+	mock := setupUserTest(t)
+	mock.ExpectQuery("SELECT (.+) FROM questions WHERE id").WithArgs(testQuestionID).WillReturnRows(questionRow(testUserID))
+	expectQuestionTags(mock)
+	mock.ExpectQuery("SELECT (.+) FROM answers WHERE id").WithArgs(testAnswerID).
+		WillReturnRows(answerRow("11111111-2222-4333-8444-555555555555", testUserID))
+
+	rec := httptest.NewRecorder()
+	testRouter().ServeHTTP(rec, asTestUser(t, httptest.NewRequest(http.MethodPut, "/api/v1/questions/"+testQuestionID+"/answers/"+testAnswerID,
+		strings.NewReader(`{"body": "Edited"}`))))
+
+	assert.Equal(t, http.StatusNotFound, rec.Code, rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAcceptAnswer(t *testing.T) {
+	otherUserID := "7a1d2c3b-4e5f-4a6b-8c7d-9e0f1a2b3c4d"
+
+	asker := &authorization.Principal{UserID: uuid.FromStringOrNil(testUserID)}
+	answerer := &authorization.Principal{UserID: uuid.FromStringOrNil(otherUserID)}
+	admin := &authorization.Principal{UserID: uuid.FromStringOrNil(otherUserID), Roles: []string{authorization.RoleAdmin}}
+
+	tests := []struct {
+		name      string
+		method    string
+		principal *authorization.Principal
+		status    int
+	}{
+		{name: "asker accepts", method: http.MethodPut, principal: asker, status: http.StatusOK},
+		{name: "answerer accepts", method: http.MethodPut, principal: answerer, status: http.StatusForbidden},
+		{name: "admin accepts", method: http.MethodPut, principal: admin, status: http.StatusForbidden},
+		{name: "asker unaccepts", method: http.MethodDelete, principal: asker, status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			accepted := sqlmock.NewRows([]string{"id", "question", "created_at", "updated_at", "user_id", "score", "accepted_answer_id", "status"}).
+				AddRow(testQuestionID, "What is Go?", now, now, testUserID, 0, testAnswerID, "published")
+
+			mock := setupUserTest(t)
+
+			if tt.method == http.MethodPut {
+				mock.ExpectQuery("SELECT (.+) FROM questions WHERE id").WithArgs(testQuestionID).WillReturnRows(questionRow(testUserID))
+				expectQuestionTags(mock)
+			} else {
+				mock.ExpectQuery("SELECT (.+) FROM questions WHERE id").WithArgs(testQuestionID).WillReturnRows(accepted)
+				expectQuestionTags(mock)
+			}
+			mock.ExpectQuery("SELECT (.+) FROM answers WHERE id").WithArgs(testAnswerID).WillReturnRows(answerRow(testQuestionID, otherUserID))
+
+			if tt.status == http.StatusOK && tt.method == http.MethodPut {
+				mock.ExpectQuery("UPDATE questions SET accepted_answer_id").WithArgs(testAnswerID, testQuestionID).WillReturnRows(accepted)
+			}
+			if tt.status == http.StatusOK && tt.method == http.MethodDelete {
+				mock.ExpectQuery("UPDATE questions SET accepted_answer_id").WithArgs(nil, testQuestionID).WillReturnRows(questionRow(testUserID))
+			}
+
+			rec := httptest.NewRecorder()
+			testRouter().ServeHTTP(rec, asPrincipal(t, httptest.NewRequest(tt.method, "/api/v1/questions/"+testQuestionID+"/answers/"+testAnswerID+"/accept", nil), tt.principal))
+
+			assert.Equal(t, tt.status, rec.Code, rec.Body.String())
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGetAnswersSortedByScore(t *testing.T) {
+	mock := setupUserTest(t)
+
+	now := time.Now()
+	rows := answerRows()
+	for i, score := range []int{5, 3, 3} {
+		rows.AddRow(uuid.Must(uuid.NewV4()), testQuestionID, testUserID, "Answer", score, now.Add(time.Duration(i)*time.Minute), now, "published")
+	}
+
+	mock.ExpectQuery("SELECT (.+) FROM questions WHERE id").WithArgs(testQuestionID).WillReturnRows(questionRow(testUserID))
+	expectQuestionTags(mock)
+	mock.ExpectQuery(`SELECT (.+) FROM answers WHERE question_id = \$1 AND status = \$2 ORDER BY score DESC, id DESC LIMIT \$3`).
+		WithArgs(testQuestionID, "published", 3).
+		WillReturnRows(rows)
+
+	rec := httptest.NewRecorder()
+	testRouter().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/questions/"+testQuestionID+"/answers?limit=2", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	var page struct {
+		Data       []models.Answer `json:"data"`
+		NextCursor string          `json:"next_cursor"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	assert.Len(t, page.Data, 2)
+
+	cursor, err := models.DecodeCursor(page.NextCursor)
+	assert.NoError(t, err)
+	assert.Equal(t, "-score", cursor.Sort)
+	assert.Equal(t, "3", cursor.Value)
+
+	rec = httptest.NewRecorder()
+	testRouter().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/questions/"+testQuestionID+"/answers?sort=votes", nil))
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
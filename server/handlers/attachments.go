@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/rs/zerolog/log"
+
+	"server/authorization"
+	"server/env"
+	"server/helpers"
+	"server/models"
+)
+
+var attachment models.Attachment
+
+// Upload Attachment
+//
+//	@Summary      Upload Attachment
+//	@Description  Attach a file to a Question, only its owner or an admin may. Images, PDF and plain text are accepted, up to `STORAGE_MAX_UPLOAD_SIZE` bytes and 10 files per Question.
+//	@Tags         attachments
+//	@Accept       multipart/form-data
+//	@Produce      json
+//	@Param id path string true "Question ID"
+//	@Param file formData file true "File"
+//	@Security     BearerAuth
+//	@Router       /api/v1/questions/{id}/attachments [post]
+//	@Success 201 {object} models.Attachment
+//	@Failure 400 {object} string
+//	@Failure 401 {object} string
+//	@Failure 403 {object} string
+//	@Failure 404 {object} string
+//	@Failure 409 {object} string
+//	@Failure 413 {object} string
+//	@Failure 415 {object} string
+func UploadAttachment(w http.ResponseWriter, r *http.Request) {
+	found, ok := findModifiableQuestion(w, r)
+	if !ok {
+		return
+	}
+
+	up, ok := readUpload(w, r, env.DefaultConfig.STORAGE.MAX_UPLOAD_SIZE, attachmentTypes)
+	if !ok {
+		return
+	}
+
+	defer up.Close()
+
+	if err := storeUpload(r, up); err != nil {
+		log.Error().Err(err).Msg("Error storing attachment")
+		helpers.ErrorJSON(w, errors.New("Error storing the file"), http.StatusInternalServerError)
+		return
+	}
+
+	principal, _ := authorization.FromContext(r.Context())
+
+	created, err := attachment.Create(models.Attachment{QuestionID: found.ID, UserID: &principal.UserID, Filename: up.Filename, Blob: up.Blob})
+
+	if errors.Is(err, models.ErrTooManyAttachments) {
+		helpers.ErrorJSON(w, err, http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Error creating attachment"), http.StatusInternalServerError)
+		return
+	}
+
+	if err := signBlob(r, &created.Blob); err != nil {
+		log.Error().Err(err).Msg("Error signing attachment URL")
+	}
+
+	_ = helpers.WriteJSON(w, http.StatusCreated, created)
+}
+
+// Get Attachments
+//
+//	@Summary      Get Attachments
+//	@Description  Get the files attached to a Question, oldest first, with download URLs that expire after `STORAGE_URL_TTL`
+//	@Tags         attachments
+//	@Produce      json
+//	@Param id path string true "Question ID"
+//	@Router       /api/v1/questions/{id}/attachments [get]
+//	@Success 200 {object} []models.Attachment
+//	@Failure 404 {object} string
+//	@Failure 500 {object} string
+func GetAttachments(w http.ResponseWriter, r *http.Request) {
+	found, ok := findURLQuestion(w, r)
+	if !ok {
+		return
+	}
+
+	attachments, err := attachment.FindByQuestionID(found.ID)
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Error getting attachments"), http.StatusInternalServerError)
+		return
+	}
+
+	for _, a := range attachments {
+		if err := signBlob(r, &a.Blob); err != nil {
+			log.Error().Err(err).Msg("Error signing attachment URL")
+			helpers.ErrorJSON(w, errors.New("Error getting attachments"), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	_ = helpers.WriteJSON(w, http.StatusOK, attachments)
+}
+
+// Delete Attachment
+//
+//	@Summary      Delete Attachment
+//	@Description  Remove a file from a Question, only its owner or an admin may
+//	@Tags         attachments
+//	@Param id path string true "Question ID"
+//	@Param attachmentID path string true "Attachment ID"
+//	@Security     BearerAuth
+//	@Router       /api/v1/questions/{id}/attachments/{attachmentID} [delete]
+//	@Success 204
+//	@Failure 400 {object} string
+//	@Failure 401 {object} string
+//	@Failure 403 {object} string
+//	@Failure 404 {object} string
+func DeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	found, ok := findModifiableQuestion(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := uuid.FromString(chi.URLParam(r, "attachmentID"))
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Invalid attachment ID"), http.StatusBadRequest)
+		return
+	}
+
+	err = attachment.Delete(found.ID, id)
+
+	if errors.Is(err, models.ErrAttachmentNotFound) {
+		helpers.ErrorJSON(w, err, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Error deleting attachment"), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
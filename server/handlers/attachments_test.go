@@ -0,0 +1,204 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"server/env"
+	"server/models"
+	"server/storage"
+)
+
+// Smallest valid PNG, a 1x1 transparent pixel
+var testPNG = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00\x1f\x15\xc4\x89" +
+	"\x00\x00\x00\rIDATx\x9cc\x00\x01\x00\x00\x05\x00\x01\r\n-\xb4\x00\x00\x00\x00IEND\xaeB`\x82")
+
+// Points the handlers at a local store in a test directory
+func setupStorageTest(t *testing.T) *storage.LocalStore {
+	store, err := storage.NewLocalStore(t.TempDir(), storage.LocalFilesPath, "secret")
+	if err != nil {
+		t.Fatalf("Error creating the local store: %s", err)
+	}
+
+	previous := storage.Store()
+	storage.SetStore(store)
+	env.DefaultConfig.STORAGE.URL_TTL = time.Minute
+	env.DefaultConfig.STORAGE.MAX_UPLOAD_SIZE = 1024
+
+	t.Cleanup(func() {
+		storage.SetStore(previous)
+		env.DefaultConfig.STORAGE = env.StorageConfig{}
+	})
+
+	return store
+}
+
+// Returns a multipart request uploading the content as `file`
+func uploadRequest(t *testing.T, method string, target string, filename string, content []byte) *http.Request {
+	var body bytes.Buffer
+
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatalf("Error creating the upload: %s", err)
+	}
+	_, _ = part.Write(content)
+	_ = writer.Close()
+
+	r := httptest.NewRequest(method, target, &body)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+
+	return r
+}
+
+// Expects the blob to be recorded before its file is stored
+func expectBlobTouch(mock sqlmock.Sqlmock, hash interface{}) {
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO blobs (.+) ON CONFLICT").WithArgs(hash, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+func TestUploadAttachment(t *testing.T) {
+	mock := setupUserTest(t)
+	store := setupStorageTest(t)
+
+	sum := sha256.Sum256(testPNG)
+	hash := hex.EncodeToString(sum[:])
+
+	mock.ExpectQuery("SELECT (.+) FROM questions WHERE id").WithArgs(testQuestionID).WillReturnRows(questionRow(testUserID))
+	expectQuestionTags(mock)
+	expectBlobTouch(mock, hash)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id FROM questions WHERE id = \\$1 FOR UPDATE").WithArgs(testQuestionID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(testQuestionID))
+	mock.ExpectQuery("SELECT COUNT").WithArgs(testQuestionID).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec("INSERT INTO blobs").WithArgs(hash, len(testPNG), "image/png", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("INSERT INTO attachments").WithArgs(testQuestionID, sqlmock.AnyArg(), hash, "pixel.png", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.Must(uuid.NewV4())))
+	mock.ExpectCommit()
+
+	// The declared name and type don't matter, the content is a PNG
+	rec := httptest.NewRecorder()
+	testRouter().ServeHTTP(rec, asTestUser(t, uploadRequest(t, http.MethodPost, "/api/v1/questions/"+testQuestionID+"/attachments", "pixel.png", testPNG)))
+
+	assert.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	var created models.Attachment
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	assert.Equal(t, hash, created.SHA256)
+	assert.NotNil(t, created.URLExpiresAt)
+
+	exists, err := store.Exists(context.Background(), storage.HashKey(hash))
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	// The signed URL downloads the file until it is tampered with
+	rec = httptest.NewRecorder()
+	testRouter().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, created.URL, nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, testPNG, rec.Body.Bytes())
+	assert.Equal(t, "image/png", rec.Header().Get("Content-Type"))
+	assert.Regexp(t, `^private, max-age=(5[0-9]|60), immutable$`, rec.Header().Get("Cache-Control"), "cached no longer than the URL is valid")
+
+	rec = httptest.NewRecorder()
+	testRouter().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, strings.Replace(created.URL, hash, strings.Repeat("0", 64), 1), nil))
+
+	assert.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+}
+
+func TestUploadAttachmentLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		code    int
+	}{
+		{name: "too large", content: bytes.Repeat([]byte("a"), 2048), code: http.StatusRequestEntityTooLarge},
+		{name: "unsupported type", content: []byte("<html><script>alert(1)</script></html>"), code: http.StatusUnsupportedMediaType},
+		{name: "empty", content: nil, code: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := setupUserTest(t)
+			store := setupStorageTest(t)
+
+			mock.ExpectQuery("SELECT (.+) FROM questions WHERE id").WithArgs(testQuestionID).WillReturnRows(questionRow(testUserID))
+			expectQuestionTags(mock)
+
+			rec := httptest.NewRecorder()
+			testRouter().ServeHTTP(rec, asTestUser(t, uploadRequest(t, http.MethodPost, "/api/v1/questions/"+testQuestionID+"/attachments", "notes.txt", tt.content)))
+
+			assert.Equal(t, tt.code, rec.Code, rec.Body.String())
+			assert.NoError(t, mock.ExpectationsWereMet())
+
+			sum := sha256.Sum256(tt.content)
+			exists, _ := store.Exists(context.Background(), storage.HashKey(hex.EncodeToString(sum[:])))
+			assert.False(t, exists, "rejected files are not stored")
+		})
+	}
+}
+
+func TestUploadAttachmentLimitPerQuestion(t *testing.T) {
+	mock := setupUserTest(t)
+	setupStorageTest(t)
+
+	mock.ExpectQuery("SELECT (.+) FROM questions WHERE id").WithArgs(testQuestionID).WillReturnRows(questionRow(testUserID))
+	expectQuestionTags(mock)
+	expectBlobTouch(mock, sqlmock.AnyArg())
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id FROM questions WHERE id = \\$1 FOR UPDATE").WithArgs(testQuestionID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(testQuestionID))
+	mock.ExpectQuery("SELECT COUNT").WithArgs(testQuestionID).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(models.MaxQuestionAttachments))
+	mock.ExpectRollback()
+
+	rec := httptest.NewRecorder()
+	testRouter().ServeHTTP(rec, asTestUser(t, uploadRequest(t, http.MethodPost, "/api/v1/questions/"+testQuestionID+"/attachments", "notes.txt", []byte("Some notes"))))
+
+	assert.Equal(t, http.StatusConflict, rec.Code, rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAvatar(t *testing.T) {
+	mock := setupUserTest(t)
+	setupStorageTest(t)
+
+	sum := sha256.Sum256(testPNG)
+	hash := hex.EncodeToString(sum[:])
+
+	expectBlobTouch(mock, hash)
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO blobs").WithArgs(hash, len(testPNG), "image/png", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE users SET avatar_sha256").WithArgs(hash, sqlmock.AnyArg(), testUserID).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery("SELECT (.+) FROM users u JOIN blobs").WithArgs(testUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"sha256", "size", "content_type"}).AddRow(hash, len(testPNG), "image/png"))
+
+	router := testRouter()
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, asTestUser(t, uploadRequest(t, http.MethodPut, "/api/v1/me/avatar", "me.png", testPNG)))
+
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/users/"+testUserID+"/avatar", nil))
+
+	assert.Equal(t, http.StatusFound, rec.Code, rec.Body.String())
+	assert.True(t, strings.HasPrefix(rec.Header().Get("Location"), storage.LocalFilesPath+"/"+storage.HashKey(hash)+"?"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/rs/zerolog/log"
+
+	"server/helpers"
+	"server/models"
+)
+
+// Largest avatar accepted, in bytes
+const maxAvatarSize = 2 << 20
+
+// Media types accepted as avatars, detected from the content
+var avatarTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// Put My Avatar
+//
+//	@Summary      Put My Avatar
+//	@Description  Replace the avatar of the authenticated User with a PNG, JPEG, GIF or WebP image of up to 2 MiB
+//	@Tags         me
+//	@Accept       multipart/form-data
+//	@Produce      json
+//	@Param file formData file true "Image"
+//	@Security     BearerAuth
+//	@Router       /api/v1/me/avatar [put]
+//	@Success 200 {object} models.Blob
+//	@Failure 400 {object} string
+//	@Failure 401 {object} string
+//	@Failure 413 {object} string
+//	@Failure 415 {object} string
+func PutMyAvatar(w http.ResponseWriter, r *http.Request) {
+	var userModel models.User
+
+	id, ok := principalID(r)
+	if !ok {
+		helpers.ErrorJSON(w, errors.New("Unauthorized"), http.StatusUnauthorized)
+		return
+	}
+
+	up, ok := readUpload(w, r, maxAvatarSize, avatarTypes)
+	if !ok {
+		return
+	}
+
+	defer up.Close()
+
+	if err := storeUpload(r, up); err != nil {
+		log.Error().Err(err).Msg("Error storing avatar")
+		helpers.ErrorJSON(w, errors.New("Error storing the file"), http.StatusInternalServerError)
+		return
+	}
+
+	avatar := up.Blob
+
+	if err := userModel.SetAvatar(id, &avatar); err != nil {
+		helpers.ErrorJSON(w, errors.New("Error setting avatar"), http.StatusInternalServerError)
+		return
+	}
+
+	if err := signBlob(r, &avatar); err != nil {
+		log.Error().Err(err).Msg("Error signing avatar URL")
+	}
+
+	_ = helpers.WriteJSON(w, http.StatusOK, avatar)
+}
+
+// Delete My Avatar
+//
+//	@Summary      Delete My Avatar
+//	@Description  Remove the avatar of the authenticated User
+//	@Tags         me
+//	@Security     BearerAuth
+//	@Router       /api/v1/me/avatar [delete]
+//	@Success 204
+//	@Failure 401 {object} string
+func DeleteMyAvatar(w http.ResponseWriter, r *http.Request) {
+	var userModel models.User
+
+	id, ok := principalID(r)
+	if !ok {
+		helpers.ErrorJSON(w, errors.New("Unauthorized"), http.StatusUnauthorized)
+		return
+	}
+
+	if err := userModel.SetAvatar(id, nil); err != nil {
+		helpers.ErrorJSON(w, errors.New("Error removing avatar"), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Get User Avatar
+//
+//	@Summary      Get User Avatar
+//	@Description  Redirect to a signed, expiring URL of the avatar of a User
+//	@Tags         users
+//	@Param id path string true "User ID"
+//	@Router       /api/v1/users/{id}/avatar [get]
+//	@Success 302
+//	@Failure 400 {object} string
+//	@Failure 404 {object} string
+func GetUserAvatar(w http.ResponseWriter, r *http.Request) {
+	var userModel models.User
+
+	id, err := uuid.FromString(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Invalid user ID"), http.StatusBadRequest)
+		return
+	}
+
+	avatar, err := userModel.FindAvatar(id)
+
+	if errors.Is(err, models.ErrNoAvatar) {
+		helpers.ErrorJSON(w, err, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Error getting avatar"), http.StatusInternalServerError)
+		return
+	}
+
+	if err := signBlob(r, avatar); err != nil {
+		log.Error().Err(err).Msg("Error signing avatar URL")
+		helpers.ErrorJSON(w, errors.New("Error getting avatar"), http.StatusInternalServerError)
+		return
+	}
+
+	// The signed URL changes on every request, it must not be cached for longer than it is valid
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, avatar.URL, http.StatusFound)
+}
@@ -0,0 +1,332 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/rs/zerolog/log"
+
+	"server/authorization"
+	"server/helpers"
+	"server/models"
+)
+
+var comment models.Comment
+
+// Returns the number of comments to embed in a question from the `comments` parameter
+func parseEmbeddedComments(r *http.Request) (int, error) {
+	raw := r.URL.Query().Get("comments")
+	if raw == "" {
+		return models.DefaultEmbeddedComments, nil
+	}
+
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit < 0 || limit > models.MaxPageLimit {
+		return 0, fmt.Errorf("comments must be between 0 and %d", models.MaxPageLimit)
+	}
+
+	return limit, nil
+}
+
+// Get Question Comments
+//
+//	@Summary      Get Question Comments
+//	@Description  Get a page of the comments on a Question, oldest first. Deleted comments are kept as tombstones with an empty body so replies stay in place.
+//	@Tags         comments
+//	@Produce      json
+//	@Param id path string true "Question ID"
+//	@Param limit query int false "Page size, 1-100" default(20)
+//	@Param cursor query string false "Cursor returned as next_cursor"
+//	@Router       /api/v1/questions/{id}/comments [get]
+//	@Success 200 {object} types.Page{data=[]models.Comment}
+//	@Failure 400 {object} string
+//	@Failure 404 {object} string
+func GetQuestionComments(w http.ResponseWriter, r *http.Request) {
+	found, ok := findURLQuestion(w, r)
+	if !ok {
+		return
+	}
+
+	listComments(w, r, models.CommentListParams{QuestionID: found.ID})
+}
+
+// Get Answer Comments
+//
+//	@Summary      Get Answer Comments
+//	@Description  Get a page of the comments on an Answer, oldest first. Deleted comments are kept as tombstones with an empty body so replies stay in place.
+//	@Tags         comments
+//	@Produce      json
+//	@Param id path string true "Question ID"
+//	@Param answerID path string true "Answer ID"
+//	@Param limit query int false "Page size, 1-100" default(20)
+//	@Param cursor query string false "Cursor returned as next_cursor"
+//	@Router       /api/v1/questions/{id}/answers/{answerID}/comments [get]
+//	@Success 200 {object} types.Page{data=[]models.Comment}
+//	@Failure 400 {object} string
+//	@Failure 404 {object} string
+func GetAnswerComments(w http.ResponseWriter, r *http.Request) {
+	found, ok := findURLQuestion(w, r)
+	if !ok {
+		return
+	}
+
+	foundAnswer, ok := findURLAnswer(w, r, found.ID)
+	if !ok {
+		return
+	}
+
+	listComments(w, r, models.CommentListParams{QuestionID: found.ID, AnswerID: &foundAnswer.ID})
+}
+
+// Writes the page of comments selected by the query parameters
+func listComments(w http.ResponseWriter, r *http.Request, params models.CommentListParams) {
+	limit, err := helpers.ParseLimit(r, models.MaxPageLimit)
+	if err != nil {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+	params.Limit = limit
+
+	if raw := r.URL.Query().Get("cursor"); raw != "" {
+		params.Cursor, err = models.DecodeCursor(raw)
+		if err != nil {
+			helpers.ErrorJSON(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	comments, next, err := comment.List(params)
+
+	if errors.Is(err, models.ErrInvalidCursor) {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error listing comments")
+		helpers.ErrorJSON(w, errors.New("Error getting comments"), http.StatusInternalServerError)
+		return
+	}
+
+	var cursor string
+	if next != nil {
+		cursor = next.Encode()
+	}
+
+	helpers.WritePage(w, r, comments, cursor)
+}
+
+// Create Question Comment
+//
+//	@Summary      Create Question Comment
+//	@Description  Comment on a Question, or reply to one of its comments with `parent_id`. Participants of the Question mentioned as `@name`, without spaces, are notified.
+//	@Tags         comments
+//	@Accept       json
+//	@Produce      json
+//	@Param id path string true "Question ID"
+//	@Param comment body models.CommentInput true "Comment"
+//	@Security     BearerAuth
+//	@Router       /api/v1/questions/{id}/comments [post]
+//	@Success 201 {object} models.Comment
+//	@Failure 400 {object} string
+//	@Failure 401 {object} string
+//	@Failure 404 {object} string
+func CreateQuestionComment(w http.ResponseWriter, r *http.Request) {
+	found, ok := findURLQuestion(w, r)
+	if !ok {
+		return
+	}
+
+	createComment(w, r, found.ID, nil)
+}
+
+// Create Answer Comment
+//
+//	@Summary      Create Answer Comment
+//	@Description  Comment on an Answer, or reply to one of its comments with `parent_id`. Participants of the Question mentioned as `@name`, without spaces, are notified.
+//	@Tags         comments
+//	@Accept       json
+//	@Produce      json
+//	@Param id path string true "Question ID"
+//	@Param answerID path string true "Answer ID"
+//	@Param comment body models.CommentInput true "Comment"
+//	@Security     BearerAuth
+//	@Router       /api/v1/questions/{id}/answers/{answerID}/comments [post]
+//	@Success 201 {object} models.Comment
+//	@Failure 400 {object} string
+//	@Failure 401 {object} string
+//	@Failure 404 {object} string
+func CreateAnswerComment(w http.ResponseWriter, r *http.Request) {
+	found, ok := findURLQuestion(w, r)
+	if !ok {
+		return
+	}
+
+	foundAnswer, ok := findURLAnswer(w, r, found.ID)
+	if !ok {
+		return
+	}
+
+	createComment(w, r, found.ID, &foundAnswer.ID)
+}
+
+// Creates the comment of the principal from the request body
+func createComment(w http.ResponseWriter, r *http.Request, questionID uuid.UUID, answerID *uuid.UUID) {
+	principal, ok := authorization.FromContext(r.Context())
+	if !ok || principal.UserID == uuid.Nil {
+		helpers.ErrorJSON(w, errors.New("Unauthorized"), http.StatusUnauthorized)
+		return
+	}
+
+	var input models.CommentInput
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Invalid JSON"), http.StatusBadRequest)
+		return
+	}
+
+	err = helpers.ValidateStruct(input)
+	if err != nil {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	created, err := comment.Create(input.ToComment(questionID, answerID, principal.UserID))
+
+	if errors.Is(err, models.ErrInvalidParent) || errors.Is(err, models.ErrCommentDeleted) {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Error creating comment"), http.StatusInternalServerError)
+		return
+	}
+
+	_ = helpers.WriteJSON(w, http.StatusCreated, created)
+}
+
+// Returns the comment named in the URL if the principal may modify it, writing an error otherwise
+// Tombstones can't be modified
+func findModifiableComment(w http.ResponseWriter, r *http.Request) (*models.Comment, bool) {
+	principal, ok := authorization.FromContext(r.Context())
+	if !ok {
+		helpers.ErrorJSON(w, errors.New("Unauthorized"), http.StatusUnauthorized)
+		return nil, false
+	}
+
+	found, ok := findURLQuestion(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	id, err := uuid.FromString(chi.URLParam(r, "commentID"))
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Invalid comment ID"), http.StatusBadRequest)
+		return nil, false
+	}
+
+	foundComment, err := comment.FindByID(id)
+	if err != nil || foundComment.QuestionID != found.ID || foundComment.DeletedAt != nil {
+		helpers.ErrorJSON(w, models.ErrCommentNotFound, http.StatusNotFound)
+		return nil, false
+	}
+
+	if foundComment.UserID == nil || !principal.CanModify(*foundComment.UserID) {
+		helpers.ErrorJSON(w, errors.New("You can only modify your own comments"), http.StatusForbidden)
+		return nil, false
+	}
+
+	return foundComment, true
+}
+
+// Update Comment
+//
+//	@Summary      Update Comment
+//	@Description  Edit a comment on a Question or one of its Answers, only its author or an admin may. Users newly mentioned are notified.
+//	@Tags         comments
+//	@Accept       json
+//	@Produce      json
+//	@Param id path string true "Question ID"
+//	@Param commentID path string true "Comment ID"
+//	@Param comment body models.CommentInput true "Comment, parent_id is ignored"
+//	@Security     BearerAuth
+//	@Router       /api/v1/questions/{id}/comments/{commentID} [put]
+//	@Success 200 {object} models.Comment
+//	@Failure 400 {object} string
+//	@Failure 401 {object} string
+//	@Failure 403 {object} string
+//	@Failure 404 {object} string
+func UpdateComment(w http.ResponseWriter, r *http.Request) {
+	found, ok := findModifiableComment(w, r)
+	if !ok {
+		return
+	}
+
+	var input models.CommentInput
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Invalid JSON"), http.StatusBadRequest)
+		return
+	}
+
+	err = helpers.ValidateStruct(input)
+	if err != nil {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	updated, err := comment.Update(found.ID, input.Body)
+
+	if errors.Is(err, models.ErrCommentNotFound) || errors.Is(err, models.ErrCommentDeleted) {
+		helpers.ErrorJSON(w, models.ErrCommentNotFound, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Error updating comment"), http.StatusInternalServerError)
+		return
+	}
+
+	_ = helpers.WriteJSON(w, http.StatusOK, updated)
+}
+
+// Delete Comment
+//
+//	@Summary      Delete Comment
+//	@Description  Delete a comment on a Question or one of its Answers, only its author or an admin may. A tombstone keeps its place in the thread.
+//	@Tags         comments
+//	@Param id path string true "Question ID"
+//	@Param commentID path string true "Comment ID"
+//	@Security     BearerAuth
+//	@Router       /api/v1/questions/{id}/comments/{commentID} [delete]
+//	@Success 204
+//	@Failure 401 {object} string
+//	@Failure 403 {object} string
+//	@Failure 404 {object} string
+func DeleteComment(w http.ResponseWriter, r *http.Request) {
+	found, ok := findModifiableComment(w, r)
+	if !ok {
+		return
+	}
+
+	err := comment.Delete(found.ID)
+
+	if errors.Is(err, models.ErrCommentNotFound) {
+		helpers.ErrorJSON(w, err, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Error deleting comment"), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
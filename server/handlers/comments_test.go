@@ -0,0 +1,198 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"server/authorization"
+	"server/models"
+)
+
+const (
+	testCommentID = "5e6f7a8b-9c0d-4e1f-8a2b-3c4d5e6f7a8b"
+	testParentID  = "6f7a8b9c-0d1e-4f2a-9b3c-4d5e6f7a8b9c"
+)
+
+var commentColumns = []string{"id", "question_id", "answer_id", "parent_id", "user_id", "body", "created_at", "updated_at", "deleted_at"}
+
+func commentRow(authorID interface{}, body string, deletedAt interface{}) *sqlmock.Rows {
+	now := time.Now()
+
+	return sqlmock.NewRows(commentColumns).AddRow(testCommentID, testQuestionID, nil, nil, authorID, body, now, now, deletedAt)
+}
+
+// Expects the count of the comments embedded in a question, none of them
+func expectQuestionComments(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM comments").WithArgs(testQuestionID).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+}
+
+func TestMentions(t *testing.T) {
+	assert.Equal(t, []string{"alice", "bob"}, models.Mentions("@Alice see @bob. Thanks @alice"))
+	assert.Nil(t, models.Mentions("mail me at alice@example.com"))
+	assert.Len(t, models.Mentions("@a @b @c @d @e @f @g"), models.MaxCommentMentions)
+}
+
+func TestCreateQuestionComment(t *testing.T) {
+	mock := setupUserTest(t)
+
+	mock.ExpectQuery("SELECT (.+) FROM questions WHERE id").WithArgs(testQuestionID).WillReturnRows(questionRow(otherTestUserID))
+	expectQuestionTags(mock)
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO comments").
+		WithArgs(testQuestionID, nil, nil, testUserID, "Which version, @Bob?", sqlmock.AnyArg()).
+		WillReturnRows(commentRow(testUserID, "Which version, @Bob?", nil))
+	mock.ExpectExec("INSERT INTO notifications (.+) FROM users").
+		WithArgs(models.NotificationMention, testUserID, testQuestionID, nil, testCommentID, sqlmock.AnyArg(), "bob").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/questions/"+testQuestionID+"/comments", strings.NewReader(`{"body": "Which version, @Bob?"}`))
+	testRouter().ServeHTTP(rec, asTestUser(t, r))
+
+	assert.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateCommentReplyOnOtherTarget(t *testing.T) {
+	mock := setupUserTest(t)
+
+	mock.ExpectQuery("SELECT (.+) FROM questions WHERE id").WithArgs(testQuestionID).WillReturnRows(questionRow(otherTestUserID))
+	expectQuestionTags(mock)
+	mock.ExpectQuery("SELECT (.+) FROM answers WHERE id").WithArgs(testAnswerID).WillReturnRows(answerRow(testQuestionID, otherTestUserID))
+	mock.ExpectBegin()
+	// The parent is on the question, not on its answer
+	mock.ExpectQuery("SELECT question_id, answer_id, deleted_at FROM comments").WithArgs(testParentID).
+		WillReturnRows(sqlmock.NewRows([]string{"question_id", "answer_id", "deleted_at"}).AddRow(testQuestionID, nil, nil))
+	mock.ExpectRollback()
+
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/questions/"+testQuestionID+"/answers/"+testAnswerID+"/comments",
+		strings.NewReader(`{"body": "Agreed", "parent_id": "`+testParentID+`"}`))
+	testRouter().ServeHTTP(rec, asTestUser(t, r))
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestModifyCommentOwnership(t *testing.T) {
+	admin := &authorization.Principal{UserID: uuid.FromStringOrNil(otherTestUserID), Roles: []string{authorization.RoleAdmin}}
+	other := &authorization.Principal{UserID: uuid.FromStringOrNil(otherTestUserID)}
+	author := &authorization.Principal{UserID: uuid.FromStringOrNil(testUserID)}
+
+	tests := []struct {
+		name      string
+		method    string
+		principal *authorization.Principal
+		deletedAt interface{}
+		status    int
+		expect    func(mock sqlmock.Sqlmock)
+	}{
+		{name: "other user can't edit", method: http.MethodPut, principal: other, status: http.StatusForbidden},
+		{name: "other user can't delete", method: http.MethodDelete, principal: other, status: http.StatusForbidden},
+		{name: "tombstones can't be edited", method: http.MethodPut, principal: author, deletedAt: time.Now(), status: http.StatusNotFound},
+		{
+			name: "author edits", method: http.MethodPut, principal: author, status: http.StatusOK,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT body, deleted_at FROM comments WHERE id = \\$1 FOR UPDATE").WithArgs(testCommentID).
+					WillReturnRows(sqlmock.NewRows([]string{"body", "deleted_at"}).AddRow("Which version?", nil))
+				mock.ExpectQuery("UPDATE comments SET body").WithArgs("Which Go version?", sqlmock.AnyArg(), testCommentID).
+					WillReturnRows(commentRow(testUserID, "Which Go version?", nil))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "admin deletes", method: http.MethodDelete, principal: admin, status: http.StatusNoContent,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE comments SET body = '', user_id = NULL").WithArgs(sqlmock.AnyArg(), testCommentID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("DELETE FROM notifications WHERE comment_id").WithArgs(testCommentID).WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectCommit()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := setupUserTest(t)
+			mock.ExpectQuery("SELECT (.+) FROM questions WHERE id").WithArgs(testQuestionID).WillReturnRows(questionRow(otherTestUserID))
+			expectQuestionTags(mock)
+			mock.ExpectQuery("SELECT (.+) FROM comments WHERE id").WithArgs(testCommentID).WillReturnRows(commentRow(testUserID, "Which version?", tt.deletedAt))
+			if tt.expect != nil {
+				tt.expect(mock)
+			}
+
+			rec := httptest.NewRecorder()
+			r := httptest.NewRequest(tt.method, "/api/v1/questions/"+testQuestionID+"/comments/"+testCommentID, strings.NewReader(`{"body": "Which Go version?"}`))
+			testRouter().ServeHTTP(rec, asPrincipal(t, r, tt.principal))
+
+			assert.Equal(t, tt.status, rec.Code, rec.Body.String())
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGetQuestionEmbedsComments(t *testing.T) {
+	mock := setupUserTest(t)
+
+	now := time.Now()
+
+	mock.ExpectQuery("SELECT (.+) FROM questions WHERE id").WithArgs(testQuestionID).WillReturnRows(questionRow(testUserID))
+	expectQuestionTags(mock)
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM comments").WithArgs(testQuestionID).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery("SELECT (.+) FROM comments WHERE question_id = \\$1 AND answer_id IS NULL ORDER BY created_at, id LIMIT \\$2").
+		WithArgs(testQuestionID, 3).
+		WillReturnRows(sqlmock.NewRows(commentColumns).
+			AddRow(testParentID, testQuestionID, nil, nil, nil, "", now, now, now).
+			AddRow(testCommentID, testQuestionID, nil, testParentID, testUserID, "Go 1.20", now, now, nil))
+
+	rec := httptest.NewRecorder()
+	testRouter().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/questions/"+testQuestionID+"?comments=2", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	var found models.Question
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &found))
+	assert.Len(t, found.Comments, 2)
+	assert.NotNil(t, found.Comments[0].DeletedAt, "the tombstone keeps the reply in place")
+	assert.Equal(t, testParentID, found.Comments[1].ParentID.String())
+	if assert.NotNil(t, found.CommentCount) {
+		assert.Equal(t, 3, *found.CommentCount)
+	}
+}
+
+func TestGetQuestionCommentsLimit(t *testing.T) {
+	mock := setupUserTest(t)
+
+	rec := httptest.NewRecorder()
+	testRouter().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/questions/"+testQuestionID+"?comments=500", nil))
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetMyNotifications(t *testing.T) {
+	mock := setupUserTest(t)
+
+	mock.ExpectQuery("SELECT (.+) FROM notifications WHERE user_id = \\$1 AND read_at IS NULL").WithArgs(testUserID, 21).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "actor_id", "question_id", "answer_id", "comment_id", "created_at", "read_at"}).
+			AddRow(uuid.Must(uuid.NewV4()), models.NotificationMention, otherTestUserID, testQuestionID, nil, testCommentID, time.Now(), nil))
+
+	rec := httptest.NewRecorder()
+	testRouter().ServeHTTP(rec, asTestUser(t, httptest.NewRequest(http.MethodGet, "/api/v1/me/notifications?unread=true", nil)))
+
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Contains(t, rec.Body.String(), `"type": "mention"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
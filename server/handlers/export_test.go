@@ -0,0 +1,10 @@
+package handlers
+
+// Internals used by the tests in `handlers_test`, which go through the application router
+var InvalidateTags = invalidateTags
+
+const TagVersionKeyPrefix = tagVersionKeyPrefix
+
+type ImportResult = importResult
+
+type ImportSummary = importSummary
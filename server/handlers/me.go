@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/rs/zerolog/log"
+
+	"server/authorization"
+	"server/helpers"
+	"server/jobs"
+	"server/middleware"
+	"server/models"
+	"server/redis"
+)
+
+// Returns the ID of the authenticated user, set from the JWT subject
+func principalID(r *http.Request) (uuid.UUID, bool) {
+	principal, ok := authorization.FromContext(r.Context())
+	if !ok || principal.UserID == uuid.Nil {
+		return uuid.Nil, false
+	}
+
+	return principal.UserID, true
+}
+
+// Get Me
+//
+//	@Summary      Get Me
+//	@Description  Get the profile of the authenticated User
+//	@Tags         me
+//	@Produce      json
+//	@Security     BearerAuth
+//	@Router       /api/v1/me [get]
+//	@Success 200 {object} models.PublicUser
+//	@Failure 401 {object} string
+func GetMe(w http.ResponseWriter, r *http.Request) {
+	var userModel models.User
+
+	id, ok := principalID(r)
+	if !ok {
+		helpers.ErrorJSON(w, errors.New("Unauthorized"), http.StatusUnauthorized)
+		return
+	}
+
+	me, err := userModel.FindByID(id)
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("No user found"), http.StatusNotFound)
+		return
+	}
+
+	_ = helpers.WriteJSON(w, http.StatusOK, me.Public())
+}
+
+// Patch Me
+//
+//	@Summary      Patch Me
+//	@Description  Partially update the authenticated User, see `PATCH /api/v1/users/{id}`.
+//	@Description  The password is changed with `POST /api/v1/me/password` instead.
+//	@Tags         me
+//	@Accept       application/merge-patch+json
+//	@Accept       application/json-patch+json
+//	@Produce      json
+//	@Param patch body object true "Merge patch or JSON patch"
+//	@Security     BearerAuth
+//	@Router       /api/v1/me [patch]
+//	@Success 200 {object} models.PublicUser
+//	@Failure 400 {object} string
+//	@Failure 401 {object} string
+//	@Failure 409 {object} string
+//	@Failure 415 {object} string
+func PatchMe(w http.ResponseWriter, r *http.Request) {
+	id, ok := principalID(r)
+	if !ok {
+		helpers.ErrorJSON(w, errors.New("Unauthorized"), http.StatusUnauthorized)
+		return
+	}
+
+	patchUser(w, r, id, false)
+}
+
+// Change My Password
+//
+//	@Summary      Change My Password
+//	@Description  Change the password of the authenticated User. Its existing tokens are revoked.
+//	@Tags         me
+//	@Accept       json
+//	@Param passwords body models.ChangePasswordInput true "Passwords"
+//	@Security     BearerAuth
+//	@Router       /api/v1/me/password [post]
+//	@Success 204
+//	@Failure 400 {object} string
+//	@Failure 401 {object} string
+//	@Failure 403 {object} string
+func ChangeMyPassword(w http.ResponseWriter, r *http.Request) {
+	var userModel models.User
+
+	id, ok := principalID(r)
+	if !ok {
+		helpers.ErrorJSON(w, errors.New("Unauthorized"), http.StatusUnauthorized)
+		return
+	}
+
+	var input models.ChangePasswordInput
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Invalid JSON"), http.StatusBadRequest)
+		return
+	}
+
+	err = helpers.ValidateStruct(input)
+	if err != nil {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	me, err := userModel.FindByID(id)
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("No user found"), http.StatusNotFound)
+		return
+	}
+
+	if !helpers.ComparePasswords(me.Password, input.CurrentPassword) {
+		helpers.ErrorJSON(w, errors.New("Current password is incorrect"), http.StatusForbidden)
+		return
+	}
+
+	_, err = userModel.Patch(id, models.UserPatch{Password: &input.NewPassword})
+	if err != nil {
+		log.Error().Err(err).Msg("Error changing password")
+		helpers.ErrorJSON(w, errors.New("Error changing password"), http.StatusInternalServerError)
+		return
+	}
+
+	// Revoke the refresh token, stored under the user's email
+	_ = redis.DeleteCache(me.Email)
+	_ = middleware.InvalidateAuthStatus(me.Email)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Delete Me
+//
+//	@Summary      Delete Me
+//	@Description  Soft delete the authenticated User and revoke its tokens
+//	@Tags         me
+//	@Security     BearerAuth
+//	@Router       /api/v1/me [delete]
+//	@Success 204
+//	@Failure 401 {object} string
+func DeleteMe(w http.ResponseWriter, r *http.Request) {
+	id, ok := principalID(r)
+	if !ok {
+		helpers.ErrorJSON(w, errors.New("Unauthorized"), http.StatusUnauthorized)
+		return
+	}
+
+	deleteUser(w, id)
+}
+
+// Request My Data Export
+//
+//	@Summary      Request My Data Export
+//	@Description  Start building an archive of the authenticated User's profile, questions, sessions and audit events.
+//	@Description  Poll the job at the `Location` header until it is ready, then download it.
+//	@Tags         me
+//	@Produce      json
+//	@Security     BearerAuth
+//	@Router       /api/v1/me/export [post]
+//	@Success 202 {object} jobs.DataExport
+//	@Failure 401 {object} string
+func RequestDataExport(w http.ResponseWriter, r *http.Request) {
+	id, ok := principalID(r)
+	if !ok {
+		helpers.ErrorJSON(w, errors.New("Unauthorized"), http.StatusUnauthorized)
+		return
+	}
+
+	job, err := jobs.StartDataExport(id)
+	if err != nil {
+		log.Error().Err(err).Msg("Error starting data export")
+		helpers.ErrorJSON(w, errors.New("Error starting data export"), http.StatusInternalServerError)
+		return
+	}
+
+	var auditEvent models.AuditEvent
+	_ = auditEvent.Record(id, models.AuditDataExportRequested, map[string]interface{}{"job_id": job.ID})
+
+	headers := http.Header{}
+	headers.Set("Location", "/api/v1/me/export/"+job.ID.String())
+
+	_ = helpers.WriteJSON(w, http.StatusAccepted, job, headers)
+}
+
+// Returns the authenticated user's export job named in the URL, writing an error if there is none
+func findMyDataExport(w http.ResponseWriter, r *http.Request) (*jobs.DataExport, bool) {
+	id, ok := principalID(r)
+	if !ok {
+		helpers.ErrorJSON(w, errors.New("Unauthorized"), http.StatusUnauthorized)
+		return nil, false
+	}
+
+	jobID, err := uuid.FromString(chi.URLParam(r, "jobID"))
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Invalid export ID"), http.StatusBadRequest)
+		return nil, false
+	}
+
+	job, err := jobs.FindDataExport(jobID)
+	if err != nil || job == nil || job.UserID != id {
+		helpers.ErrorJSON(w, errors.New("No export found"), http.StatusNotFound)
+		return nil, false
+	}
+
+	return job, true
+}
+
+// Get My Data Export
+//
+//	@Summary      Get My Data Export
+//	@Description  Get the status of a data export job
+//	@Tags         me
+//	@Produce      json
+//	@Param jobID path string true "Export job ID"
+//	@Security     BearerAuth
+//	@Router       /api/v1/me/export/{jobID} [get]
+//	@Success 200 {object} jobs.DataExport
+//	@Failure 404 {object} string
+func GetDataExport(w http.ResponseWriter, r *http.Request) {
+	job, ok := findMyDataExport(w, r)
+	if !ok {
+		return
+	}
+
+	_ = helpers.WriteJSON(w, http.StatusOK, job)
+}
+
+// Download My Data Export
+//
+//	@Summary      Download My Data Export
+//	@Description  Download the zip archive of a finished data export job
+//	@Tags         me
+//	@Produce      application/zip
+//	@Param jobID path string true "Export job ID"
+//	@Security     BearerAuth
+//	@Router       /api/v1/me/export/{jobID}/download [get]
+//	@Success 200 {file} file
+//	@Failure 404 {object} string
+//	@Failure 409 {object} string
+func DownloadDataExport(w http.ResponseWriter, r *http.Request) {
+	job, ok := findMyDataExport(w, r)
+	if !ok {
+		return
+	}
+
+	if job.Status != jobs.DataExportReady {
+		helpers.ErrorJSON(w, fmt.Errorf("The export is %s", job.Status), http.StatusConflict)
+		return
+	}
+
+	file, err := os.Open(jobs.DataExportPath(job))
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("No export found"), http.StatusNotFound)
+		return
+	}
+
+	defer file.Close()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="data-export-%s.zip"`, job.ID))
+
+	http.ServeContent(w, r, "", *job.CompletedAt, file)
+}
+
+// Erase Me
+//
+//	@Summary      Erase Me
+//	@Description  Irreversibly anonymize the authenticated User, delete its questions, exports and sessions.
+//	@Description  The erasure itself is recorded in the audit log.
+//	@Tags         me
+//	@Accept       json
+//	@Param confirmation body object{confirm=bool} true "Must be {\"confirm\": true}"
+//	@Security     BearerAuth
+//	@Router       /api/v1/me/erase [post]
+//	@Success 204
+//	@Failure 400 {object} string
+//	@Failure 401 {object} string
+func EraseMe(w http.ResponseWriter, r *http.Request) {
+	var userModel models.User
+
+	id, ok := principalID(r)
+	if !ok {
+		helpers.ErrorJSON(w, errors.New("Unauthorized"), http.StatusUnauthorized)
+		return
+	}
+
+	body := struct {
+		Confirm bool `json:"confirm"`
+	}{}
+
+	err := helpers.ReadJSON(w, r, &body)
+	if err != nil || !body.Confirm {
+		helpers.ErrorJSON(w, errors.New(`Erasure is irreversible, confirm it with {"confirm": true}`), http.StatusBadRequest)
+		return
+	}
+
+	erasure, err := userModel.Erase(id)
+	if err != nil {
+		log.Error().Err(err).Msg("Error erasing user")
+		helpers.ErrorJSON(w, errors.New("Error erasing user"), http.StatusInternalServerError)
+		return
+	}
+
+	// Revoke the refresh token, stored under the user's email
+	_ = redis.DeleteCache(erasure.Email)
+	_ = middleware.InvalidateAuthStatus(erasure.Email)
+
+	err = jobs.RemoveDataExports(id)
+	if err != nil {
+		log.Error().Err(err).Msg("Error removing data exports")
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,151 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+
+	"server/handlers"
+	"server/helpers"
+	"server/redis"
+)
+
+func TestMeRequiresPrincipal(t *testing.T) {
+	setupUserTest(t)
+
+	for _, handler := range []http.HandlerFunc{handlers.GetMe, handlers.PatchMe, handlers.ChangeMyPassword, handlers.DeleteMe} {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/api/v1/me", nil))
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	}
+}
+
+func TestGetMe(t *testing.T) {
+	hash, _ := helpers.HashPassword("secret")
+
+	mock := setupUserTest(t)
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id").WithArgs(testUserID).WillReturnRows(userRow(t, hash))
+
+	rec := httptest.NewRecorder()
+	testRouter().ServeHTTP(rec, asTestUser(t, httptest.NewRequest(http.MethodGet, "/api/v1/me", nil)))
+
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Contains(t, rec.Body.String(), testUserID)
+	assert.Contains(t, rec.Body.String(), `"reputation": 15`)
+	assert.NotContains(t, rec.Body.String(), "$2a$")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPatchMeRejectsPassword(t *testing.T) {
+	hash, _ := helpers.HashPassword("secret")
+
+	mock := setupUserTest(t)
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id").WithArgs(testUserID).WillReturnRows(userRow(t, hash))
+
+	req := asTestUser(t, httptest.NewRequest(http.MethodPatch, "/api/v1/me", strings.NewReader(`{"password": "new-secret"}`)))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+
+	rec := httptest.NewRecorder()
+	testRouter().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestChangeMyPassword(t *testing.T) {
+	hash, _ := helpers.HashPassword("secret")
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		expect func(mock sqlmock.Sqlmock)
+	}{
+		{
+			name:   "changed",
+			body:   `{"current_password": "secret", "new_password": "new-secret"}`,
+			status: http.StatusNoContent,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT (.+) FROM users WHERE id").WillReturnRows(userRow(t, hash))
+				mock.ExpectQuery("UPDATE users SET password = \\$1, password_changed_at").
+					WithArgs(bcryptHash{"new-secret"}, sqlmock.AnyArg(), sqlmock.AnyArg(), testUserID).
+					WillReturnRows(userRow(t, ""))
+			},
+		},
+		{
+			name:   "wrong current password",
+			body:   `{"current_password": "guess", "new_password": "new-secret"}`,
+			status: http.StatusForbidden,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT (.+) FROM users WHERE id").WillReturnRows(userRow(t, hash))
+			},
+		},
+		{name: "same password", body: `{"current_password": "secret", "new_password": "secret"}`, status: http.StatusBadRequest},
+		{name: "missing new password", body: `{"current_password": "secret"}`, status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := setupUserTest(t)
+			assert.NoError(t, redis.SetCache("alice@example.com", "refresh-token-jti", time.Hour))
+
+			if tt.expect != nil {
+				tt.expect(mock)
+			}
+
+			rec := httptest.NewRecorder()
+			testRouter().ServeHTTP(rec, asTestUser(t, httptest.NewRequest(http.MethodPost, "/api/v1/me/password", strings.NewReader(tt.body))))
+
+			assert.Equal(t, tt.status, rec.Code, rec.Body.String())
+			assert.NoError(t, mock.ExpectationsWereMet())
+
+			jti, _ := redis.GetCache("alice@example.com")
+			assert.Equal(t, tt.status != http.StatusNoContent, jti != "", "refresh token revoked")
+		})
+	}
+}
+
+func TestEraseMe(t *testing.T) {
+	mock := setupUserTest(t)
+	assert.NoError(t, redis.SetCache("alice@example.com", "refresh-token-jti", time.Hour))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT email FROM users WHERE id = \\$1 AND deleted_at IS NULL FOR UPDATE").WithArgs(testUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("alice@example.com"))
+	mock.ExpectExec("DELETE FROM answers WHERE user_id").WithArgs(testUserID).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("DELETE FROM questions WHERE user_id").WithArgs(testUserID).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec("DELETE FROM user_identities WHERE user_id").WithArgs(testUserID).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE comments SET body = ''").WithArgs(testUserID, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 4))
+	mock.ExpectExec("UPDATE users SET name = 'Erased user'").
+		WithArgs("erased+"+testUserID+"@invalid", sqlmock.AnyArg(), testUserID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO audit_events").
+		WithArgs(testUserID, "user.erased", `{"answers_deleted":2,"questions_deleted":3}`, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	rec := httptest.NewRecorder()
+	testRouter().ServeHTTP(rec, asTestUser(t, httptest.NewRequest(http.MethodPost, "/api/v1/me/erase", strings.NewReader(`{"confirm": true}`))))
+
+	assert.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	jti, _ := redis.GetCache("alice@example.com")
+	assert.Empty(t, jti)
+}
+
+func TestEraseMeRequiresConfirmation(t *testing.T) {
+	mock := setupUserTest(t)
+
+	rec := httptest.NewRecorder()
+	testRouter().ServeHTTP(rec, asTestUser(t, httptest.NewRequest(http.MethodPost, "/api/v1/me/erase", strings.NewReader(`{}`))))
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
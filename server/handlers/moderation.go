@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/rs/zerolog/log"
+
+	"server/authorization"
+	"server/env"
+	"server/helpers"
+	"server/models"
+)
+
+var (
+	flag       models.Flag
+	moderation models.Moderation
+)
+
+// Checks if the caller may see content with the status. Hidden content stays visible
+// to its author, moderators see everything
+func canSee(r *http.Request, status string, authorID uuid.UUID) bool {
+	if status == models.StatusPublished {
+		return true
+	}
+
+	principal, ok := authorization.FromContext(r.Context())
+	if !ok {
+		return false
+	}
+
+	if principal.CanModerate() {
+		return true
+	}
+
+	return status == models.StatusHidden && principal.UserID != uuid.Nil && principal.UserID == authorID
+}
+
+// Flag Question
+//
+//	@Summary      Flag Question
+//	@Description  Flag a Question for moderators. It is hidden once enough users flagged it.
+//	@Tags         moderation
+//	@Accept       json
+//	@Produce      json
+//	@Param id path string true "Question ID"
+//	@Param flag body models.FlagInput true "Reason"
+//	@Security     BearerAuth
+//	@Router       /api/v1/questions/{id}/flag [post]
+//	@Success 201 {object} models.Flag
+//	@Failure 400 {object} string
+//	@Failure 401 {object} string
+//	@Failure 403 {object} string
+//	@Failure 404 {object} string
+//	@Failure 409 {object} string
+func FlagQuestion(w http.ResponseWriter, r *http.Request) {
+	found, ok := findURLQuestion(w, r)
+	if !ok {
+		return
+	}
+
+	status, ok := createFlag(w, r, models.ContentQuestion, found.ID)
+	if ok && status != found.Status {
+		invalidateTags(found.Tags)
+	}
+}
+
+// Flag Answer
+//
+//	@Summary      Flag Answer
+//	@Description  Flag an Answer for moderators. It is hidden once enough users flagged it.
+//	@Tags         moderation
+//	@Accept       json
+//	@Produce      json
+//	@Param id path string true "Question ID"
+//	@Param answerID path string true "Answer ID"
+//	@Param flag body models.FlagInput true "Reason"
+//	@Security     BearerAuth
+//	@Router       /api/v1/questions/{id}/answers/{answerID}/flag [post]
+//	@Success 201 {object} models.Flag
+//	@Failure 400 {object} string
+//	@Failure 401 {object} string
+//	@Failure 403 {object} string
+//	@Failure 404 {object} string
+//	@Failure 409 {object} string
+func FlagAnswer(w http.ResponseWriter, r *http.Request) {
+	found, ok := findURLQuestion(w, r)
+	if !ok {
+		return
+	}
+
+	foundAnswer, ok := findURLAnswer(w, r, found.ID)
+	if !ok {
+		return
+	}
+
+	createFlag(w, r, models.ContentAnswer, foundAnswer.ID)
+}
+
+// Flags the content as the principal, returns its status afterwards
+func createFlag(w http.ResponseWriter, r *http.Request, contentType string, id uuid.UUID) (string, bool) {
+	principal, ok := authorization.FromContext(r.Context())
+	if !ok || principal.UserID == uuid.Nil {
+		helpers.ErrorJSON(w, errors.New("Unauthorized"), http.StatusUnauthorized)
+		return "", false
+	}
+
+	var input models.FlagInput
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Invalid JSON"), http.StatusBadRequest)
+		return "", false
+	}
+
+	err = helpers.ValidateStruct(input)
+	if err != nil {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return "", false
+	}
+
+	created, status, err := flag.Create(contentType, id, principal.UserID, input.Reason, env.DefaultConfig.MODERATION_FLAG_THRESHOLD)
+
+	if errors.Is(err, models.ErrOwnFlag) {
+		helpers.ErrorJSON(w, err, http.StatusForbidden)
+		return "", false
+	}
+
+	if errors.Is(err, models.ErrDuplicateFlag) {
+		helpers.ErrorJSON(w, err, http.StatusConflict)
+		return "", false
+	}
+
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Error flagging "+contentType), http.StatusInternalServerError)
+		return "", false
+	}
+
+	_ = helpers.WriteJSON(w, http.StatusCreated, created)
+
+	return status, true
+}
+
+// Get Moderation Queue
+//
+//	@Summary      Get Moderation Queue
+//	@Description  Get a page of the flagged Questions and Answers awaiting a decision, flagged the longest ago first. Moderators and admins only.
+//	@Tags         moderation
+//	@Produce      json
+//	@Param limit query int false "Page size, 1-100" default(20)
+//	@Param cursor query string false "Cursor returned as next_cursor"
+//	@Security     BearerAuth
+//	@Router       /api/v1/admin/moderation [get]
+//	@Success 200 {object} types.Page{data=[]models.ModerationItem}
+//	@Failure 400 {object} string
+//	@Failure 403 {object} string
+func GetModerationQueue(w http.ResponseWriter, r *http.Request) {
+	limit, err := helpers.ParseLimit(r, models.MaxPageLimit)
+	if err != nil {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	var cursor *models.Cursor
+
+	if raw := r.URL.Query().Get("cursor"); raw != "" {
+		cursor, err = models.DecodeCursor(raw)
+		if err != nil {
+			helpers.ErrorJSON(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	items, next, err := moderation.Queue(limit, cursor)
+
+	if errors.Is(err, models.ErrInvalidCursor) {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error getting the moderation queue")
+		helpers.ErrorJSON(w, errors.New("Error getting the moderation queue"), http.StatusInternalServerError)
+		return
+	}
+
+	var nextCursor string
+	if next != nil {
+		nextCursor = next.Encode()
+	}
+
+	helpers.WritePage(w, r, items, nextCursor)
+}
+
+// Returns the content type and ID named in the URL, writing an error if the content does not exist
+// Questions come with their tags, whose listings a decision invalidates
+func findModeratedContent(w http.ResponseWriter, r *http.Request) (string, uuid.UUID, []string, bool) {
+	id, err := uuid.FromString(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Invalid ID"), http.StatusBadRequest)
+		return "", uuid.Nil, nil, false
+	}
+
+	if chi.URLParam(r, "type") == "answers" {
+		if _, err := answer.FindByID(id); err != nil {
+			helpers.ErrorJSON(w, errors.New("No answer found"), http.StatusNotFound)
+			return "", uuid.Nil, nil, false
+		}
+
+		return models.ContentAnswer, id, nil, true
+	}
+
+	found, err := question.FindByID(id)
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("No question found"), http.StatusNotFound)
+		return "", uuid.Nil, nil, false
+	}
+
+	return models.ContentQuestion, id, found.Tags, true
+}
+
+// Moderate Content
+//
+//	@Summary      Moderate Content
+//	@Description  Approve, hide or delete a Question or Answer and resolve its flags. The reason is recorded with the decision. Moderators and admins only.
+//	@Tags         moderation
+//	@Accept       json
+//	@Produce      json
+//	@Param type path string true "questions or answers"
+//	@Param id path string true "Question or Answer ID"
+//	@Param decision body models.ModerationInput true "Decision"
+//	@Security     BearerAuth
+//	@Router       /api/v1/admin/moderation/{type}/{id} [post]
+//	@Success 200 {object} models.ModerationDecision
+//	@Failure 400 {object} string
+//	@Failure 403 {object} string
+//	@Failure 404 {object} string
+func ModerateContent(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authorization.FromContext(r.Context())
+	if !ok || principal.UserID == uuid.Nil {
+		helpers.ErrorJSON(w, errors.New("Unauthorized"), http.StatusUnauthorized)
+		return
+	}
+
+	var input models.ModerationInput
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Invalid JSON"), http.StatusBadRequest)
+		return
+	}
+
+	err = helpers.ValidateStruct(input)
+	if err != nil {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	contentType, id, tags, ok := findModeratedContent(w, r)
+	if !ok {
+		return
+	}
+
+	decision, err := moderation.Decide(contentType, id, principal.UserID, input.Action, input.Reason)
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Error moderating "+contentType), http.StatusInternalServerError)
+		return
+	}
+
+	invalidateTags(tags)
+
+	_ = helpers.WriteJSON(w, http.StatusOK, decision)
+}
+
+// Get Moderation Decisions
+//
+//	@Summary      Get Moderation Decisions
+//	@Description  Get the decisions taken on a Question or Answer with their reasons, oldest first. Moderators and admins only.
+//	@Tags         moderation
+//	@Produce      json
+//	@Param type path string true "questions or answers"
+//	@Param id path string true "Question or Answer ID"
+//	@Security     BearerAuth
+//	@Router       /api/v1/admin/moderation/{type}/{id}/decisions [get]
+//	@Success 200 {object} []models.ModerationDecision
+//	@Failure 403 {object} string
+//	@Failure 404 {object} string
+func GetModerationDecisions(w http.ResponseWriter, r *http.Request) {
+	contentType, id, _, ok := findModeratedContent(w, r)
+	if !ok {
+		return
+	}
+
+	decisions, err := moderation.FindDecisions(contentType, id)
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Error getting moderation decisions"), http.StatusInternalServerError)
+		return
+	}
+
+	_ = helpers.WriteJSON(w, http.StatusOK, decisions)
+}
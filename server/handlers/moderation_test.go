@@ -0,0 +1,235 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"server/authorization"
+	"server/env"
+	"server/handlers"
+	"server/models"
+	"server/redis"
+)
+
+const otherTestUserID = "7a1d2c3b-4e5f-4a6b-8c7d-9e0f1a2b3c4d"
+
+func questionRowWithStatus(ownerID string, status string) *sqlmock.Rows {
+	now := time.Now()
+
+	return sqlmock.NewRows([]string{"id", "question", "created_at", "updated_at", "user_id", "score", "accepted_answer_id", "status"}).
+		AddRow(testQuestionID, "What is Go?", now, now, ownerID, 0, nil, status)
+}
+
+func decisionRow(contentType string, targetID string, action string, status string) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "target_type", "target_id", "moderator_id", "action", "status", "reason", "created_at"}).
+		AddRow(uuid.Must(uuid.NewV4()), contentType, targetID, nil, action, status, "Spam", time.Now())
+}
+
+func TestHiddenQuestionVisibility(t *testing.T) {
+	author := &authorization.Principal{UserID: uuid.FromStringOrNil(testUserID)}
+	other := &authorization.Principal{UserID: uuid.FromStringOrNil(otherTestUserID)}
+	moderator := &authorization.Principal{UserID: uuid.FromStringOrNil(otherTestUserID), Roles: []string{authorization.RoleModerator}}
+
+	tests := []struct {
+		name      string
+		status    string
+		principal *authorization.Principal
+		code      int
+	}{
+		{name: "anonymous sees published", status: models.StatusPublished, code: http.StatusOK},
+		{name: "anonymous can't see hidden", status: models.StatusHidden, code: http.StatusNotFound},
+		{name: "other user can't see hidden", status: models.StatusHidden, principal: other, code: http.StatusNotFound},
+		{name: "author sees hidden", status: models.StatusHidden, principal: author, code: http.StatusOK},
+		{name: "author can't see removed", status: models.StatusRemoved, principal: author, code: http.StatusNotFound},
+		{name: "moderator sees removed", status: models.StatusRemoved, principal: moderator, code: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := setupUserTest(t)
+			mock.ExpectQuery("SELECT (.+) FROM questions WHERE id").WithArgs(testQuestionID).WillReturnRows(questionRowWithStatus(testUserID, tt.status))
+			expectQuestionTags(mock)
+			if tt.code == http.StatusOK {
+				expectQuestionComments(mock)
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/questions/"+testQuestionID, nil)
+			if tt.principal != nil {
+				r = asPrincipal(t, r, tt.principal)
+			}
+
+			rec := httptest.NewRecorder()
+			testRouter().ServeHTTP(rec, r)
+
+			assert.Equal(t, tt.code, rec.Code, rec.Body.String())
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestFlagQuestion(t *testing.T) {
+	flagRow := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "target_type", "target_id", "user_id", "reason", "created_at", "resolved_at"}).
+			AddRow(uuid.Must(uuid.NewV4()), "question", testQuestionID, testUserID, "Spam", time.Now(), nil)
+	}
+
+	tests := []struct {
+		name   string
+		author string
+		code   int
+		expect func(mock sqlmock.Sqlmock)
+	}{
+		{
+			name:   "hidden at the threshold",
+			author: otherTestUserID,
+			code:   http.StatusCreated,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("INSERT INTO flags").WithArgs("question", testQuestionID, testUserID, "Spam", sqlmock.AnyArg()).WillReturnRows(flagRow())
+				mock.ExpectQuery("SELECT COUNT").WithArgs("question", testQuestionID).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+				mock.ExpectExec("UPDATE questions SET status").WithArgs("hidden", testQuestionID).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("INSERT INTO moderation_decisions").
+					WithArgs("question", testQuestionID, nil, "auto_hide", "hidden", "Flagged by 2 users", sqlmock.AnyArg()).
+					WillReturnRows(decisionRow("question", testQuestionID, "auto_hide", "hidden"))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name:   "flagged twice",
+			author: otherTestUserID,
+			code:   http.StatusConflict,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("INSERT INTO flags").WillReturnRows(sqlmock.NewRows(nil))
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name:   "own question",
+			author: testUserID,
+			code:   http.StatusForbidden,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectRollback()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env.DefaultConfig.MODERATION_FLAG_THRESHOLD = 2
+			t.Cleanup(func() { env.DefaultConfig.MODERATION_FLAG_THRESHOLD = 0 })
+
+			mock := setupUserTest(t)
+			mock.ExpectQuery("SELECT (.+) FROM questions WHERE id").WithArgs(testQuestionID).WillReturnRows(questionRowWithStatus(tt.author, models.StatusPublished))
+			expectQuestionTags(mock, "go")
+			mock.ExpectBegin()
+			mock.ExpectQuery("SELECT user_id, status FROM questions WHERE id = \\$1 FOR UPDATE").WithArgs(testQuestionID).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id", "status"}).AddRow(tt.author, models.StatusPublished))
+			tt.expect(mock)
+
+			rec := httptest.NewRecorder()
+			testRouter().ServeHTTP(rec, asTestUser(t, httptest.NewRequest(http.MethodPost, "/api/v1/questions/"+testQuestionID+"/flag", strings.NewReader(`{"reason": "Spam"}`))))
+
+			assert.Equal(t, tt.code, rec.Code, rec.Body.String())
+			assert.NoError(t, mock.ExpectationsWereMet())
+
+			if tt.code == http.StatusCreated {
+				version, err := redis.GetCounter(handlers.TagVersionKeyPrefix + "go")
+				assert.NoError(t, err)
+				assert.Equal(t, int64(1), version, "listings no longer show the hidden question")
+			}
+		})
+	}
+}
+
+func TestModerateContent(t *testing.T) {
+	moderator := &authorization.Principal{UserID: uuid.FromStringOrNil(otherTestUserID), Roles: []string{authorization.RoleModerator}}
+	user := &authorization.Principal{UserID: uuid.FromStringOrNil(otherTestUserID)}
+
+	post := func(principal *authorization.Principal, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/admin/moderation/answers/"+testAnswerID, strings.NewReader(body))
+		testRouter().ServeHTTP(rec, asPrincipal(t, r, principal))
+		return rec
+	}
+
+	t.Run("moderator deletes", func(t *testing.T) {
+		mock := setupUserTest(t)
+
+		mock.ExpectQuery("SELECT (.+) FROM answers WHERE id").WithArgs(testAnswerID).WillReturnRows(answerRow(testQuestionID, testUserID))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE answers SET status").WithArgs("removed", testAnswerID).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("INSERT INTO moderation_decisions").
+			WithArgs("answer", testAnswerID, moderator.UserID, "delete", "removed", "Spam", sqlmock.AnyArg()).
+			WillReturnRows(decisionRow("answer", testAnswerID, "delete", "removed"))
+		mock.ExpectExec("UPDATE flags SET resolved_at").WithArgs(sqlmock.AnyArg(), "answer", testAnswerID).WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectCommit()
+
+		rec := post(moderator, `{"action": "delete", "reason": "Spam"}`)
+
+		assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.Contains(t, rec.Body.String(), `"status": "removed"`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("reason is required", func(t *testing.T) {
+		mock := setupUserTest(t)
+
+		rec := post(moderator, `{"action": "delete"}`)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("unknown action", func(t *testing.T) {
+		mock := setupUserTest(t)
+
+		rec := post(moderator, `{"action": "ban", "reason": "Spam"}`)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("users can't moderate", func(t *testing.T) {
+		mock := setupUserTest(t)
+
+		rec := post(user, `{"action": "delete", "reason": "Spam"}`)
+
+		assert.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestGetModerationQueue(t *testing.T) {
+	mock := setupUserTest(t)
+
+	flags, _ := json.Marshal([]map[string]interface{}{
+		{"id": uuid.Must(uuid.NewV4()), "type": "answer", "target_id": testAnswerID, "user_id": testUserID, "reason": "Spam", "created_at": time.Now()},
+	})
+
+	mock.ExpectQuery("FROM flags f JOIN").WithArgs("question", "answer", 21).
+		WillReturnRows(sqlmock.NewRows([]string{"type", "id", "question_id", "user_id", "body", "status", "flagged_at", "flags"}).
+			AddRow("answer", testAnswerID, testQuestionID, otherTestUserID, "Buy now", "hidden", time.Now(), flags))
+
+	admin := &authorization.Principal{UserID: uuid.FromStringOrNil(testUserID), Roles: []string{authorization.RoleAdmin}}
+
+	rec := httptest.NewRecorder()
+	testRouter().ServeHTTP(rec, asPrincipal(t, httptest.NewRequest(http.MethodGet, "/api/v1/admin/moderation", nil), admin))
+
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	var page struct {
+		Data []models.ModerationItem `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	assert.Len(t, page.Data, 1)
+	assert.Len(t, page.Data[0].Flags, 1)
+	assert.Equal(t, "Spam", page.Data[0].Flags[0].Reason)
+}
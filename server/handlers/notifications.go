@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+
+	"server/helpers"
+	"server/models"
+)
+
+var notification models.Notification
+
+// Get My Notifications
+//
+//	@Summary      Get My Notifications
+//	@Description  Get a page of the notifications of the authenticated User, newest first
+//	@Tags         me
+//	@Produce      json
+//	@Param unread query bool false "Only the notifications not read yet"
+//	@Param limit query int false "Page size, 1-100" default(20)
+//	@Param cursor query string false "Cursor returned as next_cursor"
+//	@Security     BearerAuth
+//	@Router       /api/v1/me/notifications [get]
+//	@Success 200 {object} types.Page{data=[]models.Notification}
+//	@Failure 400 {object} string
+//	@Failure 401 {object} string
+func GetMyNotifications(w http.ResponseWriter, r *http.Request) {
+	id, ok := principalID(r)
+	if !ok {
+		helpers.ErrorJSON(w, errors.New("Unauthorized"), http.StatusUnauthorized)
+		return
+	}
+
+	limit, err := helpers.ParseLimit(r, models.MaxPageLimit)
+	if err != nil {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	params := models.NotificationListParams{UserID: id, Limit: limit, Unread: r.URL.Query().Get("unread") == "true"}
+
+	if raw := r.URL.Query().Get("cursor"); raw != "" {
+		params.Cursor, err = models.DecodeCursor(raw)
+		if err != nil {
+			helpers.ErrorJSON(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	notifications, next, err := notification.List(params)
+
+	if errors.Is(err, models.ErrInvalidCursor) {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error listing notifications")
+		helpers.ErrorJSON(w, errors.New("Error getting notifications"), http.StatusInternalServerError)
+		return
+	}
+
+	var cursor string
+	if next != nil {
+		cursor = next.Encode()
+	}
+
+	helpers.WritePage(w, r, notifications, cursor)
+}
+
+// Read My Notifications
+//
+//	@Summary      Read My Notifications
+//	@Description  Mark notifications of the authenticated User as read, all of them when `ids` is omitted
+//	@Tags         me
+//	@Accept       json
+//	@Produce      json
+//	@Param notifications body models.NotificationReadInput false "Notification IDs"
+//	@Security     BearerAuth
+//	@Router       /api/v1/me/notifications/read [post]
+//	@Success 200 {object} object{read=int}
+//	@Failure 400 {object} string
+//	@Failure 401 {object} string
+func ReadMyNotifications(w http.ResponseWriter, r *http.Request) {
+	id, ok := principalID(r)
+	if !ok {
+		helpers.ErrorJSON(w, errors.New("Unauthorized"), http.StatusUnauthorized)
+		return
+	}
+
+	var input models.NotificationReadInput
+
+	if r.ContentLength != 0 {
+		err := helpers.ReadJSON(w, r, &input)
+		if err != nil {
+			helpers.ErrorJSON(w, errors.New("Invalid JSON"), http.StatusBadRequest)
+			return
+		}
+	}
+
+	err := helpers.ValidateStruct(input)
+	if err != nil {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	read, err := notification.MarkRead(id, input.IDs)
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Error reading notifications"), http.StatusInternalServerError)
+		return
+	}
+
+	_ = helpers.WriteJSON(w, http.StatusOK, map[string]int64{"read": read})
+}
@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/rs/zerolog/log"
+
+	"server/authorization"
+	"server/helpers"
+	"server/middleware"
+	"server/models"
+)
+
+var question models.Question
+
+// Returns the question named in the URL, writing an error if it does not exist or is hidden from the caller
+func findURLQuestion(w http.ResponseWriter, r *http.Request) (*models.Question, bool) {
+	id, err := uuid.FromString(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Invalid question ID"), http.StatusBadRequest)
+		return nil, false
+	}
+
+	found, err := question.FindByID(id)
+	if err != nil || !canSee(r, found.Status, found.UserID) {
+		helpers.ErrorJSON(w, errors.New("No question found"), http.StatusNotFound)
+		return nil, false
+	}
+
+	return found, true
+}
+
+// Get All Questions
+//
+//	@Summary      Get all Questions
+//	@Description  Get a page of Questions, newest first. Pages are linked by `next_cursor` and the `Link` header. Listings by tag are cached.
+//	@Tags         questions
+//	@Produce      json
+//	@Param limit query int false "Page size, 1-100" default(20)
+//	@Param cursor query string false "Cursor returned as next_cursor"
+//	@Param user_id query string false "Only questions asked by this User"
+//	@Param tags query string false "Comma separated tags, only questions with all of them"
+//	@Router       /api/v1/questions [get]
+//	@Success 200 {object} types.Page{data=[]models.Question}
+//	@Failure 400 {object} string
+//	@Failure 500 {object} string
+func GetAllQuestions(w http.ResponseWriter, r *http.Request) {
+	var params models.QuestionListParams
+
+	limit, err := helpers.ParseLimit(r, models.MaxPageLimit)
+	if err != nil {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+	params.Limit = limit
+
+	if raw := r.URL.Query().Get("cursor"); raw != "" {
+		params.Cursor, err = models.DecodeCursor(raw)
+		if err != nil {
+			helpers.ErrorJSON(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if raw := r.URL.Query().Get("user_id"); raw != "" {
+		userID, err := uuid.FromString(raw)
+		if err != nil {
+			helpers.ErrorJSON(w, errors.New("Invalid user ID"), http.StatusBadRequest)
+			return
+		}
+		params.UserID = &userID
+	}
+
+	tags, ok := parseTagFilter(w, r)
+	if !ok {
+		return
+	}
+	params.Tags = tags
+
+	var cacheKey string
+
+	if len(params.Tags) > 0 {
+		// Served uncached when Redis is unavailable
+		cacheKey, err = tagListingCacheKey(r, params.Tags)
+		if err != nil {
+			log.Error().Err(err).Msg("Error preparing tag listing cache key")
+		} else if cached, _ := middleware.CachedResponseToJSON(cacheKey); cached != nil {
+			_ = helpers.WriteJSON(w, http.StatusOK, cached.Body, cached.Headers)
+			return
+		}
+	}
+
+	questions, next, err := question.List(params)
+
+	if errors.Is(err, models.ErrInvalidCursor) {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error getting questions")
+		helpers.ErrorJSON(w, errors.New("No questions found"), http.StatusInternalServerError)
+		return
+	}
+
+	var cursor string
+	if next != nil {
+		cursor = next.Encode()
+	}
+
+	page, headers := helpers.WritePage(w, r, questions, cursor)
+
+	if cacheKey != "" {
+		_ = middleware.StoreCachedResponse(cacheKey, page, tagListingTTL, headers)
+	}
+}
+
+// Get Question
+//
+//	@Summary      Get Question
+//	@Description  Get a Question by ID with its first comments, oldest first, and the number of them
+//	@Tags         questions
+//	@Produce      json
+//	@Param id path string true "Question ID"
+//	@Param comments query int false "Comments to embed, 0-100" default(5)
+//	@Router       /api/v1/questions/{id} [get]
+//	@Success 200 {object} models.Question
+//	@Failure 400 {object} string
+//	@Failure 404 {object} string
+func GetQuestion(w http.ResponseWriter, r *http.Request) {
+	limit, err := parseEmbeddedComments(r)
+	if err != nil {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	found, ok := findURLQuestion(w, r)
+	if !ok {
+		return
+	}
+
+	comments, count, err := comment.Embedded(found.ID, limit)
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Error getting comments"), http.StatusInternalServerError)
+		return
+	}
+
+	found.Comments, found.CommentCount = comments, &count
+
+	_ = helpers.WriteJSON(w, http.StatusOK, found)
+}
+
+// Create Question
+//
+//	@Summary      Create Question
+//	@Description  Create a Question owned by the authenticated User
+//	@Tags         questions
+//	@Accept       json
+//	@Produce      json
+//	@Param question body models.QuestionInput true "Question"
+//	@Security     BearerAuth
+//	@Router       /api/v1/questions [post]
+//	@Success 201 {object} models.Question
+//	@Failure 400 {object} string
+//	@Failure 401 {object} string
+//	@Failure 500 {object} string
+func CreateQuestion(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authorization.FromContext(r.Context())
+	if !ok || principal.UserID == uuid.Nil {
+		helpers.ErrorJSON(w, errors.New("Unauthorized"), http.StatusUnauthorized)
+		return
+	}
+
+	var input models.QuestionInput
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Invalid JSON"), http.StatusBadRequest)
+		return
+	}
+
+	input.Normalize()
+
+	err = helpers.ValidateStruct(input)
+	if err != nil {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	created, err := question.Create(input.ToQuestion(principal.UserID))
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Error creating question"), http.StatusInternalServerError)
+		return
+	}
+
+	invalidateTags(created.Tags)
+
+	_ = helpers.WriteJSON(w, http.StatusCreated, created)
+}
+
+// Returns the question named in the URL if the principal may modify it, writing an error otherwise
+func findModifiableQuestion(w http.ResponseWriter, r *http.Request) (*models.Question, bool) {
+	principal, ok := authorization.FromContext(r.Context())
+	if !ok {
+		helpers.ErrorJSON(w, errors.New("Unauthorized"), http.StatusUnauthorized)
+		return nil, false
+	}
+
+	found, ok := findURLQuestion(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	if !principal.CanModify(found.UserID) {
+		helpers.ErrorJSON(w, errors.New("You can only modify your own questions"), http.StatusForbidden)
+		return nil, false
+	}
+
+	return found, true
+}
+
+// Update Question
+//
+//	@Summary      Update Question
+//	@Description  Update a Question, only its owner or an admin may. Omitting `tags` keeps the current ones. Text changes are recorded as revisions.
+//	@Tags         questions
+//	@Accept       json
+//	@Produce      json
+//	@Param id path string true "Question ID"
+//	@Param question body models.QuestionInput true "Question"
+//	@Security     BearerAuth
+//	@Router       /api/v1/questions/{id} [put]
+//	@Success 200 {object} models.Question
+//	@Failure 400 {object} string
+//	@Failure 401 {object} string
+//	@Failure 403 {object} string
+//	@Failure 404 {object} string
+func UpdateQuestion(w http.ResponseWriter, r *http.Request) {
+	found, ok := findModifiableQuestion(w, r)
+	if !ok {
+		return
+	}
+
+	var input models.QuestionInput
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Invalid JSON"), http.StatusBadRequest)
+		return
+	}
+
+	input.Normalize()
+
+	err = helpers.ValidateStruct(input)
+	if err != nil {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	principal, _ := authorization.FromContext(r.Context())
+
+	updated, err := question.Update(found.ID, input.ToQuestion(found.UserID), principal.UserID)
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Error updating question"), http.StatusInternalServerError)
+		return
+	}
+
+	// Listings of the removed tags drop it, the others show the new text
+	invalidateTags(found.Tags, updated.Tags)
+
+	_ = helpers.WriteJSON(w, http.StatusOK, updated)
+}
+
+// Delete Question
+//
+//	@Summary      Delete Question
+//	@Description  Delete a Question, only its owner or an admin may
+//	@Tags         questions
+//	@Param id path string true "Question ID"
+//	@Security     BearerAuth
+//	@Router       /api/v1/questions/{id} [delete]
+//	@Success 204
+//	@Failure 401 {object} string
+//	@Failure 403 {object} string
+//	@Failure 404 {object} string
+func DeleteQuestion(w http.ResponseWriter, r *http.Request) {
+	found, ok := findModifiableQuestion(w, r)
+	if !ok {
+		return
+	}
+
+	err := question.DeleteByID(found.ID)
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Error deleting question"), http.StatusInternalServerError)
+		return
+	}
+
+	invalidateTags(found.Tags)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,123 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"server/authorization"
+)
+
+const testQuestionID = "5f0c7e2a-1d3b-4c8e-9f6a-2b7d4e1c9a30"
+
+func questionRow(ownerID string) *sqlmock.Rows {
+	now := time.Now()
+
+	return sqlmock.NewRows([]string{"id", "question", "created_at", "updated_at", "user_id", "score", "accepted_answer_id", "status"}).
+		AddRow(testQuestionID, "What is Go?", now, now, ownerID, 0, nil, "published")
+}
+
+// Expects the tags of the test question to be loaded
+func expectQuestionTags(mock sqlmock.Sqlmock, names ...string) {
+	rows := sqlmock.NewRows([]string{"question_id", "name"})
+	for _, name := range names {
+		rows.AddRow(testQuestionID, name)
+	}
+
+	mock.ExpectQuery("SELECT (.+) FROM question_tags").WithArgs(testQuestionID).WillReturnRows(rows)
+}
+
+func TestCreateQuestionUsesPrincipal(t *testing.T) {
+	mock := setupUserTest(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO questions").
+		WithArgs("What is Go?", sqlmock.AnyArg(), testUserID).
+		WillReturnRows(questionRow(testUserID))
+	mock.ExpectExec("DELETE FROM question_tags").WithArgs(testQuestionID).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	body := `{"question": "What is Go?", "user_id": "00000000-0000-0000-0000-000000000001"}`
+
+	rec := httptest.NewRecorder()
+	testRouter().ServeHTTP(rec, asTestUser(t, httptest.NewRequest(http.MethodPost, "/api/v1/questions", strings.NewReader(body))))
+
+	assert.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	assert.Contains(t, rec.Body.String(), testUserID)
+	assert.Contains(t, rec.Body.String(), testQuestionID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	rec = httptest.NewRecorder()
+	testRouter().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/questions", strings.NewReader(body)))
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestModifyQuestionOwnership(t *testing.T) {
+	otherUserID := "7a1d2c3b-4e5f-4a6b-8c7d-9e0f1a2b3c4d"
+
+	owner := &authorization.Principal{UserID: uuid.FromStringOrNil(testUserID)}
+	other := &authorization.Principal{UserID: uuid.FromStringOrNil(otherUserID)}
+	admin := &authorization.Principal{UserID: uuid.FromStringOrNil(otherUserID), Roles: []string{authorization.RoleAdmin}}
+
+	tests := []struct {
+		name      string
+		method    string
+		principal *authorization.Principal
+		status    int
+	}{
+		{name: "owner updates", method: http.MethodPut, principal: owner, status: http.StatusOK},
+		{name: "admin updates", method: http.MethodPut, principal: admin, status: http.StatusOK},
+		{name: "other user updates", method: http.MethodPut, principal: other, status: http.StatusForbidden},
+		{name: "owner deletes", method: http.MethodDelete, principal: owner, status: http.StatusNoContent},
+		{name: "admin deletes", method: http.MethodDelete, principal: admin, status: http.StatusNoContent},
+		{name: "other user deletes", method: http.MethodDelete, principal: other, status: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := setupUserTest(t)
+			mock.ExpectQuery("SELECT (.+) FROM questions WHERE id").WithArgs(testQuestionID).WillReturnRows(questionRow(testUserID))
+			expectQuestionTags(mock)
+
+			if tt.status == http.StatusOK {
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT question FROM questions WHERE id = \\$1 FOR UPDATE").WithArgs(testQuestionID).
+					WillReturnRows(sqlmock.NewRows([]string{"question"}).AddRow("What is Go?"))
+				mock.ExpectQuery("UPDATE questions SET").
+					WithArgs("What is Go?", sqlmock.AnyArg(), testQuestionID).
+					WillReturnRows(questionRow(testUserID))
+				expectQuestionTags(mock)
+				mock.ExpectCommit()
+			}
+			if tt.status == http.StatusNoContent {
+				mock.ExpectExec("DELETE FROM questions WHERE id").WithArgs(testQuestionID).WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			body := strings.NewReader(`{"question": "What is Go?"}`)
+
+			rec := httptest.NewRecorder()
+			testRouter().ServeHTTP(rec, asPrincipal(t, httptest.NewRequest(tt.method, "/api/v1/questions/"+testQuestionID, body), tt.principal))
+
+			assert.Equal(t, tt.status, rec.Code, rec.Body.String())
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGetQuestionNotFound(t *testing.T) {
+	mock := setupUserTest(t)
+	mock.ExpectQuery("SELECT (.+) FROM questions WHERE id").WithArgs(testQuestionID).WillReturnRows(sqlmock.NewRows(nil))
+
+	rec := httptest.NewRecorder()
+	testRouter().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/questions/"+testQuestionID, nil))
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/rs/zerolog/log"
+
+	"server/authorization"
+	"server/helpers"
+	"server/models"
+)
+
+// Get Question Revisions
+//
+//	@Summary      Get Question Revisions
+//	@Description  Get a page of the edits of a Question, newest first, with a word diff of each. Pages are linked by `next_cursor` and the `Link` header.
+//	@Tags         questions
+//	@Produce      json
+//	@Param id path string true "Question ID"
+//	@Param limit query int false "Page size, 1-100" default(20)
+//	@Param cursor query string false "Cursor returned as next_cursor"
+//	@Router       /api/v1/questions/{id}/revisions [get]
+//	@Success 200 {object} types.Page{data=[]models.QuestionRevision}
+//	@Failure 400 {object} string
+//	@Failure 404 {object} string
+//	@Failure 500 {object} string
+func GetQuestionRevisions(w http.ResponseWriter, r *http.Request) {
+	found, ok := findURLQuestion(w, r)
+	if !ok {
+		return
+	}
+
+	limit, err := helpers.ParseLimit(r, models.MaxPageLimit)
+	if err != nil {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	params := models.RevisionListParams{QuestionID: found.ID, Limit: limit}
+
+	if raw := r.URL.Query().Get("cursor"); raw != "" {
+		params.Cursor, err = models.DecodeCursor(raw)
+		if err != nil {
+			helpers.ErrorJSON(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	revisions, next, err := question.ListRevisions(params)
+
+	if errors.Is(err, models.ErrInvalidCursor) {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error listing question revisions")
+		helpers.ErrorJSON(w, errors.New("Error getting revisions"), http.StatusInternalServerError)
+		return
+	}
+
+	var cursor string
+	if next != nil {
+		cursor = next.Encode()
+	}
+
+	helpers.WritePage(w, r, revisions, cursor)
+}
+
+// Rollback Question
+//
+//	@Summary      Rollback Question
+//	@Description  Restore the text a revision replaced, undoing it and every later edit. The rollback is recorded as a new revision. Only the owner of the Question or a moderator may.
+//	@Tags         questions
+//	@Produce      json
+//	@Param id path string true "Question ID"
+//	@Param revisionID path string true "Revision ID"
+//	@Security     BearerAuth
+//	@Router       /api/v1/questions/{id}/revisions/{revisionID}/rollback [post]
+//	@Success 200 {object} models.Question
+//	@Failure 400 {object} string
+//	@Failure 401 {object} string
+//	@Failure 403 {object} string
+//	@Failure 404 {object} string
+func RollbackQuestion(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authorization.FromContext(r.Context())
+	if !ok || principal.UserID == uuid.Nil {
+		helpers.ErrorJSON(w, errors.New("Unauthorized"), http.StatusUnauthorized)
+		return
+	}
+
+	revisionID, err := uuid.FromString(chi.URLParam(r, "revisionID"))
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Invalid revision ID"), http.StatusBadRequest)
+		return
+	}
+
+	found, ok := findURLQuestion(w, r)
+	if !ok {
+		return
+	}
+
+	if !principal.CanModify(found.UserID) && !principal.CanModerate() {
+		helpers.ErrorJSON(w, errors.New("You can only roll back your own questions"), http.StatusForbidden)
+		return
+	}
+
+	updated, err := question.Rollback(found.ID, revisionID, principal.UserID)
+
+	if errors.Is(err, models.ErrRevisionNotFound) {
+		helpers.ErrorJSON(w, err, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Error rolling back question"), http.StatusInternalServerError)
+		return
+	}
+
+	invalidateTags(updated.Tags)
+
+	_ = helpers.WriteJSON(w, http.StatusOK, updated)
+}
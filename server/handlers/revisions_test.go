@@ -0,0 +1,138 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"server/authorization"
+	"server/helpers"
+	"server/models"
+)
+
+const testRevisionID = "3c9e1f7a-6b2d-4e8c-a1f5-7d3b9c2e4a60"
+
+func TestUpdateQuestionRecordsRevision(t *testing.T) {
+	mock := setupUserTest(t)
+
+	admin := &authorization.Principal{UserID: uuid.FromStringOrNil(otherTestUserID), Roles: []string{authorization.RoleAdmin}}
+
+	mock.ExpectQuery("SELECT (.+) FROM questions WHERE id").WithArgs(testQuestionID).WillReturnRows(questionRow(testUserID))
+	expectQuestionTags(mock)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT question FROM questions WHERE id = \\$1 FOR UPDATE").WithArgs(testQuestionID).
+		WillReturnRows(sqlmock.NewRows([]string{"question"}).AddRow("What is Go?"))
+	mock.ExpectQuery("UPDATE questions SET").WithArgs("What is Go really?", sqlmock.AnyArg(), testQuestionID).WillReturnRows(questionRow(testUserID))
+	mock.ExpectExec("INSERT INTO question_revisions").
+		WithArgs(testQuestionID, admin.UserID, "What is Go?", "What is Go really?", nil, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectQuestionTags(mock)
+	mock.ExpectCommit()
+
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPut, "/api/v1/questions/"+testQuestionID, strings.NewReader(`{"question": "What is Go really?"}`))
+	testRouter().ServeHTTP(rec, asPrincipal(t, r, admin))
+
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetQuestionRevisions(t *testing.T) {
+	mock := setupUserTest(t)
+
+	mock.ExpectQuery("SELECT (.+) FROM questions WHERE id").WithArgs(testQuestionID).WillReturnRows(questionRow(testUserID))
+	expectQuestionTags(mock)
+	mock.ExpectQuery("SELECT (.+) FROM question_revisions WHERE question_id = \\$1 ORDER BY created_at DESC, id DESC LIMIT \\$2").
+		WithArgs(testQuestionID, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "question_id", "user_id", "before", "after", "rollback_of", "created_at"}).
+			AddRow(testRevisionID, testQuestionID, testUserID, "What is Go?", "What is Go really?", nil, time.Now()).
+			AddRow(uuid.Must(uuid.NewV4()), testQuestionID, nil, "Go?", "What is Go?", nil, time.Now().Add(-time.Hour)))
+
+	rec := httptest.NewRecorder()
+	testRouter().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/questions/"+testQuestionID+"/revisions?limit=1", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	var page struct {
+		Data       []models.QuestionRevision `json:"data"`
+		NextCursor string                    `json:"next_cursor"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	assert.Len(t, page.Data, 1)
+	assert.NotEmpty(t, page.NextCursor)
+	assert.Equal(t, []helpers.DiffOp{
+		{Op: helpers.DiffEqual, Text: "What is "},
+		{Op: helpers.DiffDelete, Text: "Go?"},
+		{Op: helpers.DiffInsert, Text: "Go really?"},
+	}, page.Data[0].Diff)
+}
+
+func TestRollbackQuestion(t *testing.T) {
+	owner := &authorization.Principal{UserID: uuid.FromStringOrNil(testUserID)}
+	other := &authorization.Principal{UserID: uuid.FromStringOrNil(otherTestUserID)}
+	moderator := &authorization.Principal{UserID: uuid.FromStringOrNil(otherTestUserID), Roles: []string{authorization.RoleModerator}}
+
+	tests := []struct {
+		name      string
+		principal *authorization.Principal
+		code      int
+	}{
+		{name: "owner rolls back", principal: owner, code: http.StatusOK},
+		{name: "moderator rolls back", principal: moderator, code: http.StatusOK},
+		{name: "other user can't roll back", principal: other, code: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := setupUserTest(t)
+			mock.ExpectQuery("SELECT (.+) FROM questions WHERE id").WithArgs(testQuestionID).WillReturnRows(questionRow(testUserID))
+			expectQuestionTags(mock, "go")
+
+			if tt.code == http.StatusOK {
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT before FROM question_revisions").WithArgs(testRevisionID, testQuestionID).
+					WillReturnRows(sqlmock.NewRows([]string{"before"}).AddRow("Go?"))
+				mock.ExpectQuery("SELECT question FROM questions WHERE id = \\$1 FOR UPDATE").WithArgs(testQuestionID).
+					WillReturnRows(sqlmock.NewRows([]string{"question"}).AddRow("What is Go?"))
+				mock.ExpectQuery("UPDATE questions SET").WithArgs("Go?", sqlmock.AnyArg(), testQuestionID).WillReturnRows(questionRow(testUserID))
+				mock.ExpectExec("INSERT INTO question_revisions").
+					WithArgs(testQuestionID, tt.principal.UserID, "What is Go?", "Go?", testRevisionID, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				expectQuestionTags(mock, "go")
+				mock.ExpectCommit()
+			}
+
+			rec := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/questions/"+testQuestionID+"/revisions/"+testRevisionID+"/rollback", nil)
+			testRouter().ServeHTTP(rec, asPrincipal(t, r, tt.principal))
+
+			assert.Equal(t, tt.code, rec.Code, rec.Body.String())
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRollbackUnknownRevision(t *testing.T) {
+	mock := setupUserTest(t)
+
+	mock.ExpectQuery("SELECT (.+) FROM questions WHERE id").WithArgs(testQuestionID).WillReturnRows(questionRow(testUserID))
+	expectQuestionTags(mock)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT before FROM question_revisions").WithArgs(testRevisionID, testQuestionID).WillReturnRows(sqlmock.NewRows(nil))
+	mock.ExpectRollback()
+
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/questions/"+testQuestionID+"/revisions/"+testRevisionID+"/rollback", nil)
+	testRouter().ServeHTTP(rec, asTestUser(t, r))
+
+	assert.Equal(t, http.StatusNotFound, rec.Code, rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
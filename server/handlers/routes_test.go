@@ -0,0 +1,64 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/gofrs/uuid"
+
+	"server/authorization"
+	"server/models"
+	"server/redis"
+	"server/routes"
+)
+
+var testTokenAuth = jwtauth.New("HS256", []byte("test-secret"), nil)
+
+// Returns the application router, with the middlewares of every route
+func testRouter() http.Handler {
+	router := routes.Router(testTokenAuth)
+
+	// Only the configured hosts pass the security middleware
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Host = "localhost:5000"
+		router.ServeHTTP(w, r)
+	})
+}
+
+// Returns the request with an access token for the principal
+// Its auth status is cached so the authenticator does not query the DB
+func asPrincipal(t *testing.T, r *http.Request, principal *authorization.Principal) *http.Request {
+	subject := principal.Email
+	if subject == "" {
+		subject = principal.UserID.String()
+	}
+
+	status, _ := json.Marshal(map[string]interface{}{
+		"status": models.UserAuthStatus{ID: principal.UserID, Email: principal.Email},
+	})
+	if err := redis.SetCache("auth:status:"+subject, string(status), time.Hour); err != nil {
+		t.Fatalf("Error caching auth status: %s", err)
+	}
+
+	_, token, err := testTokenAuth.Encode(map[string]interface{}{
+		"sub":   subject,
+		"roles": principal.Roles,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		t.Fatalf("Error encoding token: %s", err)
+	}
+
+	r.Header.Set("Authorization", "Bearer "+token)
+
+	return r
+}
+
+// Returns the request as sent by the authenticated test user
+func asTestUser(t *testing.T, r *http.Request) *http.Request {
+	return asPrincipal(t, r, &authorization.Principal{UserID: uuid.FromStringOrNil(testUserID), Email: "alice@example.com"})
+}
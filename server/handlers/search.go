@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/rs/zerolog/log"
+
+	"server/helpers"
+	"server/models"
+)
+
+var search models.Search
+
+// Longest query accepted, in characters
+const maxSearchQueryLength = 200
+
+// Search
+//
+//	@Summary      Search Questions and Answers
+//	@Description  Full-text search over Questions and Answers, best match first, with highlighted snippets. Pages are linked by `next_cursor` and the `Link` header.
+//	@Tags         search
+//	@Produce      json
+//	@Param q query string true "Terms, quoted phrases, or and - to exclude"
+//	@Param tags query string false "Comma separated tags, Answers match through their Question"
+//	@Param user_id query string false "Only content written by this User"
+//	@Param limit query int false "Page size, 1-100" default(20)
+//	@Param cursor query string false "Cursor returned as next_cursor"
+//	@Router       /api/v1/search [get]
+//	@Success 200 {object} types.Page{data=[]models.SearchResult}
+//	@Failure 400 {object} string
+//	@Failure 500 {object} string
+func Search(w http.ResponseWriter, r *http.Request) {
+	params := models.SearchParams{Query: strings.TrimSpace(r.URL.Query().Get("q"))}
+
+	if params.Query == "" {
+		helpers.ErrorJSON(w, errors.New("q is required"), http.StatusBadRequest)
+		return
+	}
+
+	if len([]rune(params.Query)) > maxSearchQueryLength {
+		helpers.ErrorJSON(w, fmt.Errorf("q must be at most %d characters", maxSearchQueryLength), http.StatusBadRequest)
+		return
+	}
+
+	limit, err := helpers.ParseLimit(r, models.MaxPageLimit)
+	if err != nil {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+	params.Limit = limit
+
+	if raw := r.URL.Query().Get("cursor"); raw != "" {
+		params.Cursor, err = models.DecodeCursor(raw)
+		if err != nil {
+			helpers.ErrorJSON(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if raw := r.URL.Query().Get("user_id"); raw != "" {
+		userID, err := uuid.FromString(raw)
+		if err != nil {
+			helpers.ErrorJSON(w, errors.New("Invalid user ID"), http.StatusBadRequest)
+			return
+		}
+		params.UserID = &userID
+	}
+
+	tags, ok := parseTagFilter(w, r)
+	if !ok {
+		return
+	}
+	params.Tags = tags
+
+	results, next, err := search.Find(params)
+
+	if errors.Is(err, models.ErrInvalidCursor) {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error searching")
+		helpers.ErrorJSON(w, errors.New("Error searching"), http.StatusInternalServerError)
+		return
+	}
+
+	var cursor string
+	if next != nil {
+		cursor = next.Encode()
+	}
+
+	helpers.WritePage(w, r, results, cursor)
+}
@@ -0,0 +1,115 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+
+	"server/models"
+	"server/types"
+)
+
+func searchRows() *sqlmock.Rows {
+	now := time.Now()
+
+	return sqlmock.NewRows([]string{"type", "id", "question_id", "user_id", "snippet", "rank", "created_at"}).
+		AddRow("question", testQuestionID, testQuestionID, testUserID, "What is \x02Go\x03?", float32(0.6079271), now).
+		AddRow("answer", testAnswerID, testQuestionID, testUserID, "\x02Go\x03 is a language", float32(0.0607927), now)
+}
+
+func TestSearchPaginatesByRank(t *testing.T) {
+	mock := setupUserTest(t)
+
+	mock.ExpectQuery("websearch_to_tsquery(.+) FROM matches ORDER BY rank DESC, id DESC LIMIT").
+		WithArgs("go", 2).
+		WillReturnRows(searchRows())
+
+	rec := httptest.NewRecorder()
+	testRouter().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/search?q=go&limit=1", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Contains(t, rec.Header().Get("Link"), "cursor=")
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	var page types.Page
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	assert.Len(t, page.Data, 1)
+	assert.NotNil(t, page.NextCursor)
+
+	// The next page starts below the rank of the last result
+	mock.ExpectQuery("\\(rank, id\\) < \\(\\$2::real, \\$3\\)").
+		WithArgs("go", float32(0.6079271), testQuestionID, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"type", "id", "question_id", "user_id", "snippet", "rank", "created_at"}))
+
+	rec = httptest.NewRecorder()
+	testRouter().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/search?q=go&limit=1&cursor="+*page.NextCursor, nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSearchFilters(t *testing.T) {
+	mock := setupUserTest(t)
+
+	mock.ExpectQuery("SELECT s.name, t.name FROM tag_synonyms").WithArgs("go").
+		WillReturnRows(sqlmock.NewRows([]string{"name", "name"}))
+	mock.ExpectQuery("FROM matches WHERE user_id = \\$2 AND question_id IN \\(SELECT qt.question_id").
+		WithArgs("channels", testUserID, "go", 1, 21).
+		WillReturnRows(searchRows())
+
+	rec := httptest.NewRecorder()
+	testRouter().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/search?q=channels&tags=Go&user_id="+testUserID, nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	var page struct {
+		Data []models.SearchResult `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	assert.Len(t, page.Data, 2)
+	assert.Equal(t, models.ContentAnswer, page.Data[1].Type)
+	assert.Equal(t, "<mark>Go</mark> is a language", page.Data[1].Snippet)
+}
+
+func TestSearchEscapesSnippets(t *testing.T) {
+	mock := setupUserTest(t)
+
+	mock.ExpectQuery("ts_headline\\('english', translate\\(page.body, '\x02\x03', ''\\)").
+		WithArgs("go", 21).
+		WillReturnRows(sqlmock.NewRows([]string{"type", "id", "question_id", "user_id", "snippet", "rank", "created_at"}).
+			AddRow("answer", testAnswerID, testQuestionID, testUserID, "Use \x02Go\x03 <img src=x onerror=\"alert(1)\"> & <mark>more</mark>", float32(0.1), time.Now()))
+
+	rec := httptest.NewRecorder()
+	testRouter().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/search?q=go", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	var page struct {
+		Data []models.SearchResult `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	if assert.Len(t, page.Data, 1) {
+		assert.Equal(t, `Use <mark>Go</mark> &lt;img src=x onerror=&#34;alert(1)&#34;&gt; &amp; &lt;mark&gt;more&lt;/mark&gt;`, page.Data[0].Snippet)
+	}
+}
+
+func TestSearchRejectsInvalidParameters(t *testing.T) {
+	for _, query := range []string{"", "q=", "q=go&user_id=alice", "q=go&cursor=invalid", "q=go&tags=a,b,c,d,e,f"} {
+		t.Run(query, func(t *testing.T) {
+			mock := setupUserTest(t)
+
+			rec := httptest.NewRecorder()
+			testRouter().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/search?"+query, nil))
+
+			assert.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
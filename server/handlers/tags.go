@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+
+	"server/helpers"
+	"server/middleware"
+	"server/models"
+	"server/redis"
+)
+
+var tag models.Tag
+
+// Listings by tag are cached under the versions of their tags, bumping a version
+// invalidates every listing that includes the tag
+const tagVersionKeyPrefix = "tags:version:"
+
+// Bounds how stale the scores and answers of cached listings get
+const tagListingTTL = 5 * time.Minute
+
+// Returns the cache key of a question listing filtered by the canonical tags
+func tagListingCacheKey(r *http.Request, tags []string) (string, error) {
+	routeKey, err := middleware.PrepareRouteKey(r)
+	if err != nil {
+		return "", err
+	}
+
+	versions := make([]string, len(tags))
+	for i, name := range tags {
+		version, err := redis.GetCounter(tagVersionKeyPrefix + name)
+		if err != nil {
+			return "", err
+		}
+
+		versions[i] = fmt.Sprintf("%s@%d", name, version)
+	}
+
+	return "tags:" + strings.Join(versions, ",") + ":" + routeKey, nil
+}
+
+// Drops the cached listings including any of the tags
+func invalidateTags(tags ...[]string) {
+	seen := map[string]bool{}
+
+	for _, names := range tags {
+		for _, name := range names {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+
+			if _, err := redis.Increment(tagVersionKeyPrefix + name); err != nil {
+				log.Error().Err(err).Str("tag", name).Msg("Error invalidating tag listings")
+			}
+		}
+	}
+}
+
+// Returns the canonical tags of the `tags` query parameter, writing an error if there are too many
+func parseTagFilter(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	raw := r.URL.Query().Get("tags")
+	if raw == "" {
+		return nil, true
+	}
+
+	tags := models.NormalizeTags(strings.Split(raw, ","))
+	if len(tags) > models.MaxQuestionTags {
+		helpers.ErrorJSON(w, fmt.Errorf("At most %d tags can be filtered on", models.MaxQuestionTags), http.StatusBadRequest)
+		return nil, false
+	}
+
+	canonical, err := tag.Canonical(tags)
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Error resolving tags"), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return canonical, true
+}
+
+// Get Tags
+//
+//	@Summary      Get Tags
+//	@Description  Get a page of Tags with the number of Questions tagged with each, most used first. Pages are linked by `next_cursor` and the `Link` header.
+//	@Tags         tags
+//	@Produce      json
+//	@Param limit query int false "Page size, 1-100" default(20)
+//	@Param cursor query string false "Cursor returned as next_cursor"
+//	@Param prefix query string false "Only tags starting with this prefix"
+//	@Router       /api/v1/tags [get]
+//	@Success 200 {object} types.Page{data=[]models.Tag}
+//	@Failure 400 {object} string
+//	@Failure 500 {object} string
+func GetTags(w http.ResponseWriter, r *http.Request) {
+	params := models.TagListParams{Prefix: strings.TrimSpace(r.URL.Query().Get("prefix"))}
+
+	limit, err := helpers.ParseLimit(r, models.MaxPageLimit)
+	if err != nil {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+	params.Limit = limit
+
+	if raw := r.URL.Query().Get("cursor"); raw != "" {
+		params.Cursor, err = models.DecodeCursor(raw)
+		if err != nil {
+			helpers.ErrorJSON(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	tags, next, err := tag.List(params)
+
+	if errors.Is(err, models.ErrInvalidCursor) {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error getting tags")
+		helpers.ErrorJSON(w, errors.New("No tags found"), http.StatusInternalServerError)
+		return
+	}
+
+	var cursor string
+	if next != nil {
+		cursor = next.Encode()
+	}
+
+	helpers.WritePage(w, r, tags, cursor)
+}
+
+// Get Tag Synonyms
+//
+//	@Summary      Get Tag Synonyms
+//	@Description  Get the alternative names resolved to a Tag
+//	@Tags         tags
+//	@Produce      json
+//	@Param name path string true "Tag name"
+//	@Router       /api/v1/tags/{name}/synonyms [get]
+//	@Success 200 {object} []models.TagSynonym
+//	@Failure 500 {object} string
+func GetTagSynonyms(w http.ResponseWriter, r *http.Request) {
+	synonyms, err := tag.FindSynonyms(chi.URLParam(r, "name"))
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Error getting tag synonyms"), http.StatusInternalServerError)
+		return
+	}
+
+	_ = helpers.WriteJSON(w, http.StatusOK, synonyms)
+}
+
+type tagSynonymBody struct {
+	Name string `json:"name" validate:"required,tag"`
+}
+
+// Add Tag Synonym
+//
+//	@Summary      Add Tag Synonym
+//	@Description  Make a name resolve to a Tag when tagging and filtering Questions. An existing Tag with that name is merged into the Tag.
+//	@Tags         tags
+//	@Accept       json
+//	@Produce      json
+//	@Param name path string true "Tag name"
+//	@Param synonym body tagSynonymBody true "Synonym"
+//	@Security     BearerAuth
+//	@Router       /api/v1/admin/tags/{name}/synonyms [post]
+//	@Success 201 {object} models.TagSynonym
+//	@Failure 400 {object} string
+//	@Failure 404 {object} string
+//	@Failure 409 {object} string
+func AddTagSynonym(w http.ResponseWriter, r *http.Request) {
+	var body tagSynonymBody
+
+	err := helpers.ReadJSON(w, r, &body)
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Invalid JSON"), http.StatusBadRequest)
+		return
+	}
+
+	body.Name = strings.ToLower(strings.TrimSpace(body.Name))
+
+	err = helpers.ValidateStruct(body)
+	if err != nil {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	name := strings.ToLower(chi.URLParam(r, "name"))
+
+	created, err := tag.AddSynonym(name, body.Name)
+
+	if errors.Is(err, models.ErrDuplicateTag) {
+		helpers.ErrorJSON(w, err, http.StatusConflict)
+		return
+	}
+
+	if errors.Is(err, models.ErrTagNotFound) {
+		helpers.ErrorJSON(w, err, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Error creating tag synonym"), http.StatusInternalServerError)
+		return
+	}
+
+	// The questions of a merged tag now list under the tag
+	invalidateTags([]string{name, body.Name})
+
+	_ = helpers.WriteJSON(w, http.StatusCreated, created)
+}
+
+// Delete Tag Synonym
+//
+//	@Summary      Delete Tag Synonym
+//	@Description  Stop resolving a name to a Tag, Questions keep the Tag
+//	@Tags         tags
+//	@Param name path string true "Tag name"
+//	@Param synonym path string true "Synonym"
+//	@Security     BearerAuth
+//	@Router       /api/v1/admin/tags/{name}/synonyms/{synonym} [delete]
+//	@Success 204
+//	@Failure 404 {object} string
+func DeleteTagSynonym(w http.ResponseWriter, r *http.Request) {
+	name := strings.ToLower(chi.URLParam(r, "name"))
+	synonym := strings.ToLower(chi.URLParam(r, "synonym"))
+
+	err := tag.DeleteSynonym(name, synonym)
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("No tag synonym found"), http.StatusNotFound)
+		return
+	}
+
+	invalidateTags([]string{name, synonym})
+
+	w.WriteHeader(http.StatusNoContent)
+}
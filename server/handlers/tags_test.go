@@ -0,0 +1,171 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"server/authorization"
+	"server/handlers"
+	"server/redis"
+)
+
+func TestCreateQuestionResolvesTagSynonyms(t *testing.T) {
+	mock := setupUserTest(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO questions").
+		WithArgs("What is Go?", sqlmock.AnyArg(), testUserID).
+		WillReturnRows(questionRow(testUserID))
+	mock.ExpectExec("DELETE FROM question_tags").WithArgs(testQuestionID).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT s.name, t.name FROM tag_synonyms").WithArgs("go", "golang", "concurrency").
+		WillReturnRows(sqlmock.NewRows([]string{"name", "name"}).AddRow("golang", "go"))
+	mock.ExpectExec("INSERT INTO tags").WithArgs(sqlmock.AnyArg(), "concurrency", "go").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO question_tags").WithArgs(testQuestionID, "concurrency", "go").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	body := `{"question": "What is Go?", "tags": ["Go", " golang", "concurrency", "go"]}`
+
+	rec := httptest.NewRecorder()
+	testRouter().ServeHTTP(rec, asTestUser(t, httptest.NewRequest(http.MethodPost, "/api/v1/questions", strings.NewReader(body))))
+
+	assert.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	assert.Contains(t, rec.Body.String(), `"tags": [`)
+	assert.Contains(t, rec.Body.String(), `"concurrency"`)
+	assert.NotContains(t, rec.Body.String(), `"golang"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	version, err := redis.GetCounter(handlers.TagVersionKeyPrefix + "go")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), version, "listings by the new tags are invalidated")
+}
+
+func TestCreateQuestionRejectsInvalidTags(t *testing.T) {
+	tests := []struct {
+		name string
+		tags string
+	}{
+		{name: "invalid characters", tags: `["go lang"]`},
+		{name: "leading symbol", tags: `["-go"]`},
+		{name: "too long", tags: `["` + strings.Repeat("a", 36) + `"]`},
+		{name: "too many", tags: `["a", "b", "c", "d", "e", "f"]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := setupUserTest(t)
+
+			body := `{"question": "What is Go?", "tags": ` + tt.tags + `}`
+
+			rec := httptest.NewRecorder()
+			testRouter().ServeHTTP(rec, asTestUser(t, httptest.NewRequest(http.MethodPost, "/api/v1/questions", strings.NewReader(body))))
+
+			assert.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGetQuestionsByTagIsCached(t *testing.T) {
+	mock := setupUserTest(t)
+
+	router := testRouter()
+
+	expectListing := func() {
+		mock.ExpectQuery("SELECT s.name, t.name FROM tag_synonyms").WithArgs("go").
+			WillReturnRows(sqlmock.NewRows([]string{"name", "name"}))
+		mock.ExpectQuery("SELECT (.+) FROM questions WHERE status = \\$1 AND id IN \\(SELECT qt.question_id").
+			WithArgs("published", "go", 1, 21).
+			WillReturnRows(questionRow(testUserID))
+		expectQuestionTags(mock, "go")
+	}
+
+	get := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/questions?tags=Go", nil))
+		return rec
+	}
+
+	expectListing()
+	first := get()
+	assert.Equal(t, http.StatusOK, first.Code, first.Body.String())
+	assert.Contains(t, first.Body.String(), testQuestionID)
+
+	// Only the synonyms are resolved, the page comes from the cache
+	mock.ExpectQuery("SELECT s.name, t.name FROM tag_synonyms").WithArgs("go").
+		WillReturnRows(sqlmock.NewRows([]string{"name", "name"}))
+	second := get()
+	assert.Equal(t, http.StatusOK, second.Code)
+	assert.JSONEq(t, first.Body.String(), second.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	handlers.InvalidateTags([]string{"go"})
+
+	expectListing()
+	third := get()
+	assert.Equal(t, http.StatusOK, third.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAddTagSynonym(t *testing.T) {
+	admin := &authorization.Principal{UserID: uuid.FromStringOrNil(testUserID), Roles: []string{authorization.RoleAdmin}}
+
+	post := func(t *testing.T, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		testRouter().ServeHTTP(rec, asPrincipal(t, httptest.NewRequest(http.MethodPost, "/api/v1/admin/tags/go/synonyms", strings.NewReader(body)), admin))
+		return rec
+	}
+
+	t.Run("merges the existing tag", func(t *testing.T) {
+		mock := setupUserTest(t)
+
+		tagID, mergedID := "1c9e6a1e-2b7f-4a55-9d0e-6f3a1b2c4d5e", "8e7d6c5b-4a39-4281-9f0e-1d2c3b4a5968"
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id FROM tags WHERE name").WithArgs("go").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(tagID))
+		mock.ExpectQuery("SELECT id FROM tags WHERE name").WithArgs("golang").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(mergedID))
+		mock.ExpectExec("INSERT INTO question_tags").WithArgs(tagID, mergedID).WillReturnResult(sqlmock.NewResult(0, 4))
+		mock.ExpectExec("UPDATE tag_synonyms SET tag_id").WithArgs(tagID, mergedID).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("DELETE FROM tags WHERE id").WithArgs(tagID, mergedID).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("INSERT INTO tag_synonyms").WithArgs("golang", tagID, sqlmock.AnyArg(), "go").
+			WillReturnRows(sqlmock.NewRows([]string{"name", "tag", "created_at"}).AddRow("golang", "go", time.Now()))
+		mock.ExpectCommit()
+
+		rec := post(t, `{"name": "GoLang"}`)
+
+		assert.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+
+		version, err := redis.GetCounter(handlers.TagVersionKeyPrefix + "go")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), version)
+	})
+
+	t.Run("unknown tag", func(t *testing.T) {
+		mock := setupUserTest(t)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id FROM tags WHERE name").WithArgs("go").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectRollback()
+
+		rec := post(t, `{"name": "golang"}`)
+
+		assert.Equal(t, http.StatusNotFound, rec.Code, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("invalid name", func(t *testing.T) {
+		mock := setupUserTest(t)
+
+		rec := post(t, `{"name": "go lang"}`)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+
+	"server/env"
+	"server/helpers"
+	"server/models"
+	"server/storage"
+)
+
+const (
+	// Memory used for a multipart upload before it is spooled to disk
+	uploadMemory = 1 << 20
+	// Room left for the multipart headers on top of the file size
+	uploadOverhead = 64 << 10
+	// Longest file name kept, in bytes
+	maxFilenameLength = 255
+)
+
+// Media types accepted as question attachments, detected from the content
+var attachmentTypes = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+	"text/plain":      true,
+}
+
+// File read from the `file` part of a multipart upload, hashed and checked
+type upload struct {
+	models.Blob
+
+	File     multipart.File
+	Filename string
+
+	form *multipart.Form
+}
+
+// Closes the file and removes its temporary copy
+func (u *upload) Close() {
+	u.File.Close()
+	_ = u.form.RemoveAll()
+}
+
+// Reads the `file` part of a multipart upload, writing an error if it is larger than `maxSize`
+// or its content is not one of `allowedTypes`. The caller closes the upload
+func readUpload(w http.ResponseWriter, r *http.Request, maxSize int64, allowedTypes map[string]bool) (*upload, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+uploadOverhead)
+
+	err := r.ParseMultipartForm(uploadMemory)
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		helpers.ErrorJSON(w, fmt.Errorf("The file must be at most %d bytes", maxSize), http.StatusRequestEntityTooLarge)
+		return nil, false
+	}
+
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Invalid multipart upload"), http.StatusBadRequest)
+		return nil, false
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		_ = r.MultipartForm.RemoveAll()
+		helpers.ErrorJSON(w, errors.New("file is required"), http.StatusBadRequest)
+		return nil, false
+	}
+
+	up := &upload{File: file, Filename: header.Filename, form: r.MultipartForm}
+	up.Size = header.Size
+
+	fail := func(err error, status int) (*upload, bool) {
+		up.Close()
+		helpers.ErrorJSON(w, err, status)
+		return nil, false
+	}
+
+	if up.Size > maxSize {
+		return fail(fmt.Errorf("The file must be at most %d bytes", maxSize), http.StatusRequestEntityTooLarge)
+	}
+
+	if up.Size == 0 {
+		return fail(errors.New("The file is empty"), http.StatusBadRequest)
+	}
+
+	// The declared type is ignored, only what the content looks like counts
+	sniffed := make([]byte, 512)
+	n, err := io.ReadFull(file, sniffed)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return fail(errors.New("Error reading the file"), http.StatusBadRequest)
+	}
+
+	up.ContentType = http.DetectContentType(sniffed[:n])
+
+	mediaType, _, _ := mime.ParseMediaType(up.ContentType)
+	if !allowedTypes[mediaType] {
+		return fail(fmt.Errorf("Files of type %s are not accepted", mediaType), http.StatusUnsupportedMediaType)
+	}
+
+	hash := sha256.New()
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fail(errors.New("Error reading the file"), http.StatusBadRequest)
+	}
+	if _, err := io.Copy(hash, file); err != nil {
+		return fail(errors.New("Error reading the file"), http.StatusBadRequest)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fail(errors.New("Error reading the file"), http.StatusBadRequest)
+	}
+
+	up.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	if up.Filename == "" {
+		up.Filename = "file"
+	}
+	if len(up.Filename) > maxFilenameLength {
+		up.Filename = strings.ToValidUTF8(up.Filename[:maxFilenameLength], "")
+	}
+
+	return up, true
+}
+
+// Stores the uploaded file unless identical content is already stored
+// The blob is touched first so the purge can't delete the file before it is referenced
+func storeUpload(r *http.Request, up *upload) error {
+	if err := blob.Touch(up.Blob); err != nil {
+		return err
+	}
+
+	key := storage.HashKey(up.SHA256)
+
+	exists, err := storage.Store().Exists(r.Context(), key)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return nil
+	}
+
+	return storage.Store().Put(r.Context(), key, up.File, up.Size, up.ContentType)
+}
+
+var blob models.Blob
+
+// Sets the signed download URL of the blob
+func signBlob(r *http.Request, blob *models.Blob) error {
+	ttl := env.DefaultConfig.STORAGE.URL_TTL
+
+	url, err := storage.Store().SignedURL(r.Context(), storage.HashKey(blob.SHA256), ttl)
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+	blob.URL, blob.URLExpiresAt = url, &expiresAt
+
+	return nil
+}
+
+// Download File
+//
+//	@Summary      Download File
+//	@Description  Download an uploaded file with a signed URL returned by the API. Only used by the local storage backend.
+//	@Tags         files
+//	@Param key path string true "File key"
+//	@Param expires query int true "Expiry, Unix time"
+//	@Param signature query string true "Signature"
+//	@Router       /api/v1/files/{key} [get]
+//	@Success 200
+//	@Failure 403 {object} string
+//	@Failure 404 {object} string
+func DownloadFile(w http.ResponseWriter, r *http.Request) {
+	local, ok := storage.Store().(*storage.LocalStore)
+	if !ok {
+		helpers.ErrorJSON(w, storage.ErrNotFound, http.StatusNotFound)
+		return
+	}
+
+	key := chi.URLParam(r, "*")
+
+	expires := r.URL.Query().Get("expires")
+
+	err := local.Verify(key, expires, r.URL.Query().Get("signature"))
+	if err != nil {
+		helpers.ErrorJSON(w, err, http.StatusForbidden)
+		return
+	}
+
+	body, err := local.Open(r.Context(), key)
+	if err != nil {
+		log.Info().Err(err).Msg("Error opening file")
+		helpers.ErrorJSON(w, storage.ErrNotFound, http.StatusNotFound)
+		return
+	}
+
+	defer body.Close()
+
+	content, ok := body.(io.ReadSeeker)
+	if !ok {
+		helpers.ErrorJSON(w, errors.New("Error reading the file"), http.StatusInternalServerError)
+		return
+	}
+
+	// Files are content addressed, they never change under the same key
+	// but are not cached longer than the URL is valid
+	unix, _ := strconv.ParseInt(expires, 10, 64)
+	maxAge := int64(time.Until(time.Unix(unix, 0)) / time.Second)
+	if maxAge < 0 {
+		maxAge = 0
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d, immutable", maxAge))
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	http.ServeContent(w, r, "", time.Time{}, content)
+}
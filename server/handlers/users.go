@@ -1,11 +1,15 @@
 package handlers
 
 import (
+	"bytes"
 	// "context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	// "time"
+	"io"
+	"mime"
+	"strings"
+	"time"
 
 	// "go/format"
 
@@ -14,32 +18,58 @@ import (
 	"net/http"
 
 	"server/authentication"
+	"server/authorization"
 	"server/helpers"
+	"server/mailer"
 	"server/middleware"
 	"server/models"
-	// "server/redis"
+	"server/redis"
 
+	jsonpatch "github.com/evanphx/json-patch/v5"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/validator/v10"
+	"github.com/gofrs/uuid"
 	"github.com/rs/zerolog/log"
 	// "server/types"
 	// "github.com/go-chi/chi/v5"
 )
 
-var user models.User
-
 // Get All Users
 //
 //	@Summary      Get all Users
-//	@Description  Get all Users
+//	@Description  Get a page of Users. Pages are linked by `next_cursor` and the `Link` header.
 //	@Tags         users
 //	@Accept       json
 //	@Produce      json
+//	@Param limit query int false "Page size, 1-100" default(20)
+//	@Param cursor query string false "Cursor returned as next_cursor"
+//	@Param name query string false "Name prefix"
+//	@Param email query string false "Email, matched exactly"
+//	@Param email_prefix query string false "Email prefix"
+//	@Param created_after query string false "RFC 3339 timestamp, inclusive"
+//	@Param created_before query string false "RFC 3339 timestamp, exclusive"
+//	@Param sort query string false "created_at, name or email, prefixed with - for descending order" default(created_at)
+//	@Security     BearerAuth
 //	@Router       /api/v1/users [get]
-//	@Success 200 {array} models.User
+//	@Success 200 {object} types.Page{data=[]models.PublicUser}
+//	@Failure 400 {object} string
 //	@Failure 500 {object} string
 func GetAllUsers(w http.ResponseWriter, r *http.Request) {
-	users, err := user.FindAll()
+	var userModel models.User
+
+	params, err := parseUserListParams(r)
+
+	if err != nil {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	users, next, err := userModel.List(params)
+
+	if errors.Is(err, models.ErrInvalidCursor) {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
 
 	if err != nil {
 		log.Error().Err(err).Msg("Error getting users")
@@ -47,10 +77,58 @@ func GetAllUsers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	//save to cache
-	middleware.SaveToCache(r, users)
+	var cursor string
+	if next != nil {
+		cursor = next.Encode()
+	}
+
+	helpers.WritePage(w, r, models.PublicUsers(users), cursor)
+}
+
+// Parses the pagination, filter and sort query parameters of a user listing
+func parseUserListParams(r *http.Request) (models.UserListParams, error) {
+	query := r.URL.Query()
+
+	params := models.UserListParams{
+		NamePrefix:  query.Get("name"),
+		Email:       query.Get("email"),
+		EmailPrefix: query.Get("email_prefix"),
+		Sort:        query.Get("sort"),
+	}
+
+	limit, err := helpers.ParseLimit(r, models.MaxPageLimit)
+	if err != nil {
+		return params, err
+	}
+	params.Limit = limit
+
+	if params.Email != "" && validator.New().Var(params.Email, "email") != nil {
+		return params, errors.New("email must be a valid email address")
+	}
+
+	if params.Sort != "" && !models.ValidUserSort(params.Sort) {
+		return params, errors.New("sort must be one of created_at, name or email, optionally prefixed with -")
+	}
+
+	if raw := query.Get("cursor"); raw != "" {
+		cursor, err := models.DecodeCursor(raw)
+		if err != nil {
+			return params, err
+		}
+		params.Cursor = cursor
+	}
+
+	for key, target := range map[string]**time.Time{"created_after": &params.CreatedAfter, "created_before": &params.CreatedBefore} {
+		if raw := query.Get(key); raw != "" {
+			value, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return params, fmt.Errorf("%s must be an RFC 3339 timestamp", key)
+			}
+			*target = &value
+		}
+	}
 
-	helpers.WriteJSON(w, http.StatusOK, users)
+	return params, nil
 }
 
 // Create User
@@ -60,11 +138,37 @@ func GetAllUsers(w http.ResponseWriter, r *http.Request) {
 //	@Tags         users
 //	@Accept       json
 //	@Produce      json
+//	@Param user body models.CreateUserInput true "User"
+//	@Security     BearerAuth
 //	@Router       /api/v1/users [post]
-//	@Success 200 {object} models.User
+//	@Success 200 {object} models.PublicUser
+//	@Failure 401 {object} string
+//	@Failure 403 {object} string
 //	@Failure 500 {object} string
 func CreateUser(w http.ResponseWriter, r *http.Request) {
-	var userData models.User
+	createUser(w, r)
+}
+
+// Register
+//
+//	@Summary      Register
+//	@Description  Self-registration, only available when $SELF_REGISTRATION is enabled
+//	@Tags         users
+//	@Accept       json
+//	@Produce      json
+//	@Param user body models.CreateUserInput true "User"
+//	@Router       /api/v1/register [post]
+//	@Success 200 {object} models.PublicUser
+//	@Failure 400 {object} string
+//	@Failure 500 {object} string
+func Register(w http.ResponseWriter, r *http.Request) {
+	createUser(w, r)
+}
+
+func createUser(w http.ResponseWriter, r *http.Request) {
+	var userModel models.User
+
+	var userData models.CreateUserInput
 
 	// log.Info().Msgf("Body: %t", r.Body)
 
@@ -72,14 +176,14 @@ func CreateUser(w http.ResponseWriter, r *http.Request) {
 	// body, err := ioutil.ReadAll(r.Body)
 	// err = json.Unmarshal(body, &userData)
 
-	log.Info().Msgf("userData: %v", userData)
-
 	if err != nil {
 		log.Error().Err(err).Msg("Error decoding JSON")
 		helpers.ErrorJSON(w, err, http.StatusBadRequest)
 		return
 	}
 
+	userData.Email = helpers.NormalizeEmail(userData.Email)
+
 	validate := validator.New()
 
 	err = validate.Struct(userData)
@@ -107,7 +211,12 @@ func CreateUser(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	newUser, err := user.Create(userData)
+	newUser, err := userModel.Create(userData.User())
+
+	if errors.Is(err, models.ErrDuplicateEmail) {
+		helpers.ErrorJSON(w, err, http.StatusConflict)
+		return
+	}
 
 	if err != nil {
 		log.Error().Err(err).Msg("Error creating user")
@@ -119,22 +228,26 @@ func CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	helpers.WriteJSON(w, http.StatusOK, newUser)
+	helpers.WriteJSON(w, http.StatusOK, newUser.Public())
 }
 
 // Find User By Email
 //
 //	@Summary      Find User By Email
-//	@Description  Find User By Email
+//	@Description  Deprecated, use `GET /api/v1/users?email=` or `GET /api/v1/users/{id}`
 //	@Tags         users
+//	@Deprecated
 //	@Accept       json
 //	@Produce      json
+//	@Security     BearerAuth
 //	@Router       /api/v1/users/{email} [get]
 //	@Param email path string true "Email"
-//	@Success 200 {object} models.User
+//	@Success 200 {object} models.PublicUser
 //	@Failure 500 {object} string
 func FindUserByEmail(w http.ResponseWriter, r *http.Request) {
-	email := chi.URLParam(r, "email")
+	var userModel models.User
+
+	email := helpers.NormalizeEmail(chi.URLParam(r, "email"))
 
 	// queryParams := r.URL.Query()
 
@@ -151,7 +264,7 @@ func FindUserByEmail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := user.FindByEmail(email)
+	user, err := userModel.FindByEmail(email)
 
 	if err != nil {
 		log.Error().Err(err).Msg("Error finding user")
@@ -159,23 +272,27 @@ func FindUserByEmail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	helpers.WriteJSON(w, http.StatusOK, user)
+	helpers.WriteJSON(w, http.StatusOK, user.Public())
 }
 
 // Update User By Email
 //
 //	@Summary      Update User By Email
-//	@Description  Update User By Email
+//	@Description  Deprecated, use `PATCH /api/v1/users/{id}`. Only the name can be changed, the password through `POST /api/v1/me/password`
 //	@Tags         users
+//	@Deprecated
 //	@Accept       json
 //	@Produce      json
-//	@Param email path string true "Email"
-//	@Param user body models.User true "User"
+//	@Param user body models.UpdateUserInput true "User"
+//	@Security     BearerAuth
 //	@Router       /api/v1/users [put]
-//	@Success 200 {object} models.User
+//	@Success 200 {object} models.PublicUser
+//	@Failure 400 {object} string
 //	@Failure 500 {object} string
 func UpdateUserByEmail(w http.ResponseWriter, r *http.Request) {
-	var userData models.User
+	var userModel models.User
+
+	var userData models.UpdateUserInput
 
 	err := json.NewDecoder(r.Body).Decode(&userData)
 
@@ -185,6 +302,8 @@ func UpdateUserByEmail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	userData.Email = helpers.NormalizeEmail(userData.Email)
+
 	validate := validator.New()
 
 	err = validate.Struct(userData)
@@ -212,7 +331,18 @@ func UpdateUserByEmail(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	err = user.UpdateByEmail(userData)
+	principal, ok := authorization.FromContext(r.Context())
+	if !ok || !principal.CanManageUser(uuid.Nil, userData.Email) {
+		helpers.ErrorJSON(w, errors.New("You can only update your own user"), http.StatusForbidden)
+		return
+	}
+
+	if userData.Password != "" {
+		helpers.ErrorJSON(w, errors.New("Use POST /api/v1/me/password to change the password"), http.StatusBadRequest)
+		return
+	}
+
+	err = userModel.UpdateByEmail(userData.User())
 
 	if err != nil {
 		log.Error().Err(err).Msg("Error updating user")
@@ -220,7 +350,142 @@ func UpdateUserByEmail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_ = helpers.WriteJSON(w, http.StatusOK, user)
+	updatedUser, err := userModel.FindByEmail(userData.Email)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error finding user")
+		helpers.ErrorJSON(w, errors.New("No user found"), http.StatusInternalServerError)
+		return
+	}
+
+	_ = helpers.WriteJSON(w, http.StatusOK, updatedUser.Public())
+}
+
+// Get User
+//
+//	@Summary      Get User
+//	@Description  Get a User by ID
+//	@Tags         users
+//	@Produce      json
+//	@Param id path string true "User ID"
+//	@Security     BearerAuth
+//	@Router       /api/v1/users/{id} [get]
+//	@Success 200 {object} models.PublicUser
+//	@Failure 400 {object} string
+//	@Failure 404 {object} string
+func GetUser(w http.ResponseWriter, r *http.Request) {
+	var userModel models.User
+
+	id, err := uuid.FromString(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Invalid user ID"), http.StatusBadRequest)
+		return
+	}
+
+	user, err := userModel.FindByID(id)
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("No user found"), http.StatusNotFound)
+		return
+	}
+
+	_ = helpers.WriteJSON(w, http.StatusOK, user.Public())
+}
+
+// Delete User
+//
+//	@Summary      Delete User
+//	@Description  Soft delete a User and revoke its tokens. It is purged with its questions after the retention period.
+//	@Tags         users
+//	@Param id path string true "User ID"
+//	@Security     BearerAuth
+//	@Router       /api/v1/users/{id} [delete]
+//	@Success 204
+//	@Failure 400 {object} string
+//	@Failure 404 {object} string
+func DeleteUser(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.FromString(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Invalid user ID"), http.StatusBadRequest)
+		return
+	}
+
+	deleteUser(w, id)
+}
+
+// Soft deletes the user with the given ID and revokes its tokens
+func deleteUser(w http.ResponseWriter, id uuid.UUID) {
+	var userModel models.User
+
+	current, err := userModel.FindByID(id)
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("No user found"), http.StatusNotFound)
+		return
+	}
+
+	err = userModel.DeleteByID(id)
+	if err != nil {
+		log.Error().Err(err).Msg("Error deleting user")
+		helpers.ErrorJSON(w, errors.New("Error deleting user"), http.StatusInternalServerError)
+		return
+	}
+
+	// Revoke the refresh token, stored under the user's email
+	_ = redis.DeleteCache(current.Email)
+	_ = middleware.InvalidateAuthStatus(current.Email)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Restore User
+//
+//	@Summary      Restore User
+//	@Description  Restore a soft deleted User that has not been purged yet
+//	@Tags         admin
+//	@Produce      json
+//	@Param id path string true "User ID"
+//	@Security     BearerAuth
+//	@Router       /api/v1/admin/users/{id}/restore [post]
+//	@Success 200 {object} models.PublicUser
+//	@Failure 400 {object} string
+//	@Failure 404 {object} string
+//	@Failure 409 {object} string
+func RestoreUser(w http.ResponseWriter, r *http.Request) {
+	var userModel models.User
+
+	id, err := uuid.FromString(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Invalid user ID"), http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := userModel.FindDeletedByID(id)
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("No deleted user found"), http.StatusNotFound)
+		return
+	}
+
+	// The email may have been taken since the user was deleted
+	var existing models.User
+	if _, err := existing.FindByEmail(deleted.Email); err == nil {
+		helpers.ErrorJSON(w, models.ErrDuplicateEmail, http.StatusConflict)
+		return
+	}
+
+	restored, err := userModel.Restore(id)
+	if errors.Is(err, models.ErrDuplicateEmail) {
+		helpers.ErrorJSON(w, err, http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error restoring user")
+		helpers.ErrorJSON(w, errors.New("Error restoring user"), http.StatusInternalServerError)
+		return
+	}
+
+	_ = middleware.InvalidateAuthStatus(restored.Email)
+
+	_ = helpers.WriteJSON(w, http.StatusOK, restored.Public())
 }
 
 // Check User Password
@@ -236,6 +501,8 @@ func UpdateUserByEmail(w http.ResponseWriter, r *http.Request) {
 //	@Failure 400 {object} string
 //	@Failure 429 {object} string
 func CheckUserPassword(w http.ResponseWriter, r *http.Request) {
+	var userModel models.User
+
 	var userAuthData authentication.UserAuth
 
 	err := json.NewDecoder(r.Body).Decode(&userAuthData)
@@ -273,7 +540,7 @@ func CheckUserPassword(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	currentUser, err := user.FindByEmail(userAuthData.UserName)
+	currentUser, err := userModel.FindByEmail(userAuthData.UserName)
 	if err != nil {
 		log.Error().Err(err).Msg("Error finding user")
 		helpers.ErrorJSON(w, errors.New("No user found"), http.StatusInternalServerError)
@@ -289,3 +556,249 @@ func CheckUserPassword(w http.ResponseWriter, r *http.Request) {
 
 	_ = helpers.WriteJSON(w, http.StatusOK, "Password Verified")
 }
+
+// How long an email verification link stays valid
+const emailVerificationTTL = 24 * time.Hour
+
+const emailVerificationKeyPrefix = "email:verify:"
+
+// Email change persisted until the new address is verified
+type emailVerification struct {
+	UserID   uuid.UUID `json:"user_id"`
+	OldEmail string    `json:"old_email"`
+	Email    string    `json:"email"`
+}
+
+// Patch User
+//
+//	@Summary      Patch User
+//	@Description  Partially update a User with a JSON Merge Patch (RFC 7396) or a JSON Patch (RFC 6902).
+//	@Description  The patched document has `name`, `email` and a write-only `password`.
+//	@Description  Only admins may set the password of another User, Users change their own with `POST /api/v1/me/password`.
+//	@Description  Passwords are hashed and revoke existing tokens. Email changes only apply once the new address is verified.
+//	@Tags         users
+//	@Accept       application/merge-patch+json
+//	@Accept       application/json-patch+json
+//	@Produce      json
+//	@Param id path string true "User ID"
+//	@Param patch body object true "Merge patch or JSON patch"
+//	@Security     BearerAuth
+//	@Router       /api/v1/users/{id} [patch]
+//	@Success 200 {object} models.PublicUser
+//	@Failure 400 {object} string
+//	@Failure 404 {object} string
+//	@Failure 409 {object} string
+//	@Failure 415 {object} string
+func PatchUser(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.FromString(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Invalid user ID"), http.StatusBadRequest)
+		return
+	}
+
+	// Users prove they know their current password at POST /api/v1/me/password
+	principal, ok := authorization.FromContext(r.Context())
+	allowPassword := ok && principal.HasRole(authorization.RoleAdmin) && principal.UserID != id
+
+	patchUser(w, r, id, allowPassword)
+}
+
+// Patches the user with the given ID, rejecting password changes unless `allowPassword` is set
+func patchUser(w http.ResponseWriter, r *http.Request, id uuid.UUID, allowPassword bool) {
+	var userModel models.User
+
+	current, err := userModel.FindByID(id)
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("No user found"), http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1048576))
+	if err != nil {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	original, _ := json.Marshal(models.UserPatchDocument{Name: current.Name, Email: current.Email})
+
+	patched, status, err := applyPatch(r.Header.Get("Content-Type"), original, body)
+	if err != nil {
+		helpers.ErrorJSON(w, err, status)
+		return
+	}
+
+	var document models.UserPatchDocument
+
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+
+	err = decoder.Decode(&document)
+	if err != nil {
+		helpers.ErrorJSON(w, fmt.Errorf("Invalid patch: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	document.Email = helpers.NormalizeEmail(document.Email)
+
+	err = helpers.ValidateStruct(document)
+	if err != nil {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	var patch models.UserPatch
+
+	if document.Name != current.Name {
+		patch.Name = &document.Name
+	}
+
+	if document.Password != nil && !allowPassword {
+		helpers.ErrorJSON(w, errors.New("Use POST /api/v1/me/password to change the password"), http.StatusBadRequest)
+		return
+	}
+
+	patch.Password = document.Password
+
+	emailChanged := !strings.EqualFold(document.Email, current.Email)
+	if emailChanged {
+		var existing models.User
+		if _, err := existing.FindByEmail(document.Email); err == nil {
+			helpers.ErrorJSON(w, models.ErrDuplicateEmail, http.StatusConflict)
+			return
+		}
+
+		patch.PendingEmail = &document.Email
+	}
+
+	updatedUser, err := userModel.Patch(id, patch)
+	if err != nil {
+		log.Error().Err(err).Msg("Error patching user")
+		helpers.ErrorJSON(w, errors.New("Error updating user"), http.StatusInternalServerError)
+		return
+	}
+
+	if patch.Password != nil {
+		_ = middleware.InvalidateAuthStatus(current.Email)
+	}
+
+	if emailChanged {
+		err = sendEmailVerification(emailVerification{UserID: id, OldEmail: current.Email, Email: document.Email})
+		if err != nil {
+			log.Error().Err(err).Msg("Error sending email verification")
+			helpers.ErrorJSON(w, errors.New("Error sending email verification"), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	_ = helpers.WriteJSON(w, http.StatusOK, updatedUser.Public())
+}
+
+// Applies a merge patch or JSON patch, depending on the content type
+// Returns the HTTP status to fail with on error
+func applyPatch(contentType string, original []byte, patch []byte) ([]byte, int, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	switch mediaType {
+	case "application/merge-patch+json", "application/json", "":
+		patched, err := jsonpatch.MergePatch(original, patch)
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("Invalid merge patch: %v", err)
+		}
+
+		return patched, http.StatusOK, nil
+	case "application/json-patch+json":
+		decoded, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("Invalid JSON patch: %v", err)
+		}
+
+		patched, err := decoded.Apply(original)
+		if errors.Is(err, jsonpatch.ErrTestFailed) {
+			return nil, http.StatusConflict, errors.New("JSON patch test operation failed")
+		}
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("Invalid JSON patch: %v", err)
+		}
+
+		return patched, http.StatusOK, nil
+	default:
+		return nil, http.StatusUnsupportedMediaType, errors.New("Content-Type must be application/merge-patch+json or application/json-patch+json")
+	}
+}
+
+// Emails a single use verification token to the new address
+func sendEmailVerification(verification emailVerification) error {
+	token, err := helpers.RandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	payload, _ := json.Marshal(verification)
+
+	err = redis.SetCache(emailVerificationKeyPrefix+token, string(payload), emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	return mailer.Send(mailer.Message{
+		To:      verification.Email,
+		Subject: "Verify your new email address",
+		Body:    fmt.Sprintf("Confirm your new email address with this token, it expires in 24 hours: %s", token),
+	})
+}
+
+// Verify Email
+//
+//	@Summary      Verify Email
+//	@Description  Applies a pending email change with the token sent to the new address
+//	@Tags         users
+//	@Accept       json
+//	@Produce      json
+//	@Param verification body object{token=string} true "Verification token"
+//	@Router       /api/v1/users/verify-email [post]
+//	@Success 200 {object} models.PublicUser
+//	@Failure 400 {object} string
+func VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var userModel models.User
+
+	body := struct {
+		Token string `json:"token" validate:"required"`
+	}{}
+
+	err := helpers.ReadJSON(w, r, &body)
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Invalid JSON"), http.StatusBadRequest)
+		return
+	}
+
+	err = helpers.ValidateStruct(body)
+	if err != nil {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// Tokens are single use
+	cached, _ := redis.GetCache(emailVerificationKeyPrefix + body.Token)
+	_ = redis.DeleteCache(emailVerificationKeyPrefix + body.Token)
+
+	var verification emailVerification
+	if cached == "" || json.Unmarshal([]byte(cached), &verification) != nil {
+		helpers.ErrorJSON(w, errors.New("Invalid or expired token"), http.StatusBadRequest)
+		return
+	}
+
+	updatedUser, err := userModel.ConfirmEmail(verification.UserID, verification.Email)
+	if errors.Is(err, models.ErrDuplicateEmail) {
+		helpers.ErrorJSON(w, err, http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	_ = middleware.InvalidateAuthStatus(verification.OldEmail)
+
+	_ = helpers.WriteJSON(w, http.StatusOK, updatedUser.Public())
+}
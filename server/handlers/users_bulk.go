@@ -0,0 +1,395 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"server/helpers"
+	"server/models"
+)
+
+// Largest accepted import body
+const maxImportBytes = 32 << 20
+
+// Outcome of a single imported row
+type importResult struct {
+	Line   int    `json:"line"`
+	Email  string `json:"email,omitempty"`
+	Status string `json:"status"` // created, valid (dry run), exists, duplicate or invalid
+	Error  string `json:"error,omitempty"`
+}
+
+// Last line of an import response
+type importSummary struct {
+	Total     int    `json:"total"`
+	Created   int    `json:"created"`
+	Exists    int    `json:"exists"`
+	Duplicate int    `json:"duplicate"`
+	Invalid   int    `json:"invalid"`
+	DryRun    bool   `json:"dry_run"`
+	Committed bool   `json:"committed"`
+	Error     string `json:"error,omitempty"`
+}
+
+// A parsed import row, err is set if the row could not be parsed
+type importRow struct {
+	line  int
+	input models.ImportUserInput
+	err   error
+}
+
+// Import Users
+//
+//	@Summary      Import Users
+//	@Description  Bulk create Users from CSV (`name,email,password` header, password optional) or NDJSON.
+//	@Description  The body, at most 32 MiB, is read first, then one NDJSON result per row is streamed followed by a summary. Rows are inserted in batches
+//	@Description  within a single transaction, which is rolled back on errors and in dry runs.
+//	@Tags         admin
+//	@Accept       text/csv
+//	@Accept       application/x-ndjson
+//	@Produce      application/x-ndjson
+//	@Param dry_run query bool false "Validate without creating users"
+//	@Security     BearerAuth
+//	@Router       /api/v1/admin/users/import [post]
+//	@Success 200 {object} importResult
+//	@Failure 400 {object} string
+//	@Failure 413 {object} string
+//	@Failure 415 {object} string
+func ImportUsers(w http.ResponseWriter, r *http.Request) {
+	var userModel models.User
+
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	if mediaType != "text/csv" && mediaType != "application/x-ndjson" && mediaType != "application/ndjson" {
+		helpers.ErrorJSON(w, errors.New("Content-Type must be text/csv or application/x-ndjson"), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	// The body is read before results are streamed, net/http discards what is
+	// left of it once an HTTP/1.x response has started
+	content, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportBytes))
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		helpers.ErrorJSON(w, fmt.Errorf("The import must be at most %d bytes", maxImportBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Error reading the import"), http.StatusBadRequest)
+		return
+	}
+
+	body := bytes.NewReader(content)
+
+	var next func() (*importRow, error)
+
+	if mediaType == "text/csv" {
+		next, err = csvImportRows(body)
+	} else {
+		next = ndjsonImportRows(body)
+	}
+
+	if err != nil {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	userImport, err := userModel.BeginImport(dryRun)
+	if err != nil {
+		log.Error().Err(err).Msg("Error starting import")
+		helpers.ErrorJSON(w, errors.New("Error starting import"), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	stream := newNDJSONStream(w)
+	summary := importSummary{DryRun: dryRun}
+
+	seen := map[string]bool{}
+	var batch []models.User
+	var batchRows []importResult
+
+	flush := func() error {
+		inserted, err := userImport.Insert(batch)
+		if err != nil {
+			return err
+		}
+
+		for _, result := range batchRows {
+			switch {
+			case !inserted[result.Email]:
+				result.Status = "exists"
+				result.Error = models.ErrDuplicateEmail.Error()
+				summary.Exists++
+			case dryRun:
+				result.Status = "valid"
+				summary.Created++
+			default:
+				result.Status = "created"
+				summary.Created++
+			}
+
+			stream.Write(result)
+		}
+
+		batch, batchRows = batch[:0], batchRows[:0]
+
+		return nil
+	}
+
+	for err == nil {
+		var row *importRow
+
+		row, err = next()
+		if err != nil || row == nil {
+			break
+		}
+
+		summary.Total++
+		result := importResult{Line: row.line, Email: helpers.NormalizeEmail(row.input.Email)}
+
+		if row.err == nil {
+			row.input.Email = result.Email
+			row.err = helpers.ValidateStruct(row.input)
+		}
+
+		if row.err != nil {
+			result.Status = "invalid"
+			result.Error = strings.TrimSpace(row.err.Error())
+			summary.Invalid++
+			stream.Write(result)
+			continue
+		}
+
+		if seen[result.Email] {
+			result.Status = "duplicate"
+			result.Error = "Email appears earlier in the import"
+			summary.Duplicate++
+			stream.Write(result)
+			continue
+		}
+
+		seen[result.Email] = true
+		batch = append(batch, models.User{Name: row.input.Name, Email: row.input.Email, Password: row.input.Password})
+		batchRows = append(batchRows, result)
+
+		if len(batch) >= models.ImportBatchSize {
+			err = flush()
+		}
+	}
+
+	if err == nil {
+		err = flush()
+	}
+
+	if err != nil || dryRun {
+		_ = userImport.Rollback()
+	} else {
+		err = userImport.Commit()
+		summary.Committed = err == nil
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error importing users")
+		summary.Error = err.Error()
+	}
+
+	stream.Write(struct {
+		Summary importSummary `json:"summary"`
+	}{summary})
+}
+
+// Reads CSV rows, columns are looked up by the names in the header
+func csvImportRows(body io.Reader) (func() (*importRow, error), error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("Invalid CSV header: %v", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	for _, required := range []string{"name", "email"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("The CSV header must have a %s column", required)
+		}
+	}
+
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	return func() (*importRow, error) {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+
+		line, _ := reader.FieldPos(0)
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return &importRow{line: parseErr.Line, err: parseErr.Err}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return &importRow{
+			line: line,
+			input: models.ImportUserInput{
+				Name:     field(record, "name"),
+				Email:    field(record, "email"),
+				Password: field(record, "password"),
+			},
+		}, nil
+	}, nil
+}
+
+// Reads one JSON object per line, blank lines are skipped
+func ndjsonImportRows(body io.Reader) func() (*importRow, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+
+	line := 0
+
+	return func() (*importRow, error) {
+		for scanner.Scan() {
+			line++
+
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+
+			row := &importRow{line: line}
+
+			decoder := json.NewDecoder(strings.NewReader(text))
+			decoder.DisallowUnknownFields()
+			row.err = decoder.Decode(&row.input)
+
+			return row, nil
+		}
+
+		return nil, scanner.Err()
+	}
+}
+
+// Writes NDJSON values, flushing each one to the client
+type ndjsonStream struct {
+	encoder *json.Encoder
+	flusher http.Flusher
+}
+
+func newNDJSONStream(w http.ResponseWriter) *ndjsonStream {
+	flusher, _ := w.(http.Flusher)
+
+	return &ndjsonStream{encoder: json.NewEncoder(w), flusher: flusher}
+}
+
+func (s *ndjsonStream) Write(value interface{}) {
+	if err := s.encoder.Encode(value); err != nil {
+		log.Error().Err(err).Msg("Error streaming response")
+		return
+	}
+
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+}
+
+// Export Users
+//
+//	@Summary      Export Users
+//	@Description  Stream every User as CSV or NDJSON
+//	@Tags         admin
+//	@Produce      text/csv
+//	@Produce      application/x-ndjson
+//	@Param format query string false "csv or ndjson" default(ndjson)
+//	@Security     BearerAuth
+//	@Router       /api/v1/admin/users/export [get]
+//	@Success 200 {object} models.PublicUser
+//	@Failure 400 {object} string
+func ExportUsers(w http.ResponseWriter, r *http.Request) {
+	var userModel models.User
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "ndjson"
+	}
+
+	filename := fmt.Sprintf("users-%s.%s", time.Now().UTC().Format("20060102T150405Z"), format)
+
+	var write func(user *models.User) error
+	var done func() error
+
+	switch format {
+	case "ndjson":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		encoder := json.NewEncoder(w)
+
+		write = func(user *models.User) error { return encoder.Encode(user.Public()) }
+		done = func() error { return nil }
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		writer := csv.NewWriter(w)
+
+		write = func(user *models.User) error {
+			return writer.Write([]string{
+				user.ID.String(),
+				user.Name,
+				user.Email,
+				user.CreatedAt.Format(time.RFC3339),
+				user.UpdatedAt.Format(time.RFC3339),
+			})
+		}
+		done = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+
+		_ = writer.Write([]string{"id", "name", "email", "created_at", "updated_at"})
+	default:
+		helpers.ErrorJSON(w, errors.New("format must be csv or ndjson"), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.WriteHeader(http.StatusOK)
+
+	err := userModel.Export(write)
+	if err == nil {
+		err = done()
+	}
+
+	// The status was sent already, the truncated body is all the client gets
+	if err != nil {
+		log.Error().Err(err).Msg("Error exporting users")
+	}
+}
@@ -0,0 +1,180 @@
+package handlers_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+
+	"server/handlers"
+	"server/models"
+)
+
+// Decodes every line of an NDJSON import response, the last being the summary
+func readImportResponse(t *testing.T, body string) ([]handlers.ImportResult, handlers.ImportSummary) {
+	var results []handlers.ImportResult
+	var summary handlers.ImportSummary
+
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		var line struct {
+			handlers.ImportResult
+			Summary *handlers.ImportSummary `json:"summary"`
+		}
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+
+		if line.Summary != nil {
+			summary = *line.Summary
+			continue
+		}
+
+		results = append(results, line.ImportResult)
+	}
+
+	return results, summary
+}
+
+func TestImportUsersCSV(t *testing.T) {
+	mock := setupUserTest(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO users \(name, email, password, created_at, updated_at\) VALUES \(\$2, \$3, \$4, \$1, \$1\), \(\$5, \$6, \$7, \$1, \$1\) ON CONFLICT`).
+		WithArgs(sqlmock.AnyArg(), "Alice", "alice@example.com", bcryptHash{"secret"}, "Bob", "bob@example.com", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("alice@example.com"))
+	mock.ExpectCommit()
+
+	csv := "name,email,password\n" +
+		"Alice,Alice@Example.com,secret\n" +
+		"Bob,bob@example.com,\n" +
+		"Nobody,not-an-email,secret\n" +
+		"Alice Again,alice@example.com,secret\n"
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/users/import", strings.NewReader(csv))
+	req.Header.Set("Content-Type", "text/csv")
+
+	rec := httptest.NewRecorder()
+	handlers.ImportUsers(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	results, summary := readImportResponse(t, rec.Body.String())
+
+	statuses := map[int]string{}
+	for _, result := range results {
+		statuses[result.Line] = result.Status
+	}
+
+	assert.Equal(t, map[int]string{2: "created", 3: "exists", 4: "invalid", 5: "duplicate"}, statuses)
+	assert.Equal(t, handlers.ImportSummary{Total: 4, Created: 1, Exists: 1, Duplicate: 1, Invalid: 1, Committed: true}, summary)
+}
+
+func TestImportUsersDryRun(t *testing.T) {
+	mock := setupUserTest(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO users").WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("alice@example.com"))
+	mock.ExpectRollback()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/users/import?dry_run=true",
+		strings.NewReader(`{"name": "Alice", "email": "alice@example.com"}`+"\n\n"+`{"name": "Bob", "email": "bob@example.com", "role": "admin"}`))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	rec := httptest.NewRecorder()
+	handlers.ImportUsers(rec, req)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	results, summary := readImportResponse(t, rec.Body.String())
+	assert.Len(t, results, 2)
+	assert.Equal(t, handlers.ImportSummary{Total: 2, Created: 1, Invalid: 1, DryRun: true}, summary)
+}
+
+func TestImportUsersRejectsUnknownFormat(t *testing.T) {
+	setupUserTest(t)
+
+	for _, body := range []struct{ contentType, body string }{
+		{"application/json", `[]`},
+		{"text/csv", "username,password\n"},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/users/import", strings.NewReader(body.body))
+		req.Header.Set("Content-Type", body.contentType)
+
+		rec := httptest.NewRecorder()
+		handlers.ImportUsers(rec, req)
+
+		assert.NotEqual(t, http.StatusOK, rec.Code, body.contentType)
+	}
+}
+
+func TestExportUsersCSV(t *testing.T) {
+	mock := setupUserTest(t)
+
+	created := time.Date(2023, time.October, 2, 9, 30, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE deleted_at IS NULL ORDER BY created_at, id").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "created_at", "updated_at", "reputation"}).
+			AddRow(testUserID, "Alice", "alice@example.com", created, created, 0))
+
+	rec := httptest.NewRecorder()
+	handlers.ExportUsers(rec, httptest.NewRequest(http.MethodGet, "/api/v1/admin/users/export?format=csv", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/csv", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "id,name,email,created_at,updated_at\n"+
+		testUserID+",Alice,alice@example.com,2023-10-02T09:30:00Z,2023-10-02T09:30:00Z\n", rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Results stream after the body is read, through a real server rather than a recorder
+// The dry run keeps the test fast, passwords are only hashed when the import is committed
+func TestImportUsersOverHTTP(t *testing.T) {
+	mock := setupUserTest(t)
+
+	rows := models.ImportBatchSize + 100
+
+	var body strings.Builder
+	body.WriteString("name,email\n")
+	body.WriteString("Nobody,not-an-email\n")
+	for i := 0; i < rows; i++ {
+		fmt.Fprintf(&body, "User %d,user%d@example.com\n", i, i)
+	}
+
+	inserted := func(from int, to int) *sqlmock.Rows {
+		emails := sqlmock.NewRows([]string{"email"})
+		for i := from; i < to; i++ {
+			emails.AddRow(fmt.Sprintf("user%d@example.com", i))
+		}
+		return emails
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO users").WillReturnRows(inserted(0, models.ImportBatchSize))
+	mock.ExpectQuery("INSERT INTO users").WillReturnRows(inserted(models.ImportBatchSize, rows))
+	mock.ExpectRollback()
+
+	server := httptest.NewServer(http.HandlerFunc(handlers.ImportUsers))
+	t.Cleanup(server.Close)
+
+	resp, err := http.Post(server.URL+"?dry_run=true", "text/csv", strings.NewReader(body.String()))
+	if err != nil {
+		t.Fatalf("Error importing: %s", err)
+	}
+	defer resp.Body.Close()
+
+	response, _ := io.ReadAll(resp.Body)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	results, summary := readImportResponse(t, string(response))
+	assert.Len(t, results, rows+1)
+	assert.Equal(t, handlers.ImportSummary{Total: rows + 1, Created: rows, Invalid: 1, DryRun: true}, summary)
+}
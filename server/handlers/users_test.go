@@ -0,0 +1,485 @@
+package handlers_test
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgconn"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+
+	"server/authorization"
+	"server/handlers"
+	"server/helpers"
+	"server/models"
+	"server/redis"
+)
+
+const testUserID = "9b2c1e0e-6f55-4c4b-9a0b-3f1f4a8b2c11"
+
+// Sets up a mocked DB and an in-memory Redis for the handlers
+func setupUserTest(t *testing.T) sqlmock.Sqlmock {
+	dbMock, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating DB mock: %s", err)
+	}
+	t.Cleanup(func() { dbMock.Close() })
+
+	models.New(dbMock)
+
+	redisServer := miniredis.RunT(t)
+	redis.SetClient(goredis.NewClient(&goredis.Options{Addr: redisServer.Addr()}))
+
+	return mock
+}
+
+func userRow(t *testing.T, hash string) *sqlmock.Rows {
+	now := time.Now()
+
+	if hash == "" {
+		return sqlmock.NewRows([]string{"id", "name", "email", "created_at", "updated_at", "reputation"}).
+			AddRow(testUserID, "Alice", "alice@example.com", now, now, 15)
+	}
+
+	return sqlmock.NewRows([]string{"id", "name", "email", "password", "created_at", "updated_at", "reputation"}).
+		AddRow(testUserID, "Alice", "alice@example.com", hash, now, now, 15)
+}
+
+// Fails if any key of the decoded JSON document mentions a password
+func assertNoPasswordFields(t *testing.T, path string, value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if strings.Contains(strings.ToLower(key), "password") {
+				t.Errorf("response exposes %s.%s", path, key)
+			}
+
+			assertNoPasswordFields(t, path+"."+key, child)
+		}
+	case []interface{}:
+		for _, child := range v {
+			assertNoPasswordFields(t, path+"[]", child)
+		}
+	}
+}
+
+func TestUserEndpointsNeverExposePasswords(t *testing.T) {
+	admin := &authorization.Principal{UserID: uuid.FromStringOrNil(testUserID), Email: "alice@example.com", Roles: []string{authorization.RoleAdmin}}
+
+	hash, err := helpers.HashPassword("secret")
+	if err != nil {
+		t.Fatalf("Error hashing password: %s", err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		expect func(mock sqlmock.Sqlmock)
+	}{
+		{
+			name:   "list users",
+			method: http.MethodGet,
+			path:   "/api/v1/users",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT (.+) FROM users").WillReturnRows(userRow(t, ""))
+			},
+		},
+		{
+			name:   "create user",
+			method: http.MethodPost,
+			path:   "/api/v1/users",
+			body:   `{"name": "Alice", "email": "alice@example.com", "password": "secret"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("INSERT INTO users").WillReturnRows(userRow(t, ""))
+			},
+		},
+		{
+			name:   "find user by email",
+			method: http.MethodGet,
+			path:   "/api/v1/users/alice@example.com",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT (.+) FROM users WHERE LOWER\\(email\\)").WillReturnRows(userRow(t, hash))
+			},
+		},
+		{
+			name:   "update user",
+			method: http.MethodPut,
+			path:   "/api/v1/users",
+			body:   `{"name": "Alice", "email": "alice@example.com"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT (.+) FROM users WHERE LOWER\\(email\\)").WillReturnRows(userRow(t, hash))
+				mock.ExpectExec("UPDATE users SET name = \\$1, updated_at").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("SELECT (.+) FROM users WHERE LOWER\\(email\\)").WillReturnRows(userRow(t, hash))
+			},
+		},
+		{
+			name:   "check password",
+			method: http.MethodPost,
+			path:   "/api/v1/users/check-password",
+			body:   `{"username": "alice@example.com", "password": "secret"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT (.+) FROM users WHERE LOWER\\(email\\)").WillReturnRows(userRow(t, hash))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := setupUserTest(t)
+			tt.expect(mock)
+
+			rec := httptest.NewRecorder()
+			testRouter().ServeHTTP(rec, asPrincipal(t, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)), admin))
+
+			assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+			assert.NoError(t, mock.ExpectationsWereMet())
+
+			var body interface{}
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+
+			assertNoPasswordFields(t, "$", body)
+			assert.NotContains(t, rec.Body.String(), "$2a$")
+			assert.NotContains(t, rec.Body.String(), `"secret"`)
+		})
+	}
+}
+
+func TestUserJSONOmitsPassword(t *testing.T) {
+	out, err := json.Marshal(models.User{Name: "Alice", Email: "alice@example.com", Password: "$2a$10$hash"})
+	assert.NoError(t, err)
+	assert.NotContains(t, string(out), "password")
+	assert.NotContains(t, string(out), "$2a$")
+}
+
+func TestGetAllUsersPagination(t *testing.T) {
+	mock := setupUserTest(t)
+
+	now := time.Now()
+	rows := sqlmock.NewRows([]string{"id", "name", "email", "created_at", "updated_at", "reputation"}).
+		AddRow(testUserID, "Alice", "alice@example.com", now, now, 0).
+		AddRow("0e1b7c4e-2d7a-4a57-8f43-1d2b0e6a9f00", "Alicia", "alicia@example.com", now, now, 0)
+
+	mock.ExpectQuery(`SELECT (.+) FROM users WHERE deleted_at IS NULL AND name ILIKE \$1 ORDER BY name DESC, id DESC LIMIT \$2`).
+		WithArgs("al%", 2).
+		WillReturnRows(rows)
+
+	rec := httptest.NewRecorder()
+	handlers.GetAllUsers(rec, httptest.NewRequest(http.MethodGet, "/api/v1/users?limit=1&name=al&sort=-name", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	var page struct {
+		Data       []models.PublicUser `json:"data"`
+		NextCursor string              `json:"next_cursor"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	assert.Len(t, page.Data, 1)
+
+	cursor, err := models.DecodeCursor(page.NextCursor)
+	assert.NoError(t, err)
+	assert.Equal(t, "-name", cursor.Sort)
+	assert.Equal(t, "Alice", cursor.Value)
+	assert.Equal(t, testUserID, cursor.ID.String())
+
+	assert.Equal(t, `</api/v1/users?cursor=`+page.NextCursor+`&limit=1&name=al&sort=-name>; rel="next"`, rec.Header().Get("Link"))
+}
+
+func TestGetAllUsersReflectsWrites(t *testing.T) {
+	admin := &authorization.Principal{UserID: uuid.FromStringOrNil(otherTestUserID), Roles: []string{authorization.RoleAdmin}}
+
+	mock := setupUserTest(t)
+
+	listing := `SELECT (.+) FROM users WHERE deleted_at IS NULL ORDER BY created_at ASC, id ASC LIMIT \$1`
+	mock.ExpectQuery(listing).WillReturnRows(userRow(t, ""))
+	mock.ExpectQuery(listing).WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "created_at", "updated_at", "reputation"}))
+
+	for _, count := range []int{1, 0} {
+		rec := httptest.NewRecorder()
+		testRouter().ServeHTTP(rec, asPrincipal(t, httptest.NewRequest(http.MethodGet, "/api/v1/users", nil), admin))
+
+		assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		var page struct {
+			Data []models.PublicUser `json:"data"`
+		}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+		assert.Len(t, page.Data, count)
+	}
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetAllUsersInvalidParams(t *testing.T) {
+	setupUserTest(t)
+
+	for _, query := range []string{"limit=0", "limit=101", "sort=password", "cursor=garbage", "created_after=yesterday"} {
+		rec := httptest.NewRecorder()
+		handlers.GetAllUsers(rec, httptest.NewRequest(http.MethodGet, "/api/v1/users?"+query, nil))
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+}
+
+func TestPatchUser(t *testing.T) {
+	admin := &authorization.Principal{UserID: uuid.FromStringOrNil(otherTestUserID), Roles: []string{authorization.RoleAdmin}}
+	selfAdmin := &authorization.Principal{UserID: uuid.FromStringOrNil(testUserID), Roles: []string{authorization.RoleAdmin}}
+
+	tests := []struct {
+		name        string
+		principal   *authorization.Principal // The user itself by default
+		contentType string
+		body        string
+		status      int
+		expect      func(mock sqlmock.Sqlmock)
+	}{
+		{
+			name:        "merge patch name",
+			contentType: "application/merge-patch+json",
+			body:        `{"name": "Alicia"}`,
+			status:      http.StatusOK,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`UPDATE users SET name = \$1, updated_at = \$2 WHERE id = \$3 AND deleted_at IS NULL RETURNING`).
+					WithArgs("Alicia", sqlmock.AnyArg(), testUserID).
+					WillReturnRows(userRow(t, ""))
+			},
+		},
+		{
+			name:        "admin sets password, hashed",
+			principal:   admin,
+			contentType: "application/merge-patch+json",
+			body:        `{"password": "new-secret"}`,
+			status:      http.StatusOK,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`UPDATE users SET password = \$1, password_changed_at = \$2, updated_at = \$3 WHERE id = \$4 AND deleted_at IS NULL RETURNING`).
+					WithArgs(bcryptHash{"new-secret"}, sqlmock.AnyArg(), sqlmock.AnyArg(), testUserID).
+					WillReturnRows(userRow(t, ""))
+			},
+		},
+		{
+			name:        "email change is pending verification",
+			contentType: "application/merge-patch+json",
+			body:        `{"email": "alicia@example.com"}`,
+			status:      http.StatusOK,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT (.+) FROM users WHERE LOWER\\(email\\)").WithArgs("alicia@example.com").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectQuery(`UPDATE users SET pending_email = \$1, updated_at = \$2 WHERE id = \$3 AND deleted_at IS NULL RETURNING`).
+					WithArgs("alicia@example.com", sqlmock.AnyArg(), testUserID).
+					WillReturnRows(userRow(t, ""))
+			},
+		},
+		{
+			name:        "json patch",
+			contentType: "application/json-patch+json",
+			body:        `[{"op": "test", "path": "/name", "value": "Alice"}, {"op": "replace", "path": "/name", "value": "Alicia"}]`,
+			status:      http.StatusOK,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`UPDATE users SET name = \$1`).WillReturnRows(userRow(t, ""))
+			},
+		},
+		{
+			name:        "json patch failed test",
+			contentType: "application/json-patch+json",
+			body:        `[{"op": "test", "path": "/name", "value": "Bob"}, {"op": "replace", "path": "/name", "value": "Alicia"}]`,
+			status:      http.StatusConflict,
+		},
+		{name: "own password", contentType: "application/merge-patch+json", body: `{"password": "new-secret"}`, status: http.StatusBadRequest},
+		{name: "admin's own password", principal: selfAdmin, contentType: "application/merge-patch+json", body: `{"password": "new-secret"}`, status: http.StatusBadRequest},
+		{name: "unknown field", contentType: "application/merge-patch+json", body: `{"role": "admin"}`, status: http.StatusBadRequest},
+		{name: "invalid email", contentType: "application/merge-patch+json", body: `{"email": "nope"}`, status: http.StatusBadRequest},
+		{name: "name removed", contentType: "application/merge-patch+json", body: `{"name": null}`, status: http.StatusBadRequest},
+		{name: "unsupported content type", contentType: "text/plain", body: `{"name": "Alicia"}`, status: http.StatusUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := setupUserTest(t)
+
+			hash, _ := helpers.HashPassword("secret")
+			mock.ExpectQuery("SELECT (.+) FROM users WHERE id").WithArgs(testUserID).WillReturnRows(userRow(t, hash))
+			if tt.expect != nil {
+				tt.expect(mock)
+			}
+
+			req := httptest.NewRequest(http.MethodPatch, "/api/v1/users/"+testUserID, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+
+			if tt.principal != nil {
+				req = asPrincipal(t, req, tt.principal)
+			} else {
+				req = asTestUser(t, req)
+			}
+
+			rec := httptest.NewRecorder()
+			testRouter().ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.status, rec.Code, rec.Body.String())
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+// Matches a bcrypt hash of the plain text password
+type bcryptHash struct {
+	password string
+}
+
+func (h bcryptHash) Match(value driver.Value) bool {
+	hash, ok := value.(string)
+
+	return ok && hash != h.password && helpers.ComparePasswords(hash, h.password)
+}
+
+func TestGetAllUsersEmailFilter(t *testing.T) {
+	mock := setupUserTest(t)
+
+	mock.ExpectQuery(`SELECT (.+) FROM users WHERE deleted_at IS NULL AND LOWER\(email\) = \$1 ORDER BY created_at ASC, id ASC LIMIT \$2`).
+		WithArgs("alice@example.com", models.DefaultPageLimit+1).
+		WillReturnRows(userRow(t, ""))
+
+	rec := httptest.NewRecorder()
+	handlers.GetAllUsers(rec, httptest.NewRequest(http.MethodGet, "/api/v1/users?email=Alice@example.com", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	rec = httptest.NewRecorder()
+	handlers.GetAllUsers(rec, httptest.NewRequest(http.MethodGet, "/api/v1/users?email=alice", nil))
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestDeleteUser(t *testing.T) {
+	hash, _ := helpers.HashPassword("secret")
+
+	mock := setupUserTest(t)
+	assert.NoError(t, redis.SetCache("alice@example.com", "refresh-token-jti", time.Hour))
+
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id").WithArgs(testUserID).WillReturnRows(userRow(t, hash))
+	mock.ExpectExec(`UPDATE users SET deleted_at = \$1 WHERE id = \$2 AND deleted_at IS NULL`).
+		WithArgs(sqlmock.AnyArg(), testUserID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rec := httptest.NewRecorder()
+	testRouter().ServeHTTP(rec, asTestUser(t, httptest.NewRequest(http.MethodDelete, "/api/v1/users/"+testUserID, nil)))
+
+	assert.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	jti, _ := redis.GetCache("alice@example.com")
+	assert.Empty(t, jti)
+}
+
+func TestRestoreUser(t *testing.T) {
+	admin := &authorization.Principal{UserID: uuid.FromStringOrNil(otherTestUserID), Roles: []string{authorization.RoleAdmin}}
+
+	tests := []struct {
+		name   string
+		status int
+		expect func(mock sqlmock.Sqlmock)
+	}{
+		{
+			name:   "restored",
+			status: http.StatusOK,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT (.+) FROM users WHERE id = \\$1 AND deleted_at IS NOT NULL").WillReturnRows(userRow(t, ""))
+				mock.ExpectQuery("SELECT (.+) FROM users WHERE LOWER\\(email\\)").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectQuery("UPDATE users SET deleted_at = NULL").WithArgs(sqlmock.AnyArg(), testUserID).WillReturnRows(userRow(t, ""))
+			},
+		},
+		{
+			name:   "not deleted",
+			status: http.StatusNotFound,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT (.+) FROM users WHERE id = \\$1 AND deleted_at IS NOT NULL").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			},
+		},
+		{
+			name:   "email taken",
+			status: http.StatusConflict,
+			expect: func(mock sqlmock.Sqlmock) {
+				hash, _ := helpers.HashPassword("secret")
+				mock.ExpectQuery("SELECT (.+) FROM users WHERE id = \\$1 AND deleted_at IS NOT NULL").WillReturnRows(userRow(t, ""))
+				mock.ExpectQuery("SELECT (.+) FROM users WHERE LOWER\\(email\\)").WillReturnRows(userRow(t, hash))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := setupUserTest(t)
+			tt.expect(mock)
+
+			rec := httptest.NewRecorder()
+			testRouter().ServeHTTP(rec, asPrincipal(t, httptest.NewRequest(http.MethodPost, "/api/v1/admin/users/"+testUserID+"/restore", nil), admin))
+
+			assert.Equal(t, tt.status, rec.Code, rec.Body.String())
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestUpdateUserByEmailOwnership(t *testing.T) {
+	mock := setupUserTest(t)
+
+	rec := httptest.NewRecorder()
+	testRouter().ServeHTTP(rec, asTestUser(t, httptest.NewRequest(http.MethodPut, "/api/v1/users",
+		strings.NewReader(`{"name": "Mallory", "email": "bob@example.com", "password": "owned"}`))))
+
+	assert.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateUserByEmailRejectsPassword(t *testing.T) {
+	mock := setupUserTest(t)
+
+	rec := httptest.NewRecorder()
+	testRouter().ServeHTTP(rec, asTestUser(t, httptest.NewRequest(http.MethodPut, "/api/v1/users",
+		strings.NewReader(`{"name": "Alice", "email": "alice@example.com", "password": "new-secret"}`))))
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+	assert.Contains(t, rec.Body.String(), "/api/v1/me/password")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateUserDuplicateEmail(t *testing.T) {
+	mock := setupUserTest(t)
+
+	mock.ExpectQuery("INSERT INTO users").
+		WithArgs("Alice", "alice@example.com", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnError(&pgconn.PgError{Code: "23505", ConstraintName: "users_email_lower_key"})
+
+	rec := httptest.NewRecorder()
+	handlers.CreateUser(rec, httptest.NewRequest(http.MethodPost, "/api/v1/users",
+		strings.NewReader(`{"name": "Alice", "email": " Alice@Example.com", "password": "secret"}`)))
+
+	assert.Equal(t, http.StatusConflict, rec.Code, rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateUserReturnsPersistedRow(t *testing.T) {
+	mock := setupUserTest(t)
+
+	mock.ExpectQuery(`INSERT INTO users \(.+\) VALUES \(.+\) RETURNING id, name, email, created_at, updated_at`).
+		WithArgs("Alice", "alice@example.com", bcryptHash{"secret"}, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(userRow(t, ""))
+
+	rec := httptest.NewRecorder()
+	handlers.CreateUser(rec, httptest.NewRequest(http.MethodPost, "/api/v1/users",
+		strings.NewReader(`{"name": "Alice", "email": "alice@example.com", "password": "secret"}`)))
+
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Contains(t, rec.Body.String(), testUserID)
+	assert.NotContains(t, rec.Body.String(), "0001-01-01")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gofrs/uuid"
+
+	"server/authorization"
+	"server/helpers"
+	"server/models"
+)
+
+var vote models.Vote
+
+// Vote on Question
+//
+//	@Summary      Vote on Question
+//	@Description  Upvote (1) or downvote (-1) a Question, voting again with the same value changes nothing
+//	@Tags         votes
+//	@Accept       json
+//	@Produce      json
+//	@Param id path string true "Question ID"
+//	@Param vote body models.VoteInput true "Vote"
+//	@Security     BearerAuth
+//	@Router       /api/v1/questions/{id}/vote [put]
+//	@Success 200 {object} models.VoteResult
+//	@Failure 400 {object} string
+//	@Failure 401 {object} string
+//	@Failure 403 {object} string
+//	@Failure 404 {object} string
+func VoteQuestion(w http.ResponseWriter, r *http.Request) {
+	value, ok := readVote(w, r)
+	if !ok {
+		return
+	}
+
+	castQuestionVote(w, r, value)
+}
+
+// Retract Question Vote
+//
+//	@Summary      Retract Question vote
+//	@Description  Remove the vote of the authenticated User on a Question, if any
+//	@Tags         votes
+//	@Produce      json
+//	@Param id path string true "Question ID"
+//	@Security     BearerAuth
+//	@Router       /api/v1/questions/{id}/vote [delete]
+//	@Success 200 {object} models.VoteResult
+//	@Failure 401 {object} string
+//	@Failure 403 {object} string
+//	@Failure 404 {object} string
+func UnvoteQuestion(w http.ResponseWriter, r *http.Request) {
+	castQuestionVote(w, r, 0)
+}
+
+// Vote on Answer
+//
+//	@Summary      Vote on Answer
+//	@Description  Upvote (1) or downvote (-1) an Answer, voting again with the same value changes nothing
+//	@Tags         votes
+//	@Accept       json
+//	@Produce      json
+//	@Param id path string true "Question ID"
+//	@Param answerID path string true "Answer ID"
+//	@Param vote body models.VoteInput true "Vote"
+//	@Security     BearerAuth
+//	@Router       /api/v1/questions/{id}/answers/{answerID}/vote [put]
+//	@Success 200 {object} models.VoteResult
+//	@Failure 400 {object} string
+//	@Failure 401 {object} string
+//	@Failure 403 {object} string
+//	@Failure 404 {object} string
+func VoteAnswer(w http.ResponseWriter, r *http.Request) {
+	value, ok := readVote(w, r)
+	if !ok {
+		return
+	}
+
+	castAnswerVote(w, r, value)
+}
+
+// Retract Answer Vote
+//
+//	@Summary      Retract Answer vote
+//	@Description  Remove the vote of the authenticated User on an Answer, if any
+//	@Tags         votes
+//	@Produce      json
+//	@Param id path string true "Question ID"
+//	@Param answerID path string true "Answer ID"
+//	@Security     BearerAuth
+//	@Router       /api/v1/questions/{id}/answers/{answerID}/vote [delete]
+//	@Success 200 {object} models.VoteResult
+//	@Failure 401 {object} string
+//	@Failure 403 {object} string
+//	@Failure 404 {object} string
+func UnvoteAnswer(w http.ResponseWriter, r *http.Request) {
+	castAnswerVote(w, r, 0)
+}
+
+func readVote(w http.ResponseWriter, r *http.Request) (int, bool) {
+	var input models.VoteInput
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Invalid JSON"), http.StatusBadRequest)
+		return 0, false
+	}
+
+	err = helpers.ValidateStruct(input)
+	if err != nil {
+		helpers.ErrorJSON(w, err, http.StatusBadRequest)
+		return 0, false
+	}
+
+	return input.Value, true
+}
+
+func castQuestionVote(w http.ResponseWriter, r *http.Request, value int) {
+	found, ok := findURLQuestion(w, r)
+	if !ok {
+		return
+	}
+
+	castVote(w, r, models.QuestionVotes, found.ID, value)
+}
+
+func castAnswerVote(w http.ResponseWriter, r *http.Request, value int) {
+	found, ok := findURLQuestion(w, r)
+	if !ok {
+		return
+	}
+
+	foundAnswer, ok := findURLAnswer(w, r, found.ID)
+	if !ok {
+		return
+	}
+
+	castVote(w, r, models.AnswerVotes, foundAnswer.ID, value)
+}
+
+func castVote(w http.ResponseWriter, r *http.Request, target models.VoteTarget, id uuid.UUID, value int) {
+	principal, ok := authorization.FromContext(r.Context())
+	if !ok || principal.UserID == uuid.Nil {
+		helpers.ErrorJSON(w, errors.New("Unauthorized"), http.StatusUnauthorized)
+		return
+	}
+
+	result, err := vote.Cast(target, id, principal.UserID, value)
+
+	if errors.Is(err, models.ErrOwnVote) {
+		helpers.ErrorJSON(w, err, http.StatusForbidden)
+		return
+	}
+
+	if err != nil {
+		helpers.ErrorJSON(w, errors.New("Error voting"), http.StatusInternalServerError)
+		return
+	}
+
+	_ = helpers.WriteJSON(w, http.StatusOK, result)
+}
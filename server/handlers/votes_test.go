@@ -0,0 +1,151 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVoteQuestion(t *testing.T) {
+	authorID := "7a1d2c3b-4e5f-4a6b-8c7d-9e0f1a2b3c4d"
+
+	tests := []struct {
+		name     string
+		body     string
+		previous int
+		status   int
+		response string
+		expect   func(mock sqlmock.Sqlmock)
+	}{
+		{
+			name:     "first upvote",
+			body:     `{"value": 1}`,
+			status:   http.StatusOK,
+			response: `"score": 1`,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("INSERT INTO question_votes (.+) ON CONFLICT \\(question_id, user_id\\) DO UPDATE").
+					WithArgs(testQuestionID, testUserID, 1, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("UPDATE questions SET score = score \\+ \\$1").WithArgs(1, testQuestionID).
+					WillReturnRows(sqlmock.NewRows([]string{"score"}).AddRow(1))
+				mock.ExpectExec("UPDATE users SET reputation = reputation \\+ \\$1").WithArgs(5, authorID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name:     "repeated upvote",
+			body:     `{"value": 1}`,
+			previous: 1,
+			status:   http.StatusOK,
+			response: `"score": 0`,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name:     "upvote changed to downvote",
+			body:     `{"value": -1}`,
+			previous: 1,
+			status:   http.StatusOK,
+			response: `"score": -2`,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("INSERT INTO question_votes").
+					WithArgs(testQuestionID, testUserID, -1, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("UPDATE questions SET score = score \\+ \\$1").WithArgs(-2, testQuestionID).
+					WillReturnRows(sqlmock.NewRows([]string{"score"}).AddRow(-2))
+				mock.ExpectExec("UPDATE users SET reputation = reputation \\+ \\$1").WithArgs(-7, authorID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := setupUserTest(t)
+			mock.ExpectQuery("SELECT (.+) FROM questions WHERE id").WithArgs(testQuestionID).WillReturnRows(questionRow(authorID))
+			expectQuestionTags(mock)
+			mock.ExpectBegin()
+			mock.ExpectQuery("SELECT user_id, score FROM questions WHERE id = \\$1 FOR UPDATE").WithArgs(testQuestionID).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id", "score"}).AddRow(authorID, 0))
+
+			previous := sqlmock.NewRows([]string{"value"})
+			if tt.previous != 0 {
+				previous.AddRow(tt.previous)
+			}
+			mock.ExpectQuery("SELECT value FROM question_votes").WithArgs(testQuestionID, testUserID).WillReturnRows(previous)
+
+			tt.expect(mock)
+
+			rec := httptest.NewRecorder()
+			testRouter().ServeHTTP(rec, asTestUser(t, httptest.NewRequest(http.MethodPut, "/api/v1/questions/"+testQuestionID+"/vote", strings.NewReader(tt.body))))
+
+			assert.Equal(t, tt.status, rec.Code, rec.Body.String())
+			assert.Contains(t, rec.Body.String(), tt.response)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestVoteOnOwnQuestion(t *testing.T) {
+	mock := setupUserTest(t)
+	mock.ExpectQuery("SELECT (.+) FROM questions WHERE id").WithArgs(testQuestionID).WillReturnRows(questionRow(testUserID))
+	expectQuestionTags(mock)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT user_id, score FROM questions").WithArgs(testQuestionID).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "score"}).AddRow(testUserID, 0))
+	mock.ExpectRollback()
+
+	rec := httptest.NewRecorder()
+	testRouter().ServeHTTP(rec, asTestUser(t, httptest.NewRequest(http.MethodPut, "/api/v1/questions/"+testQuestionID+"/vote", strings.NewReader(`{"value": 1}`))))
+
+	assert.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVoteInvalidValue(t *testing.T) {
+	mock := setupUserTest(t)
+
+	for _, body := range []string{`{"value": 2}`, `{"value": 0}`, `{}`} {
+		rec := httptest.NewRecorder()
+		testRouter().ServeHTTP(rec, asTestUser(t, httptest.NewRequest(http.MethodPut, "/api/v1/questions/"+testQuestionID+"/vote", strings.NewReader(body))))
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+	}
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRetractAnswerVote(t *testing.T) {
+	authorID := "7a1d2c3b-4e5f-4a6b-8c7d-9e0f1a2b3c4d"
+
+	mock := setupUserTest(t)
+	mock.ExpectQuery("SELECT (.+) FROM questions WHERE id").WithArgs(testQuestionID).WillReturnRows(questionRow(authorID))
+	expectQuestionTags(mock)
+	mock.ExpectQuery("SELECT (.+) FROM answers WHERE id").WithArgs(testAnswerID).WillReturnRows(answerRow(testQuestionID, authorID))
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT user_id, score FROM answers WHERE id = \\$1 FOR UPDATE").WithArgs(testAnswerID).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "score"}).AddRow(authorID, 4))
+	mock.ExpectQuery("SELECT value FROM answer_votes").WithArgs(testAnswerID, testUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow(1))
+	mock.ExpectExec("DELETE FROM answer_votes WHERE answer_id = \\$1 AND user_id = \\$2").WithArgs(testAnswerID, testUserID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("UPDATE answers SET score = score \\+ \\$1").WithArgs(-1, testAnswerID).
+		WillReturnRows(sqlmock.NewRows([]string{"score"}).AddRow(3))
+	mock.ExpectExec("UPDATE users SET reputation = reputation \\+ \\$1").WithArgs(-10, authorID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	rec := httptest.NewRecorder()
+	testRouter().ServeHTTP(rec, asTestUser(t, httptest.NewRequest(http.MethodDelete, "/api/v1/questions/"+testQuestionID+"/answers/"+testAnswerID+"/vote", nil)))
+
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.JSONEq(t, `{"score": 3, "vote": 0}`, rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,82 @@
+// Word level diffs of texts
+package helpers
+
+import "regexp"
+
+// Kinds of diff operations
+const (
+	DiffEqual  = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+)
+
+// Run of text kept, inserted or deleted
+type DiffOp struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// Words with their trailing whitespace, so the tokens join back into the text
+var diffTokens = regexp.MustCompile(`\S+\s*|\s+`)
+
+// Returns the operations turning `before` into `after`, word by word
+// Joining the equal and delete texts gives `before`, the equal and insert texts `after`
+func DiffWords(before string, after string) []DiffOp {
+	a := diffTokens.FindAllString(before, -1)
+	b := diffTokens.FindAllString(after, -1)
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	ops := []DiffOp{}
+
+	add := func(op string, text string) {
+		if last := len(ops) - 1; last >= 0 && ops[last].Op == op {
+			ops[last].Text += text
+			return
+		}
+
+		ops = append(ops, DiffOp{Op: op, Text: text})
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			add(DiffEqual, a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			add(DiffDelete, a[i])
+			i++
+		default:
+			add(DiffInsert, b[j])
+			j++
+		}
+	}
+
+	for ; i < len(a); i++ {
+		add(DiffDelete, a[i])
+	}
+
+	for ; j < len(b); j++ {
+		add(DiffInsert, b[j])
+	}
+
+	return ops
+}
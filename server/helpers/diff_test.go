@@ -0,0 +1,44 @@
+package helpers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffWords(t *testing.T) {
+	ops := DiffWords("What is Go used for?", "What is Golang mostly used for?")
+
+	assert.Equal(t, []DiffOp{
+		{Op: DiffEqual, Text: "What is "},
+		{Op: DiffDelete, Text: "Go "},
+		{Op: DiffInsert, Text: "Golang mostly "},
+		{Op: DiffEqual, Text: "used for?"},
+	}, ops)
+}
+
+func TestDiffWordsRebuildsBothTexts(t *testing.T) {
+	tests := [][2]string{
+		{"", "Brand new text"},
+		{"Removed entirely", ""},
+		{"same text", "same text"},
+		{"a b c d", "d c b a"},
+		{"line one\nline two", "line one\n\nline three"},
+	}
+
+	for _, tt := range tests {
+		var before, after string
+
+		for _, op := range DiffWords(tt[0], tt[1]) {
+			if op.Op != DiffInsert {
+				before += op.Text
+			}
+			if op.Op != DiffDelete {
+				after += op.Text
+			}
+		}
+
+		assert.Equal(t, tt[0], before)
+		assert.Equal(t, tt[1], after)
+	}
+}
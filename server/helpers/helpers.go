@@ -1,12 +1,16 @@
 package helpers
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"io"
 	"log"
 
 	"net/http"
 	"os"
+	"strings"
 
 	"server/types"
 )
@@ -37,7 +41,7 @@ func ReadJSON(w http.ResponseWriter, r *http.Request, data interface{}) error {
 	}
 
 	err = dec.Decode(&struct{}{})
-	if err != nil {
+	if !errors.Is(err, io.EOF) {
 		return errors.New("body must have only a single json object")
 	}
 
@@ -96,3 +100,20 @@ func InterfaceArrayToStringArray(arr []interface{}) []string {
 	}
 	return stringArr
 }
+
+// Returns a URL-safe random string built from n random bytes
+func RandomToken(n int) (string, error) {
+	buf := make([]byte, n)
+
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// Returns the canonical form emails are stored and compared in
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,25 @@
+package helpers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadJSON(t *testing.T) {
+	var data struct {
+		Name string `json:"name"`
+	}
+
+	err := ReadJSON(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(`{"name": "Alice"}`)), &data)
+	assert.NoError(t, err)
+	assert.Equal(t, "Alice", data.Name)
+
+	err = ReadJSON(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(`{"name": "Alice"}{"name": "Bob"}`)), &data)
+	assert.Error(t, err)
+
+	err = ReadJSON(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(`{"name":`)), &data)
+	assert.Error(t, err)
+}
@@ -0,0 +1,56 @@
+// Functions for cursor paginated listings
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"server/types"
+)
+
+// Parses the `limit` query parameter, returns 0 when it is absent
+func ParseLimit(r *http.Request, max int) (int, error) {
+	raw := r.URL.Query().Get("limit")
+	if raw == "" {
+		return 0, nil
+	}
+
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit < 1 || limit > max {
+		return 0, fmt.Errorf("limit must be between 1 and %d", max)
+	}
+
+	return limit, nil
+}
+
+// Returns an RFC 8288 `Link` header value pointing at the page after `cursor`
+// All other query parameters of the request are kept
+func NextPageLink(r *http.Request, cursor string) (string, error) {
+	if cursor == "" {
+		return "", errors.New("no next page")
+	}
+
+	next := *r.URL
+	query := next.Query()
+	query.Set("cursor", cursor)
+	next.RawQuery = query.Encode()
+
+	return fmt.Sprintf(`<%s>; rel="next"`, next.RequestURI()), nil
+}
+
+// Writes a page of results with its `next_cursor` and `Link` header
+func WritePage(w http.ResponseWriter, r *http.Request, data interface{}, cursor string) (types.Page, http.Header) {
+	headers := http.Header{}
+	page := types.Page{Data: data}
+
+	if link, err := NextPageLink(r, cursor); err == nil {
+		headers.Set("Link", link)
+		page.NextCursor = &cursor
+	}
+
+	WriteJSON(w, http.StatusOK, page, headers)
+
+	return page, headers
+}
@@ -0,0 +1,44 @@
+package helpers
+
+import (
+	"errors"
+	"regexp"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/rs/zerolog/log"
+)
+
+var validate = validator.New()
+
+// Lowercase letters, digits and `+#.-`, starting with a letter or digit, e.g. `c++` or `asp.net`
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9+#.\-]{0,34}$`)
+
+func init() {
+	_ = validate.RegisterValidation("tag", func(fl validator.FieldLevel) bool {
+		return tagPattern.MatchString(fl.Field().String())
+	})
+}
+
+// Validates the struct against its `validate` tags
+// Returns an error listing every failed validation, one per line
+func ValidateStruct(data interface{}) error {
+	err := validate.Struct(data)
+	if err == nil {
+		return nil
+	}
+
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return err
+	}
+
+	var errorMessages string
+
+	for _, err := range validationErrors {
+		log.Error().Err(err).Msg("Validation failed")
+
+		errorMessages += err.Error() + "\n"
+	}
+
+	return errors.New(errorMessages)
+}
@@ -0,0 +1,54 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"server/env"
+	"server/models"
+	"server/storage"
+)
+
+// Deletes the unused uploaded files every `interval`. Runs until the context is cancelled
+func StartBlobPurge(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			PurgeUnusedBlobs()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Deletes the uploaded files no attachment or avatar used for the grace period
+// The grace period covers uploads that touched the blob and are about to reference it
+func PurgeUnusedBlobs() {
+	store := storage.Store()
+	if store == nil {
+		return
+	}
+
+	var blob models.Blob
+
+	hashes, err := blob.PurgeUnused(time.Now().Add(-env.DefaultConfig.STORAGE.GRACE_PERIOD), func(hash string) error {
+		return store.Delete(context.Background(), storage.HashKey(hash))
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Error purging unused blobs")
+		return
+	}
+
+	if len(hashes) > 0 {
+		log.Info().Msgf("Deleted %d unused files", len(hashes))
+	}
+}
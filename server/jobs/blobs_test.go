@@ -0,0 +1,67 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+
+	"server/env"
+	"server/models"
+	"server/storage"
+)
+
+func TestPurgeUnusedBlobs(t *testing.T) {
+	dbMock, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating DB mock: %s", err)
+	}
+	t.Cleanup(func() { dbMock.Close() })
+
+	models.New(dbMock)
+
+	store, err := storage.NewLocalStore(t.TempDir(), storage.LocalFilesPath, "secret")
+	if err != nil {
+		t.Fatalf("Error creating the local store: %s", err)
+	}
+
+	previous := storage.Store()
+	storage.SetStore(store)
+	env.DefaultConfig.STORAGE.GRACE_PERIOD = time.Hour
+	t.Cleanup(func() {
+		storage.SetStore(previous)
+		env.DefaultConfig.STORAGE = env.StorageConfig{}
+	})
+
+	unused, touched := strings.Repeat("a", 64), strings.Repeat("b", 64)
+	for _, hash := range []string{unused, touched} {
+		assert.NoError(t, store.Put(context.Background(), storage.HashKey(hash), bytes.NewReader([]byte(hash)), 64, "text/plain"))
+	}
+
+	mock.ExpectQuery("SELECT b.sha256 FROM blobs b WHERE b.last_used_at < \\$1").WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"sha256"}).AddRow(unused).AddRow(touched))
+	mock.ExpectBegin()
+	mock.ExpectQuery("DELETE FROM blobs b WHERE b.sha256 = \\$1 AND b.last_used_at < \\$2").WithArgs(unused, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"sha256"}).AddRow(unused))
+	mock.ExpectCommit()
+	// An upload touched the blob since it was listed
+	mock.ExpectBegin()
+	mock.ExpectQuery("DELETE FROM blobs b WHERE b.sha256 = \\$1").WithArgs(touched, sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"sha256"}))
+	mock.ExpectRollback()
+
+	PurgeUnusedBlobs()
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	exists, err := store.Exists(context.Background(), storage.HashKey(unused))
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	exists, err = store.Exists(context.Background(), storage.HashKey(touched))
+	assert.NoError(t, err)
+	assert.True(t, exists, "files of blobs used again are kept")
+}
@@ -0,0 +1,234 @@
+package jobs
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/rs/zerolog/log"
+
+	"server/env"
+	"server/models"
+	"server/redis"
+)
+
+// How long a finished export can be downloaded
+const DataExportTTL = 7 * 24 * time.Hour
+
+const dataExportKeyPrefix = "export:job:"
+
+// States of a data export job
+const (
+	DataExportPending = "pending"
+	DataExportReady   = "ready"
+	DataExportFailed  = "failed"
+)
+
+// Background job building a user's data export archive
+type DataExport struct {
+	ID          uuid.UUID  `json:"id"`
+	UserID      uuid.UUID  `json:"user_id"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+}
+
+// Session of the user, as stored in Redis
+type exportedSession struct {
+	RefreshTokenID string    `json:"refresh_token_id"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+// Queues the export of the user's data and returns the pending job
+func StartDataExport(userID uuid.UUID) (*DataExport, error) {
+	job := &DataExport{
+		ID:        uuid.Must(uuid.NewV4()),
+		UserID:    userID,
+		Status:    DataExportPending,
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(DataExportTTL),
+	}
+
+	err := saveDataExport(job)
+	if err != nil {
+		return nil, err
+	}
+
+	go runDataExport(job)
+
+	return job, nil
+}
+
+// Returns the export job with the given ID, nil if it does not exist or has expired
+func FindDataExport(id uuid.UUID) (*DataExport, error) {
+	cached, err := redis.GetCache(dataExportKeyPrefix + id.String())
+	if err != nil || cached == "" {
+		return nil, err
+	}
+
+	var job DataExport
+	err = json.Unmarshal([]byte(cached), &job)
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// Returns the path of the job's archive
+func DataExportPath(job *DataExport) string {
+	return filepath.Join(env.DefaultConfig.EXPORT_DIR, job.UserID.String(), job.ID.String()+".zip")
+}
+
+// Deletes every export archive of the user
+func RemoveDataExports(userID uuid.UUID) error {
+	return os.RemoveAll(filepath.Join(env.DefaultConfig.EXPORT_DIR, userID.String()))
+}
+
+// Deletes the expired export archives every `interval`. Runs until the context is cancelled
+func StartDataExportPurge(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			PurgeExpiredDataExports()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Deletes the export archives older than `DataExportTTL`
+func PurgeExpiredDataExports() {
+	archives, _ := filepath.Glob(filepath.Join(env.DefaultConfig.EXPORT_DIR, "*", "*.zip"))
+
+	for _, archive := range archives {
+		info, err := os.Stat(archive)
+		if err == nil && time.Since(info.ModTime()) > DataExportTTL {
+			_ = os.Remove(archive)
+		}
+	}
+}
+
+func saveDataExport(job *DataExport) error {
+	encoded, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	return redis.UpdateCache(dataExportKeyPrefix+job.ID.String(), string(encoded), time.Until(job.ExpiresAt))
+}
+
+func runDataExport(job *DataExport) {
+	err := writeDataExport(job)
+
+	now := time.Now()
+	job.CompletedAt = &now
+	job.Status = DataExportReady
+
+	if err != nil {
+		log.Error().Err(err).Msgf("Error exporting data of user %s", job.UserID)
+		job.Status = DataExportFailed
+		_ = os.Remove(DataExportPath(job))
+	}
+
+	_ = saveDataExport(job)
+}
+
+// Writes the archive with the user's profile, questions, answers, comments, sessions and audit events
+func writeDataExport(job *DataExport) error {
+	var userModel models.User
+	var questionModel models.Question
+	var answerModel models.Answer
+	var commentModel models.Comment
+	var auditModel models.AuditEvent
+
+	user, err := userModel.FindByID(job.UserID)
+	if err != nil {
+		return err
+	}
+
+	questions, err := questionModel.FindByUserID(job.UserID)
+	if err != nil {
+		return err
+	}
+
+	answers, err := answerModel.FindByUserID(job.UserID)
+	if err != nil {
+		return err
+	}
+
+	comments, err := commentModel.FindByUserID(job.UserID)
+	if err != nil {
+		return err
+	}
+
+	events, err := auditModel.FindByUserID(job.UserID)
+	if err != nil {
+		return err
+	}
+
+	// The refresh token ID is stored under the user's email
+	sessions := []exportedSession{}
+	if jti, _ := redis.GetCache(user.Email); jti != "" {
+		ttl, _ := redis.GetTTL(user.Email)
+		sessions = append(sessions, exportedSession{RefreshTokenID: jti, ExpiresAt: time.Now().Add(ttl).Truncate(time.Second)})
+	}
+
+	path := DataExportPath(job)
+
+	err = os.MkdirAll(filepath.Dir(path), 0o700)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	archive := zip.NewWriter(file)
+
+	entries := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", user.Public()},
+		{"questions.json", questions},
+		{"answers.json", answers},
+		{"comments.json", comments},
+		{"sessions.json", sessions},
+		{"audit_events.json", events},
+	}
+
+	for _, entry := range entries {
+		writer, err := archive.Create(entry.name)
+		if err != nil {
+			return err
+		}
+
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "\t")
+
+		if err := encoder.Encode(entry.data); err != nil {
+			return fmt.Errorf("writing %s: %w", entry.name, err)
+		}
+	}
+
+	return errors.Join(archive.Close(), file.Sync())
+}
@@ -0,0 +1,101 @@
+package jobs
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofrs/uuid"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+
+	"server/env"
+	"server/models"
+	"server/redis"
+)
+
+func TestWriteDataExport(t *testing.T) {
+	dbMock, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating DB mock: %s", err)
+	}
+	t.Cleanup(func() { dbMock.Close() })
+
+	models.New(dbMock)
+
+	redisServer := miniredis.RunT(t)
+	redis.SetClient(goredis.NewClient(&goredis.Options{Addr: redisServer.Addr()}))
+	assert.NoError(t, redis.SetCache("alice@example.com", "refresh-jti", time.Hour))
+
+	env.DefaultConfig.EXPORT_DIR = t.TempDir()
+
+	userID := uuid.Must(uuid.NewV4())
+	now := time.Now()
+
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id").WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "password", "created_at", "updated_at", "reputation"}).
+			AddRow(userID, "Alice", "alice@example.com", "$2a$10$hash", now, now, 0))
+	questionID := uuid.Must(uuid.NewV4())
+	mock.ExpectQuery("SELECT (.+) FROM questions WHERE user_id").WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "question", "created_at", "updated_at", "user_id", "score", "accepted_answer_id", "status"}).
+			AddRow(questionID, "Why?", now, now, userID, 0, nil, "hidden"))
+	mock.ExpectQuery("SELECT (.+) FROM question_tags").WithArgs(questionID).
+		WillReturnRows(sqlmock.NewRows([]string{"question_id", "name"}).AddRow(questionID, "go"))
+	mock.ExpectQuery("SELECT (.+) FROM answers WHERE user_id").WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "question_id", "user_id", "body", "score", "created_at", "updated_at", "status"}).
+			AddRow(uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4()), userID, "Because.", 2, now, now, "published"))
+	mock.ExpectQuery("SELECT (.+) FROM comments WHERE user_id").WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "question_id", "answer_id", "parent_id", "user_id", "body", "created_at", "updated_at", "deleted_at"}).
+			AddRow(uuid.Must(uuid.NewV4()), questionID, nil, nil, userID, "Which version?", now, now, nil))
+	mock.ExpectQuery("SELECT (.+) FROM audit_events WHERE user_id").WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "action", "metadata", "created_at"}).
+			AddRow(uuid.Must(uuid.NewV4()), userID, models.AuditDataExportRequested, []byte(`{}`), now))
+
+	job := &DataExport{ID: uuid.Must(uuid.NewV4()), UserID: userID, Status: DataExportPending}
+	assert.NoError(t, writeDataExport(job))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	archive, err := zip.OpenReader(DataExportPath(job))
+	assert.NoError(t, err)
+	defer archive.Close()
+
+	contents := map[string]string{}
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		assert.NoError(t, err)
+
+		data, _ := io.ReadAll(reader)
+		reader.Close()
+
+		contents[file.Name] = string(data)
+	}
+
+	assert.ElementsMatch(t, []string{"profile.json", "questions.json", "answers.json", "comments.json", "sessions.json", "audit_events.json"}, keys(contents))
+	assert.Contains(t, contents["profile.json"], "alice@example.com")
+	assert.NotContains(t, contents["profile.json"], "$2a$")
+	assert.Contains(t, contents["questions.json"], "Why?")
+	assert.Contains(t, contents["answers.json"], "Because.")
+	assert.Contains(t, contents["comments.json"], "Which version?")
+	assert.Contains(t, contents["audit_events.json"], models.AuditDataExportRequested)
+
+	var sessions []exportedSession
+	assert.NoError(t, json.Unmarshal([]byte(contents["sessions.json"]), &sessions))
+	assert.Len(t, sessions, 1)
+	assert.Equal(t, "refresh-jti", sessions[0].RefreshTokenID)
+
+	assert.NoError(t, RemoveDataExports(userID))
+	_, err = zip.OpenReader(DataExportPath(job))
+	assert.Error(t, err)
+}
+
+func keys(m map[string]string) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,54 @@
+// Background jobs run alongside the server
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"server/middleware"
+	"server/models"
+	"server/redis"
+)
+
+// Hard deletes users soft deleted longer than `retention` ago every `interval`
+// Runs until the context is cancelled
+func StartUserPurge(ctx context.Context, interval time.Duration, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			PurgeDeletedUsers(retention)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Purges the users soft deleted longer than `retention` ago and revokes their sessions
+func PurgeDeletedUsers(retention time.Duration) {
+	var user models.User
+
+	emails, err := user.PurgeDeleted(time.Now().Add(-retention))
+	if err != nil {
+		log.Error().Err(err).Msg("Error purging deleted users")
+		return
+	}
+
+	for _, email := range emails {
+		// The refresh token is stored under the user's email
+		_ = redis.DeleteCache(email)
+		_ = middleware.InvalidateAuthStatus(email)
+	}
+
+	if len(emails) > 0 {
+		log.Info().Msgf("Purged %d deleted users", len(emails))
+	}
+}
@@ -0,0 +1,44 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"server/models"
+)
+
+// Recomputes the vote scores and reputations every `interval`, after a first
+// interval has passed. Runs until the context is cancelled
+func StartVoteReconciliation(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				ReconcileVotes()
+			}
+		}
+	}()
+}
+
+// Fixes the denormalized scores and reputations that drifted from the votes
+func ReconcileVotes() {
+	var vote models.Vote
+
+	fixed, err := vote.Reconcile()
+	if err != nil {
+		log.Error().Err(err).Msg("Error reconciling votes")
+		return
+	}
+
+	if fixed > 0 {
+		log.Info().Msgf("Reconciled the scores and reputations of %d rows", fixed)
+	}
+}
@@ -0,0 +1,47 @@
+// Sends transactional emails such as verification links
+package mailer
+
+import (
+	"github.com/rs/zerolog/log"
+
+	"server/env"
+)
+
+// An email to a single recipient
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Delivers emails, implement it to plug in an SMTP server or email API
+type Mailer interface {
+	Send(message Message) error
+}
+
+// Mailer used by `Send`
+var Default Mailer = LogMailer{}
+
+// Sends the message with the default mailer
+func Send(message Message) error {
+	return Default.Send(message)
+}
+
+// Writes emails to the log instead of delivering them, for development
+// Bodies carry tokens, they are only logged in the development environment
+type LogMailer struct{}
+
+func (LogMailer) Send(message Message) error {
+	event := log.Info().
+		Str("to", message.To).
+		Str("subject", message.Subject)
+
+	if env.DefaultConfig.ENVIRONMENT == "development" {
+		event.Msg(message.Body)
+		return nil
+	}
+
+	event.Msg("Email not delivered, no mailer is configured")
+
+	return nil
+}
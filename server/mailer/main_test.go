@@ -0,0 +1,36 @@
+package mailer
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+
+	"server/env"
+)
+
+func TestLogMailerOnlyLogsBodiesInDevelopment(t *testing.T) {
+	var output bytes.Buffer
+
+	previous := log.Logger
+	log.Logger = zerolog.New(&output)
+	t.Cleanup(func() {
+		log.Logger = previous
+		env.DefaultConfig.ENVIRONMENT = ""
+	})
+
+	message := Message{To: "alice@example.com", Subject: "Verify your new email address", Body: "Your token: secret-token"}
+
+	env.DefaultConfig.ENVIRONMENT = "production"
+	assert.NoError(t, LogMailer{}.Send(message))
+	assert.Contains(t, output.String(), "alice@example.com")
+	assert.NotContains(t, output.String(), "secret-token")
+
+	output.Reset()
+
+	env.DefaultConfig.ENVIRONMENT = "development"
+	assert.NoError(t, LogMailer{}.Send(message))
+	assert.Contains(t, output.String(), "secret-token")
+}
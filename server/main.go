@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	// "errors"
 	"fmt"
 	// "log"
@@ -10,6 +11,7 @@ import (
 	"github.com/redis/go-redis/v9"
 	"server/db"
 	"server/env"
+	"server/jobs"
 	"server/logging"
 	"server/models"
 	rc "server/redis"
@@ -56,6 +58,10 @@ func init() {
 
 // @host localhost:5000
 // @BasePath /
+
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
 func main() {
 	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable", env.DefaultConfig.DB_HOST, env.DefaultConfig.DB_PORT, env.DefaultConfig.DB_USER, env.DefaultConfig.DB_PASSWORD, env.DefaultConfig.DB_NAME)
 
@@ -85,6 +91,15 @@ func main() {
 		Redis:  redisClient,
 	}
 
+	// The jobs query the database as soon as they start, after models.New set it
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	jobs.StartUserPurge(jobsCtx, env.DefaultConfig.USER_PURGE_INTERVAL, env.DefaultConfig.USER_RETENTION)
+	jobs.StartVoteReconciliation(jobsCtx, env.DefaultConfig.VOTE_RECONCILE_INTERVAL)
+	jobs.StartDataExportPurge(jobsCtx, env.DefaultConfig.EXPORT_PURGE_INTERVAL)
+	jobs.StartBlobPurge(jobsCtx, env.DefaultConfig.STORAGE.PURGE_INTERVAL)
+
 	err = app.Serve()
 	if err != nil {
 		log.Fatal().
@@ -0,0 +1,140 @@
+// Custom Authenticator that verifies JWTs against the users table
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/rs/zerolog/log"
+
+	"server/authorization"
+	"server/helpers"
+	"server/models"
+	"server/redis"
+)
+
+// How long a user's auth status is cached before it is read from the DB again.
+// Deleted or disabled users lose access within this window.
+var AuthStatusTTL = 10 * time.Second
+
+const authStatusKeyPrefix = "auth:status:"
+
+var userModel models.User
+
+// Cached lookup result, `Status` is nil when the user no longer exists
+type cachedAuthStatus struct {
+	Status *models.UserAuthStatus `json:"status"`
+}
+
+// Verifies the token set by `jwtauth.Verifier` and checks that its subject
+// still exists, is not disabled and has not invalidated tokens issued before
+// a password change or revocation
+// Adds the `authorization.Principal` to the context, returns 401 otherwise
+func Authenticator(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, _, err := jwtauth.FromContext(r.Context())
+
+		if err != nil || token == nil {
+			log.Info().Err(err).Msg("Authenticator: invalid token")
+			helpers.ErrorJSON(w, errors.New("Invalid or missing token."), http.StatusUnauthorized)
+			return
+		}
+
+		status, err := LoadAuthStatus(token.Subject())
+		if err != nil {
+			log.Error().Err(err).Msg("Authenticator: error loading auth status")
+			helpers.ErrorJSON(w, errors.New("Unable to verify token."), http.StatusInternalServerError)
+			return
+		}
+
+		if err := checkAuthStatus(status, token.IssuedAt()); err != nil {
+			log.Info().Msgf("Authenticator: rejected token for %v: %v", token.Subject(), err)
+			helpers.ErrorJSON(w, err, http.StatusUnauthorized)
+			return
+		}
+
+		ctx := authorization.WithPrincipal(r.Context(), &authorization.Principal{
+			UserID:     status.ID,
+			Email:      status.Email,
+			TokenID:    token.JwtID(),
+			AuthMethod: authorization.AuthMethodJWT,
+		})
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Sets the principal like `Authenticator` and `RBACMiddleware` when the request carries
+// a token that verifies, requests without one continue anonymously. For public routes
+// whose responses depend on the caller, such as hidden content shown to its author
+// Invalid or expired tokens are ignored, revoked ones are rejected like on protected routes
+func OptionalAuthenticator(next http.Handler) http.Handler {
+	authenticated := Authenticator(RBACMiddleware(next))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, _, err := jwtauth.FromContext(r.Context())
+
+		if err != nil || token == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		authenticated.ServeHTTP(w, r)
+	})
+}
+
+// Checks whether a token issued at `issuedAt` is still honoured for the user
+func checkAuthStatus(status *models.UserAuthStatus, issuedAt time.Time) error {
+	if status == nil {
+		return errors.New("User no longer exists.")
+	}
+
+	if status.Disabled {
+		return errors.New("User is disabled.")
+	}
+
+	// `iat` only has second precision
+	for _, notBefore := range []*time.Time{status.PasswordChangedAt, status.TokensValidAfter} {
+		if notBefore != nil && issuedAt.Before(notBefore.Truncate(time.Second)) {
+			return errors.New("Token has been revoked.")
+		}
+	}
+
+	return nil
+}
+
+// Returns the auth status of the user with the given email,
+// from the Redis cache if present, else from the DB
+func LoadAuthStatus(email string) (*models.UserAuthStatus, error) {
+	key := authStatusKeyPrefix + email
+
+	cached, _ := redis.GetCache(key)
+	if cached != "" {
+		var entry cachedAuthStatus
+		if err := json.Unmarshal([]byte(cached), &entry); err == nil {
+			return entry.Status, nil
+		}
+	}
+
+	status, err := userModel.FindAuthStatus(email)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(cachedAuthStatus{Status: status})
+	if err == nil {
+		if err := redis.SetCache(key, string(payload), AuthStatusTTL); err != nil {
+			log.Error().Err(err).Msg("Error caching auth status")
+		}
+	}
+
+	return status, nil
+}
+
+// Drops the cached auth status of a user, so changes apply on the next request
+func InvalidateAuthStatus(email string) error {
+	return redis.DeleteCache(authStatusKeyPrefix + email)
+}
@@ -0,0 +1,321 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/gofrs/uuid"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+
+	"server/authorization"
+	"server/models"
+	"server/redis"
+	"server/types"
+)
+
+const testEmail = "alice@example.com"
+
+var authStatusColumns = []string{"id", "email", "disabled", "password_changed_at", "tokens_valid_after"}
+
+// Backs the models with a mocked DB and the cache with an in-memory Redis
+func setupAuthenticatorTest(t *testing.T) (sqlmock.Sqlmock, *miniredis.Miniredis) {
+	dbMock, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating DB mock: %s", err)
+	}
+	t.Cleanup(func() { dbMock.Close() })
+
+	models.New(dbMock)
+
+	redisServer := miniredis.RunT(t)
+	redis.SetClient(goredis.NewClient(&goredis.Options{Addr: redisServer.Addr()}))
+
+	return mock, redisServer
+}
+
+func expectAuthStatus(mock sqlmock.Sqlmock, status *models.UserAuthStatus) {
+	rows := sqlmock.NewRows(authStatusColumns)
+	if status != nil {
+		rows.AddRow(status.ID, status.Email, status.Disabled, status.PasswordChangedAt, status.TokensValidAfter)
+	}
+
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE LOWER\\(email\\)").WithArgs(testEmail).WillReturnRows(rows)
+}
+
+// Runs the request through the verifier and `Authenticator`
+// Returns the recorded response and the principal seen by the handler
+func serveAuthenticator(t *testing.T, token string) (*httptest.ResponseRecorder, *authorization.Principal) {
+	var principal *authorization.Principal
+
+	handler := jwtauth.Verifier(testTokenAuth)(Authenticator(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ = authorization.FromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	return rec, principal
+}
+
+func TestCheckAuthStatus(t *testing.T) {
+	issuedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	sameSecond := issuedAt.Add(500 * time.Millisecond)
+	before := issuedAt.Add(-time.Minute)
+	after := issuedAt.Add(time.Second)
+
+	tests := []struct {
+		name    string
+		status  *models.UserAuthStatus
+		message string
+	}{
+		{name: "no revocation", status: &models.UserAuthStatus{}},
+		{name: "missing user", message: "User no longer exists."},
+		{name: "disabled user", status: &models.UserAuthStatus{Disabled: true}, message: "User is disabled."},
+		{name: "password changed before issue", status: &models.UserAuthStatus{PasswordChangedAt: &before}},
+		{name: "password changed after issue", status: &models.UserAuthStatus{PasswordChangedAt: &after}, message: "Token has been revoked."},
+		{name: "password changed within the issuing second", status: &models.UserAuthStatus{PasswordChangedAt: &sameSecond}},
+		{name: "tokens revoked before issue", status: &models.UserAuthStatus{TokensValidAfter: &before}},
+		{name: "tokens revoked after issue", status: &models.UserAuthStatus{TokensValidAfter: &after}, message: "Token has been revoked."},
+		{name: "tokens revoked within the issuing second", status: &models.UserAuthStatus{TokensValidAfter: &sameSecond}},
+		{
+			name:    "either timestamp revokes",
+			status:  &models.UserAuthStatus{PasswordChangedAt: &before, TokensValidAfter: &after},
+			message: "Token has been revoked.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkAuthStatus(tt.status, issuedAt)
+
+			if tt.message == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			if assert.Error(t, err) {
+				assert.Equal(t, tt.message, err.Error())
+			}
+		})
+	}
+}
+
+func TestAuthenticator(t *testing.T) {
+	userID := uuid.Must(uuid.NewV4())
+	issuedAt := time.Now().Add(-time.Minute).Truncate(time.Second)
+	before := issuedAt.Add(-time.Hour)
+	after := issuedAt.Add(time.Second)
+
+	tests := []struct {
+		name    string
+		claims  map[string]interface{}
+		raw     string
+		status  *models.UserAuthStatus
+		query   bool
+		code    int
+		message string
+	}{
+		{
+			name:   "active user",
+			status: &models.UserAuthStatus{ID: userID, Email: testEmail},
+			query:  true,
+			code:   http.StatusOK,
+		},
+		{
+			name:   "password changed before issue",
+			status: &models.UserAuthStatus{ID: userID, Email: testEmail, PasswordChangedAt: &before},
+			query:  true,
+			code:   http.StatusOK,
+		},
+		{
+			name:    "password changed after issue",
+			status:  &models.UserAuthStatus{ID: userID, Email: testEmail, PasswordChangedAt: &after},
+			query:   true,
+			code:    http.StatusUnauthorized,
+			message: "Token has been revoked.",
+		},
+		{
+			name:    "tokens revoked after issue",
+			status:  &models.UserAuthStatus{ID: userID, Email: testEmail, TokensValidAfter: &after},
+			query:   true,
+			code:    http.StatusUnauthorized,
+			message: "Token has been revoked.",
+		},
+		{
+			name: "token without iat after a revocation",
+			claims: map[string]interface{}{
+				"sub": testEmail,
+				"exp": time.Now().Add(time.Hour).Unix(),
+			},
+			status:  &models.UserAuthStatus{ID: userID, Email: testEmail, TokensValidAfter: &before},
+			query:   true,
+			code:    http.StatusUnauthorized,
+			message: "Token has been revoked.",
+		},
+		{
+			name:    "disabled user",
+			status:  &models.UserAuthStatus{ID: userID, Email: testEmail, Disabled: true},
+			query:   true,
+			code:    http.StatusUnauthorized,
+			message: "User is disabled.",
+		},
+		{
+			name:    "deleted user",
+			query:   true,
+			code:    http.StatusUnauthorized,
+			message: "User no longer exists.",
+		},
+		{
+			name:    "missing token",
+			raw:     "",
+			code:    http.StatusUnauthorized,
+			message: "Invalid or missing token.",
+		},
+		{
+			name: "expired token",
+			claims: map[string]interface{}{
+				"sub": testEmail,
+				"iat": issuedAt.Unix(),
+				"exp": time.Now().Add(-time.Second).Unix(),
+			},
+			code:    http.StatusUnauthorized,
+			message: "Invalid or missing token.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, _ := setupAuthenticatorTest(t)
+
+			if tt.query {
+				expectAuthStatus(mock, tt.status)
+			}
+
+			claims := tt.claims
+			if claims == nil && tt.query {
+				claims = map[string]interface{}{
+					"sub": testEmail,
+					"iat": issuedAt.Unix(),
+					"exp": time.Now().Add(time.Hour).Unix(),
+					"jti": "token-id",
+				}
+			}
+
+			token := tt.raw
+			if claims != nil {
+				token = encodeTestToken(t, claims)
+			}
+
+			rec, principal := serveAuthenticator(t, token)
+
+			assert.Equal(t, tt.code, rec.Code)
+			assert.NoError(t, mock.ExpectationsWereMet())
+
+			if tt.code != http.StatusOK {
+				var body types.JsonResponse
+				assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+				assert.True(t, body.Error)
+				assert.Equal(t, tt.message, body.Message)
+				assert.Nil(t, principal)
+				return
+			}
+
+			if assert.NotNil(t, principal) {
+				assert.Equal(t, userID, principal.UserID)
+				assert.Equal(t, testEmail, principal.Email)
+				assert.Equal(t, "token-id", principal.TokenID)
+				assert.Equal(t, authorization.AuthMethodJWT, principal.AuthMethod)
+			}
+		})
+	}
+}
+
+func TestLoadAuthStatusCache(t *testing.T) {
+	userID := uuid.Must(uuid.NewV4())
+	revokedAt := time.Now().Truncate(time.Second)
+
+	tests := []struct {
+		name    string
+		prepare func(t *testing.T, redisServer *miniredis.Miniredis)
+		queries int
+	}{
+		{
+			name: "cached within the TTL",
+			prepare: func(t *testing.T, redisServer *miniredis.Miniredis) {
+				redisServer.FastForward(AuthStatusTTL - time.Second)
+			},
+			queries: 1,
+		},
+		{
+			name:    "reloaded after the TTL",
+			prepare: func(t *testing.T, redisServer *miniredis.Miniredis) { redisServer.FastForward(AuthStatusTTL) },
+			queries: 2,
+		},
+		{
+			name: "reloaded after invalidation",
+			prepare: func(t *testing.T, redisServer *miniredis.Miniredis) {
+				assert.NoError(t, InvalidateAuthStatus(testEmail))
+			},
+			queries: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, redisServer := setupAuthenticatorTest(t)
+
+			expectAuthStatus(mock, &models.UserAuthStatus{ID: userID, Email: testEmail})
+			if tt.queries > 1 {
+				expectAuthStatus(mock, &models.UserAuthStatus{ID: userID, Email: testEmail, TokensValidAfter: &revokedAt})
+			}
+
+			first, err := LoadAuthStatus(testEmail)
+			assert.NoError(t, err)
+			assert.Equal(t, AuthStatusTTL, redisServer.TTL(authStatusKeyPrefix+testEmail))
+
+			tt.prepare(t, redisServer)
+
+			second, err := LoadAuthStatus(testEmail)
+			assert.NoError(t, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+
+			if assert.NotNil(t, first) && assert.NotNil(t, second) {
+				assert.Equal(t, userID, second.ID)
+				assert.Nil(t, first.TokensValidAfter)
+
+				if tt.queries == 1 {
+					assert.Nil(t, second.TokensValidAfter)
+				} else if assert.NotNil(t, second.TokensValidAfter) {
+					assert.True(t, revokedAt.Equal(*second.TokensValidAfter))
+				}
+			}
+		})
+	}
+}
+
+func TestLoadAuthStatusCachesMissingUser(t *testing.T) {
+	mock, _ := setupAuthenticatorTest(t)
+
+	expectAuthStatus(mock, nil)
+
+	for i := 0; i < 2; i++ {
+		status, err := LoadAuthStatus(testEmail)
+		assert.NoError(t, err)
+		assert.Nil(t, status)
+	}
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
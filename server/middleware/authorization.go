@@ -2,94 +2,150 @@
 package middleware
 
 import (
-	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"reflect"
+	"strings"
 
 	"time"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofrs/uuid"
 	"github.com/rs/zerolog/log"
 
 	"server/authorization"
 
 	"server/helpers"
+	"server/models"
 
 	"github.com/go-chi/jwtauth/v5"
 )
 
-var tokenAuth *jwtauth.JWTAuth
-
-func init() {
-	tokenAuth = authorization.InitJWTAuth()
-}
-
-// Extracts the claims from the JWT token and adds them to the context
-// Returns 401 if token is expired
+// Extracts the claims from the JWT token and adds them to the
+// `authorization.Principal` in the context
+// Returns 401 if the token is missing, expired or its claims are malformed
 func RBACMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		_, claims, _ := jwtauth.FromContext(r.Context())
-		ctx := context.WithValue(r.Context(), "claims", claims)
+		token, _, err := jwtauth.FromContext(r.Context())
 
-		exp := claims["exp"].(time.Time).Unix()
-		now := time.Now().Unix()
-		// log.Info().Msgf("RBACMiddleware: exp=%v\n", exp)
-		// log.Info().Msgf("RBACMiddleware: now=%v\n", now)
+		if errors.Is(err, jwtauth.ErrExpired) {
+			log.Info().Msgf("RBACMiddleware: token expired\n")
+			helpers.ErrorJSON(w, errors.New("Token expired."), http.StatusUnauthorized)
+			return
+		}
 
-		if exp < now {
+		if err != nil || token == nil {
+			log.Info().Err(err).Msg("RBACMiddleware: invalid token")
+			helpers.ErrorJSON(w, errors.New("Invalid or missing token."), http.StatusUnauthorized)
+			return
+		}
+
+		claims, err := DecodeClaims(token)
+		if err != nil {
+			log.Info().Err(err).Msg("RBACMiddleware: malformed claims")
+			helpers.ErrorJSON(w, err, http.StatusUnauthorized)
+			return
+		}
+
+		if claims.Expiration < time.Now().Unix() {
 			log.Info().Msgf("RBACMiddleware: token expired\n")
+			helpers.ErrorJSON(w, errors.New("Token expired."), http.StatusUnauthorized)
+			return
+		}
+
+		roles := claims.AllRoles()
 
-			un := struct {
-				Error   bool   `json:"error"`
-				Message string `json:"message"`
-			}{
-				Error:   true,
-				Message: "Token expired.",
+		log.Info().Msgf("RBACMiddleware: roles=%v\n", roles)
+
+		principal, ok := authorization.FromContext(r.Context())
+		if !ok {
+			principal = &authorization.Principal{
+				Email:      claims.Email,
+				TokenID:    claims.JWTID,
+				AuthMethod: authorization.AuthMethodJWT,
 			}
+		}
 
-			helpers.WriteJSON(w, http.StatusUnauthorized, un)
-			return
+		principal.Roles = roles
+		if claims.Scope != "" {
+			principal.Scopes = strings.Fields(claims.Scope)
 		}
 
-		scope := claims["app_metadata"].(map[string]interface{})["authorization"] //.(map[string]interface{})["roles"]
+		ctx := authorization.WithPrincipal(r.Context(), principal)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Decodes the claims of a verified token into `models.JWTClaims`
+// and validates them against its schema
+func DecodeClaims(token interface{}) (*models.JWTClaims, error) {
+	payload, err := json.Marshal(token)
+	if err != nil {
+		return nil, errors.New("Malformed token claims.")
+	}
 
-		log.Info().Msgf("RBACMiddleware: scope=%v\n", scope)
+	var claims models.JWTClaims
 
-		var scopeArray []string
+	err = json.Unmarshal(payload, &claims)
+	if err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			return nil, fmt.Errorf("Malformed token claim: %s.", typeErr.Field)
+		}
 
-		//extract roles from scope
-		for key, value := range scope.(map[string]interface{}) {
+		return nil, errors.New("Malformed token claims.")
+	}
 
-			valueArray := value.([]interface{})
+	validate := validator.New()
+	validate.RegisterTagNameFunc(jsonTagName)
 
-			if key == "roles" {
-				for _, v := range valueArray {
-					scopeArray = append(scopeArray, v.(string))
-				}
-			}
+	err = validate.Struct(claims)
+
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		var missing []string
+
+		for _, err := range validationErrors {
+			missing = append(missing, err.Field())
 		}
 
-		log.Info().Msgf("RBACMiddleware: scopeArray=%v\n", scopeArray)
+		return nil, fmt.Errorf("Missing token claims: %s.", strings.Join(missing, ", "))
+	}
 
-		ctx = context.WithValue(ctx, "scope", scopeArray)
+	if err != nil {
+		return nil, err
+	}
 
-		//TODO: Add other claims to context
+	return &claims, nil
+}
 
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+// Names validation errors after the JSON claim instead of the struct field
+func jsonTagName(field reflect.StructField) string {
+	return strings.Split(field.Tag.Get("json"), ",")[0]
 }
 
-// Checks if the user has the required scope to access the route
+// Checks if the user has the required role to access the route
+// Returns 401 if the route is not behind `RBACMiddleware`
 func RBACMiddlewareProtectedRoute(scopeRequired string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			scope := r.Context().Value("scope").([]string)
-			// scope := r.Context().Value("scope").([]interface{})
+			principal, ok := authorization.FromContext(r.Context())
+			if !ok {
+				log.Error().Msg("RBACMiddlewareProtectedRoute: no principal in context")
+				helpers.ErrorJSON(w, errors.New("Authentication required."), http.StatusUnauthorized)
+				return
+			}
 
-			log.Info().Msgf("RBACMiddlewareProtectedRoute: scope=%v\n", scope)
+			log.Info().Msgf("RBACMiddlewareProtectedRoute: roles=%v\n", principal.Roles)
 			log.Info().Msgf("RBACMiddlewareProtectedRoute: scopeRequired=%v\n", scopeRequired)
 
-			if !helpers.Contains(scope, scopeRequired) {
-				log.Info().Msgf("RBACMiddlewareProtectedRoute: scopeRequired=%v not found in scope=%v\n", scopeRequired, scope)
+			if !principal.HasRole(scopeRequired) {
+				log.Info().Msgf("RBACMiddlewareProtectedRoute: scopeRequired=%v not found in roles=%v\n", scopeRequired, principal.Roles)
 
 				un := struct {
 					Error   bool   `json:"error"`
@@ -107,3 +163,42 @@ func RBACMiddlewareProtectedRoute(scopeRequired string) func(http.Handler) http.
 		})
 	}
 }
+
+// Restricts the route to the user named by the `id` or `email` URL parameter and to admins
+func RequireSelfOrAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := authorization.FromContext(r.Context())
+		if !ok {
+			helpers.ErrorJSON(w, errors.New("Authentication required."), http.StatusUnauthorized)
+			return
+		}
+
+		id := uuid.FromStringOrNil(chi.URLParam(r, "id"))
+		email := chi.URLParam(r, "email")
+
+		if !principal.CanManageUser(id, email) {
+			helpers.ErrorJSON(w, errors.New("You can only access your own user."), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Restricts the route to moderators and admins
+func RequireModerator(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := authorization.FromContext(r.Context())
+		if !ok {
+			helpers.ErrorJSON(w, errors.New("Authentication required."), http.StatusUnauthorized)
+			return
+		}
+
+		if !principal.CanModerate() {
+			helpers.ErrorJSON(w, errors.New("Only moderators can access this resource."), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
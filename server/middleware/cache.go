@@ -2,7 +2,9 @@
 package middleware
 
 import (
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -14,9 +16,11 @@ import (
 )
 
 // Prepare route key for caching
+// The query is hashed so filters such as emails don't end up in the keys
 func PrepareRouteKey(r *http.Request) (string, error) {
+	query := sha256.Sum256([]byte(r.URL.RawQuery))
 
-	return r.Method + "." + r.URL.Path + "." + r.URL.RawQuery, nil
+	return r.Method + "." + r.URL.Path + "." + hex.EncodeToString(query[:]), nil
 }
 
 // Returns a base64 encoded string of the payload with the route and method prepended
@@ -61,14 +65,20 @@ func StringifyResponse(response interface{}) (string, error) {
 	return string(stringResponse), nil
 }
 
-// Save the response to cache after stringifying it
-func SaveToCache(r *http.Request, response interface{}) (string, error) {
+// Response body and headers persisted in the cache
+type CachedResponse struct {
+	Headers http.Header     `json:"headers,omitempty"`
+	Body    json.RawMessage `json:"body"`
+}
+
+// Save the response and optional headers to cache after stringifying them
+func SaveToCache(r *http.Request, response interface{}, headers ...http.Header) (string, error) {
 
 	// Prepare the cache key
 	routeKey, err := PrepareRouteKey(r)
 
 	if err != nil {
-		log.Fatal().Err(err).Msg("Error preparing route key")
+		log.Error().Err(err).Msg("Error preparing route key")
 		return "", err
 	}
 
@@ -77,39 +87,63 @@ func SaveToCache(r *http.Request, response interface{}) (string, error) {
 	cacheKey, err := PrepareCacheKey(r.Body, routeKey)
 
 	if err != nil {
-		log.Fatal().Err(err).Msg("Error preparing cache key")
+		log.Error().Err(err).Msg("Error preparing cache key")
 		return "", err
 	}
 
-	// Stringify the response
-	stringResponse, err := StringifyResponse(response)
+	err = StoreCachedResponse(cacheKey, response, 0, headers...)
 
 	if err != nil {
-		log.Fatal().Err(err).Msg("Error stringifying response")
 		return "", err
 	}
 
-	// Save to cache
-	err = redis.SetCache(cacheKey, stringResponse, 0)
+	// log.Info().Msgf("Successfully saved to cache: %s", cacheKey)
+
+	return cacheKey, nil
+}
+
+// Save the response and optional headers under the key, 0 uses the default TTL
+func StoreCachedResponse(cacheKey string, response interface{}, ttl time.Duration, headers ...http.Header) error {
+
+	// Stringify the response
+	body, err := StringifyResponse(response)
 
 	if err != nil {
-		log.Fatal().Err(err).Msg("Error saving to cache")
-		return "", err
+		log.Error().Err(err).Msg("Error stringifying response")
+		return err
 	}
 
-	// log.Info().Msgf("Successfully saved to cache: %s", cacheKey)
+	cached := CachedResponse{Body: json.RawMessage(body)}
+	if len(headers) > 0 {
+		cached.Headers = headers[0]
+	}
 
-	return cacheKey, nil
+	stringResponse, err := StringifyResponse(cached)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error stringifying cached response")
+		return err
+	}
+
+	// Save to cache
+	err = redis.SetCache(cacheKey, stringResponse, ttl)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error saving to cache")
+		return err
+	}
+
+	return nil
 }
 
-// Get the cached response and convert it to JSON
-func CachedResponseToJSON(cacheKey string) ([]map[string]interface{}, error) {
+// Get the cached response, nil if there is none
+func CachedResponseToJSON(cacheKey string) (*CachedResponse, error) {
 
 	// Get from cache
 	cachedResponse, err := redis.GetCache(cacheKey)
 
 	if err != nil {
-		log.Fatal().Err(err).Msg("Error getting from cache")
+		log.Error().Err(err).Msg("Error getting from cache")
 		return nil, nil
 	}
 
@@ -120,20 +154,17 @@ func CachedResponseToJSON(cacheKey string) ([]map[string]interface{}, error) {
 
 	// log.Info().Msgf("cachedResponse: %s", cachedResponse)
 
-	var cachedResponseJSON []map[string]interface{}
-	// var cachedResponseJSON interface{}
+	var cachedResponseJSON CachedResponse
 
 	err = json.Unmarshal([]byte(cachedResponse), &cachedResponseJSON)
 
-	if err != nil {
-		log.Fatal().Err(err).Msg("Error unmarshalling cached response")
-		return nil, err
+	// Entries written in another format are treated as a miss
+	if err != nil || len(cachedResponseJSON.Body) == 0 {
+		log.Error().Err(err).Msg("Error unmarshalling cached response")
+		return nil, nil
 	}
 
-	// log.Info().Msgf("cachedResponseJSON: %v", cachedResponseJSON)
-	// log.Info().Msgf("cachedResponseJSON: %t", cachedResponseJSON)
-
-	return cachedResponseJSON, nil
+	return &cachedResponseJSON, nil
 }
 
 // redis cache middleware
@@ -147,33 +178,27 @@ func CacheMiddleware(ttl time.Duration) func(http.Handler) http.Handler {
 
 			routeKey, err := PrepareRouteKey(r)
 			if err != nil {
-				log.Fatal().Err(err).Msg("Error preparing route key")
+				log.Error().Err(err).Msg("Error preparing route key")
+				next.ServeHTTP(w, r)
 				return
 			}
 
 			cacheKey, err := PrepareCacheKey(r.Body, routeKey)
 			if err != nil {
-				log.Fatal().Err(err).Msg("Error preparing cache key")
-				return
-			}
-
-			cachedResponseJSON, err := CachedResponseToJSON(cacheKey)
-			if err != nil {
-				log.Fatal().Err(err).Msg("Error getting cached response")
+				log.Error().Err(err).Msg("Error preparing cache key")
+				next.ServeHTTP(w, r)
 				return
 			}
 
-			if cachedResponseJSON == nil {
+			cachedResponse, err := CachedResponseToJSON(cacheKey)
+			if err != nil || cachedResponse == nil {
 				// log.Info().Msgf("No cached response found for %s", cacheKey)
-				// return
 				next.ServeHTTP(w, r)
-			}
-
-			if len(cachedResponseJSON) > 0 {
-				// log.Info().Msgf("Sending CachedResponse %v", cachedResponseJSON)
-				helpers.WriteJSON(w, http.StatusOK, cachedResponseJSON)
 				return
 			}
+
+			// log.Info().Msgf("Sending CachedResponse %v", cachedResponse)
+			helpers.WriteJSON(w, http.StatusOK, cachedResponse.Body, cachedResponse.Headers)
 		})
 	}
 }
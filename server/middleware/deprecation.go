@@ -0,0 +1,25 @@
+// Middleware announcing the deprecation of routes
+package middleware
+
+import (
+	"net/http"
+	"time"
+)
+
+// Marks the routes as deprecated with the `Deprecation` and `Sunset` (RFC 8594) headers
+// `successor` is linked with `rel="successor-version"` when it is not empty, it must be
+// a URI rather than a template (RFC 8288)
+func Deprecated(sunset time.Time, successor string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", "true")
+			w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+
+			if successor != "" {
+				w.Header().Add("Link", "<"+successor+`>; rel="successor-version"`)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
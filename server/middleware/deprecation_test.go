@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeprecated(t *testing.T) {
+	sunset := time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)
+
+	handler := Deprecated(sunset, "/api/v1/users")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/users/alice@example.com", nil))
+
+	assert.Equal(t, "true", rec.Header().Get("Deprecation"))
+	assert.Equal(t, "Mon, 01 Apr 2024 00:00:00 GMT", rec.Header().Get("Sunset"))
+	assert.Equal(t, `</api/v1/users>; rel="successor-version"`, rec.Header().Get("Link"))
+}
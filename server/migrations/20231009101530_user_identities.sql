@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS user_identities (
+  id UUID PRIMARY KEY NOT NULL DEFAULT (uuid_generate_v4()),
+  user_id UUID NOT NULL,
+  provider VARCHAR(50) NOT NULL,
+  subject VARCHAR(255) NOT NULL,
+  email VARCHAR(255),
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+  UNIQUE (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS user_identities_user_id_idx ON user_identities (user_id);
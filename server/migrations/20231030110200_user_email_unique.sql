@@ -0,0 +1,6 @@
+-- Emails are stored lowercased, duplicates differing only by case must be merged before this runs
+UPDATE users SET email = LOWER(TRIM(email)) WHERE email <> LOWER(TRIM(email));
+UPDATE users SET pending_email = LOWER(TRIM(pending_email)) WHERE pending_email <> LOWER(TRIM(pending_email));
+
+-- Soft deleted users don't hold on to their email, restoring them may conflict
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_lower_key ON users (LOWER(email)) WHERE deleted_at IS NULL;
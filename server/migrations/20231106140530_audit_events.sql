@@ -0,0 +1,10 @@
+-- No foreign key, events outlive the users they are about
+CREATE TABLE IF NOT EXISTS audit_events (
+  id UUID PRIMARY KEY NOT NULL DEFAULT (uuid_generate_v4()),
+  user_id UUID,
+  action VARCHAR(100) NOT NULL,
+  metadata JSONB NOT NULL DEFAULT '{}',
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_user_id_idx ON audit_events (user_id, created_at);
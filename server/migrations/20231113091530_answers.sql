@@ -0,0 +1,38 @@
+CREATE TABLE IF NOT EXISTS answers (
+  id UUID PRIMARY KEY NOT NULL DEFAULT (uuid_generate_v4()),
+  question_id UUID NOT NULL,
+  user_id UUID NOT NULL,
+  body TEXT NOT NULL,
+  score INTEGER NOT NULL DEFAULT 0,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  FOREIGN KEY (question_id) REFERENCES questions (id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+-- Keyset pagination of a question's answers, by date or by score
+CREATE INDEX IF NOT EXISTS answers_question_id_created_at_idx ON answers (question_id, created_at, id);
+CREATE INDEX IF NOT EXISTS answers_question_id_score_idx ON answers (question_id, score, id);
+CREATE INDEX IF NOT EXISTS answers_user_id_idx ON answers (user_id);
+
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS accepted_answer_id UUID;
+
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'questions_accepted_answer_id_fkey') THEN
+    ALTER TABLE questions ADD CONSTRAINT questions_accepted_answer_id_fkey
+      FOREIGN KEY (accepted_answer_id) REFERENCES answers (id) ON DELETE SET NULL;
+  END IF;
+END $$;
+
+-- The single answer of existing questions becomes their first answer, written by the asker
+-- Skipped once the column is gone, so the migration can be run again
+DO $$
+BEGIN
+  IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'questions' AND column_name = 'answer') THEN
+    INSERT INTO answers (question_id, user_id, body, created_at, updated_at)
+      SELECT id, user_id, answer, created_at, updated_at FROM questions WHERE answer <> '';
+  END IF;
+END $$;
+
+ALTER TABLE questions DROP COLUMN IF EXISTS answer;
@@ -0,0 +1,28 @@
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS score INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS reputation INTEGER NOT NULL DEFAULT 0;
+
+-- One vote per user and item, the primary keys are the uniqueness constraint
+CREATE TABLE IF NOT EXISTS question_votes (
+  question_id UUID NOT NULL,
+  user_id UUID NOT NULL,
+  value SMALLINT NOT NULL CHECK (value IN (-1, 1)),
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (question_id, user_id),
+  FOREIGN KEY (question_id) REFERENCES questions (id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS answer_votes (
+  answer_id UUID NOT NULL,
+  user_id UUID NOT NULL,
+  value SMALLINT NOT NULL CHECK (value IN (-1, 1)),
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (answer_id, user_id),
+  FOREIGN KEY (answer_id) REFERENCES answers (id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS question_votes_user_id_idx ON question_votes (user_id);
+CREATE INDEX IF NOT EXISTS answer_votes_user_id_idx ON answer_votes (user_id);
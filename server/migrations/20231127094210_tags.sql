@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS tags (
+  id UUID PRIMARY KEY NOT NULL DEFAULT (uuid_generate_v4()),
+  name VARCHAR(35) NOT NULL UNIQUE,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS question_tags (
+  question_id UUID NOT NULL,
+  tag_id UUID NOT NULL,
+  PRIMARY KEY (question_id, tag_id),
+  FOREIGN KEY (question_id) REFERENCES questions (id) ON DELETE CASCADE,
+  FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS question_tags_tag_id_idx ON question_tags (tag_id, question_id);
+
+-- Alternative names resolved to their tag when questions are tagged or filtered
+CREATE TABLE IF NOT EXISTS tag_synonyms (
+  name VARCHAR(35) PRIMARY KEY NOT NULL,
+  tag_id UUID NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS tag_synonyms_tag_id_idx ON tag_synonyms (tag_id);
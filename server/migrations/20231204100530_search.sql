@@ -0,0 +1,9 @@
+-- Kept in sync by Postgres, weighted so the question text outranks the answers
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS search_vector tsvector
+  GENERATED ALWAYS AS (setweight(to_tsvector('english', question), 'A')) STORED;
+
+ALTER TABLE answers ADD COLUMN IF NOT EXISTS search_vector tsvector
+  GENERATED ALWAYS AS (setweight(to_tsvector('english', body), 'B')) STORED;
+
+CREATE INDEX IF NOT EXISTS questions_search_vector_idx ON questions USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS answers_search_vector_idx ON answers USING GIN (search_vector);
@@ -0,0 +1,36 @@
+-- Only published content is listed publicly, hidden content stays visible to its author
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'published'
+  CHECK (status IN ('published', 'hidden', 'removed'));
+ALTER TABLE answers ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'published'
+  CHECK (status IN ('published', 'hidden', 'removed'));
+
+-- Flags of questions and answers, no foreign key on the target so deleted content leaves
+-- rows that the moderation queue ignores
+CREATE TABLE IF NOT EXISTS flags (
+  id UUID PRIMARY KEY NOT NULL DEFAULT (uuid_generate_v4()),
+  target_type VARCHAR(16) NOT NULL CHECK (target_type IN ('question', 'answer')),
+  target_id UUID NOT NULL,
+  user_id UUID NOT NULL,
+  reason TEXT NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  resolved_at TIMESTAMP WITH TIME ZONE,
+  UNIQUE (target_type, target_id, user_id),
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS flags_open_idx ON flags (target_type, target_id) WHERE resolved_at IS NULL;
+
+-- Every status change with its reason, moderator_id is NULL for automatic hiding
+CREATE TABLE IF NOT EXISTS moderation_decisions (
+  id UUID PRIMARY KEY NOT NULL DEFAULT (uuid_generate_v4()),
+  target_type VARCHAR(16) NOT NULL CHECK (target_type IN ('question', 'answer')),
+  target_id UUID NOT NULL,
+  moderator_id UUID,
+  action VARCHAR(16) NOT NULL,
+  status VARCHAR(16) NOT NULL,
+  reason TEXT NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  FOREIGN KEY (moderator_id) REFERENCES users (id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS moderation_decisions_target_idx ON moderation_decisions (target_type, target_id, created_at);
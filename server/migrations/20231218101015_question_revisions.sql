@@ -0,0 +1,15 @@
+-- Text of a question before and after each edit, user_id is the editor
+CREATE TABLE IF NOT EXISTS question_revisions (
+  id UUID PRIMARY KEY NOT NULL DEFAULT (uuid_generate_v4()),
+  question_id UUID NOT NULL,
+  user_id UUID,
+  before TEXT NOT NULL,
+  after TEXT NOT NULL,
+  rollback_of UUID, -- Revision undone by this one
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  FOREIGN KEY (question_id) REFERENCES questions (id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL,
+  FOREIGN KEY (rollback_of) REFERENCES question_revisions (id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS question_revisions_question_id_idx ON question_revisions (question_id, created_at, id);
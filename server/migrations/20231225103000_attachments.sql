@@ -0,0 +1,29 @@
+-- Uploaded files, stored once per content hash. Unreferenced blobs are deleted once
+-- last_used_at is older than the grace period
+CREATE TABLE IF NOT EXISTS blobs (
+  sha256 CHAR(64) PRIMARY KEY NOT NULL,
+  size BIGINT NOT NULL,
+  content_type VARCHAR(255) NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  last_used_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Files attached to questions, user_id is the uploader
+CREATE TABLE IF NOT EXISTS attachments (
+  id UUID PRIMARY KEY NOT NULL DEFAULT (uuid_generate_v4()),
+  question_id UUID NOT NULL,
+  user_id UUID,
+  sha256 CHAR(64) NOT NULL,
+  filename VARCHAR(255) NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  FOREIGN KEY (question_id) REFERENCES questions (id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL,
+  FOREIGN KEY (sha256) REFERENCES blobs (sha256)
+);
+
+CREATE INDEX IF NOT EXISTS attachments_question_id_idx ON attachments (question_id, created_at);
+CREATE INDEX IF NOT EXISTS attachments_sha256_idx ON attachments (sha256);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS avatar_sha256 CHAR(64) REFERENCES blobs (sha256);
+
+CREATE INDEX IF NOT EXISTS users_avatar_sha256_idx ON users (avatar_sha256) WHERE avatar_sha256 IS NOT NULL;
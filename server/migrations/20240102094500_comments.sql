@@ -0,0 +1,42 @@
+-- Comments on questions, or on one of their answers when answer_id is set. Deleted comments
+-- keep their row as a tombstone with an empty body so replies stay in place
+CREATE TABLE IF NOT EXISTS comments (
+  id UUID PRIMARY KEY NOT NULL DEFAULT (uuid_generate_v4()),
+  question_id UUID NOT NULL,
+  answer_id UUID,
+  parent_id UUID, -- Comment replied to, on the same question or answer
+  user_id UUID,
+  body TEXT NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  deleted_at TIMESTAMP WITH TIME ZONE,
+  FOREIGN KEY (question_id) REFERENCES questions (id) ON DELETE CASCADE,
+  FOREIGN KEY (answer_id) REFERENCES answers (id) ON DELETE CASCADE,
+  FOREIGN KEY (parent_id) REFERENCES comments (id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS comments_question_id_idx ON comments (question_id, created_at, id) WHERE answer_id IS NULL;
+CREATE INDEX IF NOT EXISTS comments_answer_id_idx ON comments (answer_id, created_at, id) WHERE answer_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS comments_user_id_idx ON comments (user_id);
+
+-- Notifications of a user, e.g. when mentioned in a comment
+CREATE TABLE IF NOT EXISTS notifications (
+  id UUID PRIMARY KEY NOT NULL DEFAULT (uuid_generate_v4()),
+  user_id UUID NOT NULL,
+  type VARCHAR(32) NOT NULL,
+  actor_id UUID,
+  question_id UUID,
+  answer_id UUID,
+  comment_id UUID,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  read_at TIMESTAMP WITH TIME ZONE,
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+  FOREIGN KEY (actor_id) REFERENCES users (id) ON DELETE SET NULL,
+  FOREIGN KEY (question_id) REFERENCES questions (id) ON DELETE CASCADE,
+  FOREIGN KEY (answer_id) REFERENCES answers (id) ON DELETE CASCADE,
+  FOREIGN KEY (comment_id) REFERENCES comments (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS notifications_user_id_idx ON notifications (user_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS notifications_unread_idx ON notifications (user_id) WHERE read_at IS NULL;
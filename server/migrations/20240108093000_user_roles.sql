@@ -0,0 +1,8 @@
+-- Roles of users signing in with a password, directory users get theirs from LDAP groups
+CREATE TABLE IF NOT EXISTS user_roles (
+  user_id UUID NOT NULL,
+  role VARCHAR(50) NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (user_id, role),
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,244 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+type Answer struct {
+	ID         uuid.UUID `json:"id"`
+	QuestionID uuid.UUID `json:"question_id"`
+	UserID     uuid.UUID `json:"user_id"`
+	Body       string    `json:"body"`
+	Score      int       `json:"score"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	Status     string    `json:"status"` // Set by moderation, only published answers are listed
+}
+
+// Columns read by `scanAnswer`
+const answerColumns = `id, question_id, user_id, body, score, created_at, updated_at, status`
+
+func scanAnswer(row rowScanner) (*Answer, error) {
+	var answer Answer
+	err := row.Scan(&answer.ID, &answer.QuestionID, &answer.UserID, &answer.Body, &answer.Score, &answer.CreatedAt, &answer.UpdatedAt, &answer.Status)
+	if err != nil {
+		return nil, err
+	}
+
+	return &answer, nil
+}
+
+func (a *Answer) Create(answer Answer) (*Answer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	query := `INSERT INTO answers (question_id, user_id, body, created_at, updated_at) VALUES ($1, $2, $3, $4, $4) RETURNING ` + answerColumns
+
+	created, err := scanAnswer(db.QueryRowContext(ctx, query, answer.QuestionID, answer.UserID, answer.Body, time.Now()))
+	if err != nil {
+		log.Error().Err(err).Msg("Error creating answer")
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// Returns the answer with the given ID
+func (a *Answer) FindByID(id uuid.UUID) (*Answer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	query := `SELECT ` + answerColumns + ` FROM answers WHERE id = $1`
+
+	answer, err := scanAnswer(db.QueryRowContext(ctx, query, id))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("No answer found")
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error finding answer")
+		return nil, err
+	}
+
+	return answer, nil
+}
+
+// Returns the answers written by the user
+func (a *Answer) FindByUserID(userID uuid.UUID) ([]*Answer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	query := `SELECT ` + answerColumns + ` FROM answers WHERE user_id = $1 ORDER BY created_at`
+
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanAll(rows, scanAnswer)
+}
+
+// Columns answers can be sorted by, keyed by the `sort` parameter
+var answerSortColumns = map[string]string{
+	"created_at": "created_at",
+	"score":      "score",
+}
+
+// Highest voted first
+const DefaultAnswerSort = "-score"
+
+// Ordering and page of the answers to a question
+type AnswerListParams struct {
+	QuestionID uuid.UUID
+	Limit      int
+	Cursor     *Cursor
+	Sort       string // Column, prefixed with `-` for descending order
+}
+
+// Checks the sort parameter against the whitelist
+func ValidAnswerSort(sort string) bool {
+	_, ok := answerSortColumns[strings.TrimPrefix(sort, "-")]
+	return ok
+}
+
+// Returns a page of the published answers to a question using keyset pagination
+// The returned cursor is nil on the last page
+func (a *Answer) List(params AnswerListParams) ([]*Answer, *Cursor, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	if params.Limit <= 0 || params.Limit > MaxPageLimit {
+		params.Limit = DefaultPageLimit
+	}
+
+	if params.Sort == "" {
+		params.Sort = DefaultAnswerSort
+	}
+
+	column, ok := answerSortColumns[strings.TrimPrefix(params.Sort, "-")]
+	if !ok {
+		return nil, nil, errors.New("Invalid sort")
+	}
+
+	direction, comparison := "ASC", ">"
+	if strings.HasPrefix(params.Sort, "-") {
+		direction, comparison = "DESC", "<"
+	}
+
+	var args []interface{}
+
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	conditions := []string{"question_id = " + arg(params.QuestionID), "status = " + arg(StatusPublished)}
+
+	if params.Cursor != nil {
+		if params.Cursor.Sort != params.Sort {
+			return nil, nil, ErrInvalidCursor
+		}
+
+		var value interface{}
+		var err error
+
+		switch column {
+		case "created_at":
+			value, err = time.Parse(time.RFC3339Nano, params.Cursor.Value)
+		case "score":
+			value, err = strconv.Atoi(params.Cursor.Value)
+		}
+		if err != nil {
+			return nil, nil, ErrInvalidCursor
+		}
+
+		conditions = append(conditions, fmt.Sprintf("(%s, id) %s (%s, %s)", column, comparison, arg(value), arg(params.Cursor.ID)))
+	}
+
+	query := `SELECT ` + answerColumns + ` FROM answers WHERE ` + strings.Join(conditions, " AND ")
+	query += fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT %s", column, direction, direction, arg(params.Limit+1))
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Error().Err(err).Msg("Error listing answers")
+		return nil, nil, err
+	}
+
+	answers, err := scanAll(rows, scanAnswer)
+	if err != nil {
+		log.Error().Err(err).Msg("Error scanning answers")
+		return nil, nil, err
+	}
+
+	if len(answers) <= params.Limit {
+		return answers, nil, nil
+	}
+
+	answers = answers[:params.Limit]
+	last := answers[len(answers)-1]
+
+	next := &Cursor{Sort: params.Sort, ID: last.ID}
+	switch column {
+	case "created_at":
+		next.Value = last.CreatedAt.Format(time.RFC3339Nano)
+	case "score":
+		next.Value = strconv.Itoa(last.Score)
+	}
+
+	return answers, next, nil
+}
+
+// Replaces the body of the answer with the given ID
+func (a *Answer) Update(id uuid.UUID, answer Answer) (*Answer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	query := `UPDATE answers SET body = $1, updated_at = $2 WHERE id = $3 RETURNING ` + answerColumns
+
+	updated, err := scanAnswer(db.QueryRowContext(ctx, query, answer.Body, time.Now(), id))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("No answer found")
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error updating answer")
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// Deletes the answer with the given ID, the question no longer has an accepted answer if it was
+func (a *Answer) DeleteByID(id uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, `DELETE FROM answers WHERE id = $1`, id)
+	if err != nil {
+		log.Error().Err(err).Msg("Error deleting answer")
+		return err
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return errors.New("No answer found")
+	}
+
+	return nil
+}
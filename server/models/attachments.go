@@ -0,0 +1,133 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// Most files attached to one question
+const MaxQuestionAttachments = 10
+
+var (
+	ErrTooManyAttachments = fmt.Errorf("A question has at most %d attachments", MaxQuestionAttachments)
+	ErrAttachmentNotFound = errors.New("No attachment found")
+)
+
+// File attached to a question
+type Attachment struct {
+	ID         uuid.UUID  `json:"id"`
+	QuestionID uuid.UUID  `json:"question_id"`
+	UserID     *uuid.UUID `json:"user_id"` // Uploader, nil once purged
+	Filename   string     `json:"filename"`
+	CreatedAt  time.Time  `json:"created_at"`
+
+	Blob
+}
+
+// Columns read by `scanAttachment`, `a` is attachments and `b` blobs
+const attachmentColumns = `a.id, a.question_id, a.user_id, a.filename, a.created_at, b.sha256, b.size, b.content_type`
+
+func scanAttachment(row rowScanner) (*Attachment, error) {
+	var attachment Attachment
+	err := row.Scan(&attachment.ID, &attachment.QuestionID, &attachment.UserID, &attachment.Filename, &attachment.CreatedAt,
+		&attachment.SHA256, &attachment.Size, &attachment.ContentType)
+	if err != nil {
+		return nil, err
+	}
+
+	return &attachment, nil
+}
+
+// Attaches the blob to the question, `ErrTooManyAttachments` once it has `MaxQuestionAttachments`
+func (a *Attachment) Create(attachment Attachment) (*Attachment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	// Locking the question keeps concurrent uploads from exceeding the limit
+	var id uuid.UUID
+
+	err = tx.QueryRowContext(ctx, `SELECT id FROM questions WHERE id = $1 FOR UPDATE`, attachment.QuestionID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("No question found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var count int
+
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM attachments WHERE question_id = $1`, attachment.QuestionID).Scan(&count)
+	if err != nil {
+		return nil, err
+	}
+
+	if count >= MaxQuestionAttachments {
+		return nil, ErrTooManyAttachments
+	}
+
+	if err := upsertBlob(ctx, tx, attachment.Blob); err != nil {
+		return nil, err
+	}
+
+	attachment.CreatedAt = time.Now()
+
+	err = tx.QueryRowContext(ctx, `INSERT INTO attachments (question_id, user_id, sha256, filename, created_at) VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		attachment.QuestionID, attachment.UserID, attachment.SHA256, attachment.Filename, attachment.CreatedAt).Scan(&attachment.ID)
+	if err != nil {
+		log.Error().Err(err).Msg("Error creating attachment")
+		return nil, err
+	}
+
+	return &attachment, tx.Commit()
+}
+
+// Returns the attachments of the question, oldest first
+func (a *Attachment) FindByQuestionID(questionID uuid.UUID) ([]*Attachment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	query := `SELECT ` + attachmentColumns + ` FROM attachments a JOIN blobs b ON b.sha256 = a.sha256
+		WHERE a.question_id = $1 ORDER BY a.created_at, a.id`
+
+	rows, err := db.QueryContext(ctx, query, questionID)
+	if err != nil {
+		log.Error().Err(err).Msg("Error finding attachments")
+		return nil, err
+	}
+
+	return scanAll(rows, scanAttachment)
+}
+
+// Deletes the attachment of the question, the blob is left to `Blob.PurgeUnused`
+func (a *Attachment) Delete(questionID uuid.UUID, id uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, `DELETE FROM attachments WHERE id = $1 AND question_id = $2`, id, questionID)
+	if err != nil {
+		log.Error().Err(err).Msg("Error deleting attachment")
+		return err
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrAttachmentNotFound
+	}
+
+	return nil
+}
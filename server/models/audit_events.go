@@ -0,0 +1,96 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// Actions recorded in the audit log
+const (
+	AuditDataExportRequested = "user.data_export_requested"
+	AuditUserErased          = "user.erased"
+)
+
+// Something that happened to a user, kept for accountability
+// Metadata must not hold personal data, events outlive erasure
+type AuditEvent struct {
+	ID        uuid.UUID       `json:"id"`
+	UserID    uuid.UUID       `json:"user_id"`
+	Action    string          `json:"action"`
+	Metadata  json.RawMessage `json:"metadata"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Columns read by `scanAuditEvent`
+const auditEventColumns = `id, user_id, action, metadata, created_at`
+
+func scanAuditEvent(row rowScanner) (*AuditEvent, error) {
+	var event AuditEvent
+	var metadata []byte
+
+	err := row.Scan(&event.ID, &event.UserID, &event.Action, &metadata, &event.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	event.Metadata = json.RawMessage(metadata)
+
+	return &event, nil
+}
+
+// Satisfied by both the pool and transactions
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Records an event about the user
+func (e *AuditEvent) Record(userID uuid.UUID, action string, metadata map[string]interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	return recordAuditEvent(ctx, db, userID, action, metadata)
+}
+
+func recordAuditEvent(ctx context.Context, exec execer, userID uuid.UUID, action string, metadata map[string]interface{}) error {
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO audit_events (user_id, action, metadata, created_at) VALUES ($1, $2, $3, $4)`
+
+	_, err = exec.ExecContext(ctx, query, userID, action, string(encoded), time.Now())
+	if err != nil {
+		log.Error().Err(err).Msg("Error recording audit event")
+		return err
+	}
+
+	return nil
+}
+
+// Returns the events about the user, oldest first
+func (e *AuditEvent) FindByUserID(userID uuid.UUID) ([]*AuditEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	query := `SELECT ` + auditEventColumns + ` FROM audit_events WHERE user_id = $1 ORDER BY created_at, id`
+
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		log.Error().Err(err).Msg("Error finding audit events")
+		return nil, err
+	}
+
+	return scanAll(rows, scanAuditEvent)
+}
@@ -0,0 +1,198 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+var ErrNoAvatar = errors.New("No avatar found")
+
+// Uploaded file, identified by the SHA-256 hash of its content
+type Blob struct {
+	SHA256      string `json:"sha256"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type"`
+
+	URL          string     `json:"url,omitempty"` // Signed download URL, set by the handlers
+	URLExpiresAt *time.Time `json:"url_expires_at,omitempty"`
+}
+
+// Records the blob, or marks an identical one as used so it outlives the grace period
+func upsertBlob(ctx context.Context, tx *sql.Tx, blob Blob) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO blobs (sha256, size, content_type, created_at, last_used_at) VALUES ($1, $2, $3, $4, $4)
+		ON CONFLICT (sha256) DO UPDATE SET last_used_at = EXCLUDED.last_used_at`,
+		blob.SHA256, blob.Size, blob.ContentType, time.Now())
+	if err != nil {
+		log.Error().Err(err).Msg("Error recording blob")
+	}
+
+	return err
+}
+
+// Records the blob before its file is stored, or marks an identical one as used
+// A purge of the blob running meanwhile finishes deleting the file first, so the caller
+// finds it missing and stores it again. Otherwise it is kept for the grace period
+func (b *Blob) Touch(blob Blob) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := upsertBlob(ctx, tx, blob); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Blobs no attachment or avatar references and unused since the time of the placeholder
+const unusedBlobCondition = `b.last_used_at < %s
+	AND NOT EXISTS (SELECT 1 FROM attachments a WHERE a.sha256 = b.sha256)
+	AND NOT EXISTS (SELECT 1 FROM users u WHERE u.avatar_sha256 = b.sha256)`
+
+// Deletes the blobs no attachment or avatar references and unused since `before`, and
+// their files with `remove`. Returns the hashes of the blobs deleted
+// Each row stays locked until its file is removed, and is kept if that fails
+func (b *Blob) PurgeUnused(before time.Time, remove func(hash string) error) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `SELECT b.sha256 FROM blobs b WHERE `+fmt.Sprintf(unusedBlobCondition, "$1"), before)
+	if err != nil {
+		log.Error().Err(err).Msg("Error listing unused blobs")
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var candidates []string
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, err
+		}
+
+		candidates = append(candidates, hash)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var purged []string
+
+	for _, hash := range candidates {
+		deleted, err := purgeBlob(hash, before, remove)
+		if err != nil {
+			log.Error().Err(err).Str("sha256", hash).Msg("Error purging unused blob")
+			continue
+		}
+
+		if deleted {
+			purged = append(purged, hash)
+		}
+	}
+
+	return purged, nil
+}
+
+// Deletes the blob if it is still unused and its file, false if it was used meanwhile
+func purgeBlob(hash string, before time.Time, remove func(hash string) error) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+
+	defer tx.Rollback()
+
+	// Uploads touching the blob wait on the deleted row until the file is gone
+	err = tx.QueryRowContext(ctx, `DELETE FROM blobs b WHERE b.sha256 = $1 AND `+fmt.Sprintf(unusedBlobCondition, "$2")+` RETURNING b.sha256`, hash, before).Scan(&hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err := remove(hash); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// Returns the avatar of the user with the given ID, `ErrNoAvatar` if it has none
+func (u *User) FindAvatar(id uuid.UUID) (*Blob, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	query := `SELECT b.sha256, b.size, b.content_type FROM users u JOIN blobs b ON b.sha256 = u.avatar_sha256
+		WHERE u.id = $1 AND u.deleted_at IS NULL`
+
+	var blob Blob
+
+	err := db.QueryRowContext(ctx, query, id).Scan(&blob.SHA256, &blob.Size, &blob.ContentType)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoAvatar
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &blob, nil
+}
+
+// Sets the avatar of the user with the given ID, nil removes it
+// The previous blob is left to `PurgeUnused`
+func (u *User) SetAvatar(id uuid.UUID, blob *Blob) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	var hash *string
+
+	if blob != nil {
+		if err := upsertBlob(ctx, tx, *blob); err != nil {
+			return err
+		}
+
+		hash = &blob.SHA256
+	}
+
+	result, err := tx.ExecContext(ctx, `UPDATE users SET avatar_sha256 = $1, updated_at = $2 WHERE id = $3 AND deleted_at IS NULL`, hash, time.Now(), id)
+	if err != nil {
+		log.Error().Err(err).Msg("Error setting avatar")
+		return err
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrUserNotFound
+	}
+
+	return tx.Commit()
+}
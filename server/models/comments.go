@@ -0,0 +1,366 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// Comments embedded in a question by default, and the most mentions notified per comment
+const (
+	DefaultEmbeddedComments = 5
+	MaxCommentMentions      = 5
+)
+
+var (
+	ErrCommentNotFound = errors.New("No comment found")
+	ErrCommentDeleted  = errors.New("The comment was deleted")
+	ErrInvalidParent   = errors.New("Replies must be on the same question or answer as their parent")
+)
+
+// Matches `@name` after a space or punctuation, names are compared without spaces
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([\p{L}\p{N}_.\-]+)`)
+
+// Comment on a question, or on one of its answers when `AnswerID` is set
+// Deleted comments are tombstones with an empty body and no author
+type Comment struct {
+	ID         uuid.UUID  `json:"id"`
+	QuestionID uuid.UUID  `json:"question_id"`
+	AnswerID   *uuid.UUID `json:"answer_id"`
+	ParentID   *uuid.UUID `json:"parent_id"` // Comment replied to
+	UserID     *uuid.UUID `json:"user_id"`
+	Body       string     `json:"body"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	DeletedAt  *time.Time `json:"deleted_at,omitempty"`
+}
+
+// Columns read by `scanComment`
+const commentColumns = `id, question_id, answer_id, parent_id, user_id, body, created_at, updated_at, deleted_at`
+
+func scanComment(row rowScanner) (*Comment, error) {
+	var comment Comment
+	err := row.Scan(&comment.ID, &comment.QuestionID, &comment.AnswerID, &comment.ParentID, &comment.UserID, &comment.Body,
+		&comment.CreatedAt, &comment.UpdatedAt, &comment.DeletedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &comment, nil
+}
+
+// Returns the lowercased names mentioned in the body, without duplicates
+func Mentions(body string) []string {
+	var names []string
+
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		// A mention ending a sentence keeps its name
+		name := strings.ToLower(strings.TrimRight(match[1], ".-"))
+
+		if name != "" && !containsString(names, name) {
+			names = append(names, name)
+		}
+
+		if len(names) == MaxCommentMentions {
+			break
+		}
+	}
+
+	return names
+}
+
+// Notifies the participants of the comment's question mentioned by name, except its author
+// Participants asked the question, answered it or commented on it
+func notifyMentions(ctx context.Context, tx *sql.Tx, comment *Comment, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	query := fmt.Sprintf(`INSERT INTO notifications (user_id, type, actor_id, question_id, answer_id, comment_id, created_at)
+		SELECT id, $1, $2, $3, $4, $5, $6 FROM users
+		WHERE deleted_at IS NULL AND id <> $2 AND LOWER(REPLACE(name, ' ', '')) IN (%s)
+			AND id IN (SELECT user_id FROM questions WHERE id = $3
+				UNION SELECT user_id FROM answers WHERE question_id = $3
+				UNION SELECT user_id FROM comments WHERE question_id = $3 AND user_id IS NOT NULL)`, placeholders(7, len(names)))
+
+	args := append([]interface{}{NotificationMention, comment.UserID, comment.QuestionID, comment.AnswerID, comment.ID, time.Now()}, stringArgs(names)...)
+
+	_, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		log.Error().Err(err).Msg("Error notifying mentions")
+	}
+
+	return err
+}
+
+// Creates the comment and notifies the users it mentions
+func (c *Comment) Create(comment Comment) (*Comment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	if comment.ParentID != nil {
+		var questionID uuid.UUID
+		var answerID *uuid.UUID
+		var deletedAt *time.Time
+
+		err = tx.QueryRowContext(ctx, `SELECT question_id, answer_id, deleted_at FROM comments WHERE id = $1`, *comment.ParentID).
+			Scan(&questionID, &answerID, &deletedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidParent
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		sameAnswer := (answerID == nil && comment.AnswerID == nil) || (answerID != nil && comment.AnswerID != nil && *answerID == *comment.AnswerID)
+		if questionID != comment.QuestionID || !sameAnswer {
+			return nil, ErrInvalidParent
+		}
+
+		if deletedAt != nil {
+			return nil, ErrCommentDeleted
+		}
+	}
+
+	query := `INSERT INTO comments (question_id, answer_id, parent_id, user_id, body, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6) RETURNING ` + commentColumns
+
+	created, err := scanComment(tx.QueryRowContext(ctx, query, comment.QuestionID, comment.AnswerID, comment.ParentID, comment.UserID, comment.Body, time.Now()))
+	if err != nil {
+		log.Error().Err(err).Msg("Error creating comment")
+		return nil, err
+	}
+
+	if err := notifyMentions(ctx, tx, created, Mentions(created.Body)); err != nil {
+		return nil, err
+	}
+
+	return created, tx.Commit()
+}
+
+// Returns the comment with the given ID, deleted ones included
+func (c *Comment) FindByID(id uuid.UUID) (*Comment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	comment, err := scanComment(db.QueryRowContext(ctx, `SELECT `+commentColumns+` FROM comments WHERE id = $1`, id))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCommentNotFound
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error finding comment")
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+// Returns the comments written by the user, deleted ones excluded
+func (c *Comment) FindByUserID(userID uuid.UUID) ([]*Comment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	query := `SELECT ` + commentColumns + ` FROM comments WHERE user_id = $1 AND deleted_at IS NULL ORDER BY created_at`
+
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanAll(rows, scanComment)
+}
+
+// Replaces the body of the comment, only the users newly mentioned are notified
+func (c *Comment) Update(id uuid.UUID, body string) (*Comment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	var before string
+	var deletedAt *time.Time
+
+	err = tx.QueryRowContext(ctx, `SELECT body, deleted_at FROM comments WHERE id = $1 FOR UPDATE`, id).Scan(&before, &deletedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCommentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if deletedAt != nil {
+		return nil, ErrCommentDeleted
+	}
+
+	query := `UPDATE comments SET body = $1, updated_at = $2 WHERE id = $3 RETURNING ` + commentColumns
+
+	updated, err := scanComment(tx.QueryRowContext(ctx, query, body, time.Now(), id))
+	if err != nil {
+		log.Error().Err(err).Msg("Error updating comment")
+		return nil, err
+	}
+
+	mentioned := Mentions(before)
+
+	var added []string
+	for _, name := range Mentions(body) {
+		if !containsString(mentioned, name) {
+			added = append(added, name)
+		}
+	}
+
+	if err := notifyMentions(ctx, tx, updated, added); err != nil {
+		return nil, err
+	}
+
+	return updated, tx.Commit()
+}
+
+// Replaces the comment by a tombstone so its replies stay in place, and withdraws its notifications
+func (c *Comment) Delete(id uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	result, err := tx.ExecContext(ctx, `UPDATE comments SET body = '', user_id = NULL, deleted_at = $1, updated_at = $1 WHERE id = $2 AND deleted_at IS NULL`, now, id)
+	if err != nil {
+		log.Error().Err(err).Msg("Error deleting comment")
+		return err
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrCommentNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM notifications WHERE comment_id = $1`, id)
+	if err != nil {
+		log.Error().Err(err).Msg("Error withdrawing comment notifications")
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Page of the comments on a question, or on one of its answers, oldest first
+type CommentListParams struct {
+	QuestionID uuid.UUID
+	AnswerID   *uuid.UUID // Nil for the comments on the question itself
+	Limit      int
+	Cursor     *Cursor
+}
+
+// Returns a page of the comments, tombstones included, using keyset pagination
+// The returned cursor is nil on the last page
+func (c *Comment) List(params CommentListParams) ([]*Comment, *Cursor, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	if params.Limit <= 0 || params.Limit > MaxPageLimit {
+		params.Limit = DefaultPageLimit
+	}
+
+	var args []interface{}
+
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	conditions := []string{"question_id = " + arg(params.QuestionID)}
+
+	if params.AnswerID != nil {
+		conditions = append(conditions, "answer_id = "+arg(*params.AnswerID))
+	} else {
+		conditions = append(conditions, "answer_id IS NULL")
+	}
+
+	if params.Cursor != nil {
+		createdAt, err := time.Parse(time.RFC3339Nano, params.Cursor.Value)
+		if err != nil || params.Cursor.Sort != "created_at" {
+			return nil, nil, ErrInvalidCursor
+		}
+
+		conditions = append(conditions, fmt.Sprintf("(created_at, id) > (%s, %s)", arg(createdAt), arg(params.Cursor.ID)))
+	}
+
+	query := `SELECT ` + commentColumns + ` FROM comments WHERE ` + strings.Join(conditions, " AND ")
+	query += " ORDER BY created_at, id LIMIT " + arg(params.Limit+1)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Error().Err(err).Msg("Error listing comments")
+		return nil, nil, err
+	}
+
+	comments, err := scanAll(rows, scanComment)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(comments) <= params.Limit {
+		return comments, nil, nil
+	}
+
+	comments = comments[:params.Limit]
+	last := comments[len(comments)-1]
+
+	return comments, &Cursor{Sort: "created_at", Value: last.CreatedAt.Format(time.RFC3339Nano), ID: last.ID}, nil
+}
+
+// Returns the first `limit` comments on the question itself and the number of comments not deleted
+func (c *Comment) Embedded(questionID uuid.UUID, limit int) ([]*Comment, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	var count int
+
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM comments WHERE question_id = $1 AND answer_id IS NULL AND deleted_at IS NULL`, questionID).Scan(&count)
+	if err != nil {
+		log.Error().Err(err).Msg("Error counting comments")
+		return nil, 0, err
+	}
+
+	if count == 0 || limit <= 0 {
+		return []*Comment{}, count, nil
+	}
+
+	comments, _, err := c.List(CommentListParams{QuestionID: questionID, Limit: limit})
+
+	return comments, count, err
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"errors"
+)
+
+// Returned when a user is created or renamed with an email another user has
+var ErrDuplicateEmail = errors.New("Email already in use")
+
+// Returned when no user matches the lookup, other errors come from the DB
+var ErrUserNotFound = errors.New("No user found")
+
+// SQLSTATE of unique constraint violations
+const uniqueViolation = "23505"
+
+// Checks if err is a unique constraint violation, for any of the Postgres drivers
+func isUniqueViolation(err error) bool {
+	var pgErr interface{ SQLState() string }
+
+	return errors.As(err, &pgErr) && pgErr.SQLState() == uniqueViolation
+}
@@ -1,17 +1,25 @@
 package models
 
-import "github.com/golang-jwt/jwt/v4"
+import (
+	"github.com/golang-jwt/jwt/v4"
 
+	"server/helpers"
+)
+
+// Claims of the access tokens issued and accepted by the server
+// The `validate` tags are the schema every accepted token must satisfy
 type JWTClaims struct {
 	*jwt.RegisteredClaims
-	Email       string      `json:"email,omitempty"`
-	AppMetadata AppMetadata `json:"app_metadata,omitempty"`
-	Issuer      string      `json:"iss,omitempty"`
-	Subject     string      `json:"sub,omitempty"`
-	Audience    string      `json:"aud,omitempty"`
-	Expiration  int64       `json:"exp,omitempty"`
-	IssuedAt    int64       `json:"iat,omitempty"`
-	JWTID       string      `json:"jti,omitempty"`
+	Email       string           `json:"email,omitempty"`
+	AppMetadata AppMetadata      `json:"app_metadata,omitempty"`
+	Roles       []string         `json:"roles,omitempty"`
+	Scope       string           `json:"scope,omitempty"`
+	Issuer      string           `json:"iss,omitempty"`
+	Subject     string           `json:"sub,omitempty" validate:"required"`
+	Audience    jwt.ClaimStrings `json:"aud,omitempty"`
+	Expiration  int64            `json:"exp,omitempty" validate:"required"`
+	IssuedAt    int64            `json:"iat,omitempty"`
+	JWTID       string           `json:"jti,omitempty"`
 }
 
 type AppMetadata struct {
@@ -41,3 +49,16 @@ func (jwtClaims *JWTClaims) AddRoles(roles []string) {
 func (jwtClaims *JWTClaims) AddRole(role string) {
 	jwtClaims.AppMetadata.Authorization.Roles = append(jwtClaims.AppMetadata.Authorization.Roles, role)
 }
+
+// Returns the roles from both the top-level `roles` claim and `app_metadata`
+func (jwtClaims *JWTClaims) AllRoles() []string {
+	var roles []string
+
+	for _, role := range append(jwtClaims.Roles, jwtClaims.AppMetadata.Authorization.Roles...) {
+		if role != "" && !helpers.Contains(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+
+	return roles
+}
@@ -0,0 +1,333 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// Lifecycle of questions and answers, only published content is listed publicly
+const (
+	StatusPublished = "published"
+	StatusHidden    = "hidden"  // Visible to its author and moderators
+	StatusRemoved   = "removed" // Visible to moderators only
+)
+
+// Kinds of content, as stored in `target_type` and returned by searches
+const (
+	ContentQuestion = "question"
+	ContentAnswer   = "answer"
+)
+
+var contentTables = map[string]string{
+	ContentQuestion: "questions",
+	ContentAnswer:   "answers",
+}
+
+// Moderation actions and the status they give the content
+var ModerationActions = map[string]string{
+	"approve": StatusPublished,
+	"hide":    StatusHidden,
+	"delete":  StatusRemoved,
+}
+
+// Recorded when content reaches the flag threshold
+const actionAutoHide = "auto_hide"
+
+var (
+	ErrOwnFlag       = errors.New("You can't flag your own content")
+	ErrDuplicateFlag = errors.New("You already flagged this content")
+)
+
+type Flag struct {
+	ID         uuid.UUID  `json:"id"`
+	Type       string     `json:"type"` // question or answer
+	TargetID   uuid.UUID  `json:"target_id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	Reason     string     `json:"reason"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ResolvedAt *time.Time `json:"resolved_at"` // Set once a moderator decides
+}
+
+// Columns read by `scanFlag`
+const flagColumns = `id, target_type, target_id, user_id, reason, created_at, resolved_at`
+
+func scanFlag(row rowScanner) (*Flag, error) {
+	var flag Flag
+	err := row.Scan(&flag.ID, &flag.Type, &flag.TargetID, &flag.UserID, &flag.Reason, &flag.CreatedAt, &flag.ResolvedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &flag, nil
+}
+
+// Returns the table of the content type
+func contentTable(contentType string) (string, error) {
+	table, ok := contentTables[contentType]
+	if !ok {
+		return "", fmt.Errorf("Invalid content type %q", contentType)
+	}
+
+	return table, nil
+}
+
+// Flags the content for moderators, it is hidden once it has `threshold` open flags
+// Returns the flag and the status of the content afterwards
+func (f *Flag) Create(contentType string, id uuid.UUID, userID uuid.UUID, reason string, threshold int) (*Flag, string, error) {
+	table, err := contentTable(contentType)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	defer tx.Rollback()
+
+	// Locking the content serializes the flags on it, so only one of them hides it
+	var authorID uuid.UUID
+	var status string
+
+	err = tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT user_id, status FROM %s WHERE id = $1 FOR UPDATE`, table), id).Scan(&authorID, &status)
+	if errors.Is(err, sql.ErrNoRows) || status == StatusRemoved {
+		return nil, "", fmt.Errorf("No %s found", contentType)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	if authorID == userID {
+		return nil, "", ErrOwnFlag
+	}
+
+	query := `INSERT INTO flags (target_type, target_id, user_id, reason, created_at) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (target_type, target_id, user_id) DO NOTHING RETURNING ` + flagColumns
+
+	flag, err := scanFlag(tx.QueryRowContext(ctx, query, contentType, id, userID, reason, time.Now()))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", ErrDuplicateFlag
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error flagging content")
+		return nil, "", err
+	}
+
+	var open int
+
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM flags WHERE target_type = $1 AND target_id = $2 AND resolved_at IS NULL`, contentType, id).Scan(&open)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if status == StatusPublished && threshold > 0 && open >= threshold {
+		status = StatusHidden
+
+		_, err = setContentStatus(ctx, tx, contentType, id, nil, actionAutoHide, status, fmt.Sprintf("Flagged by %d users", open))
+		if err != nil {
+			log.Error().Err(err).Msg("Error hiding flagged content")
+			return nil, "", err
+		}
+	}
+
+	return flag, status, tx.Commit()
+}
+
+// Status change of a question or answer
+type ModerationDecision struct {
+	ID          uuid.UUID  `json:"id"`
+	Type        string     `json:"type"`
+	TargetID    uuid.UUID  `json:"target_id"`
+	ModeratorID *uuid.UUID `json:"moderator_id"` // Nil when the content was hidden automatically
+	Action      string     `json:"action"`
+	Status      string     `json:"status"`
+	Reason      string     `json:"reason"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// Columns read by `scanModerationDecision`
+const moderationDecisionColumns = `id, target_type, target_id, moderator_id, action, status, reason, created_at`
+
+func scanModerationDecision(row rowScanner) (*ModerationDecision, error) {
+	var decision ModerationDecision
+	err := row.Scan(&decision.ID, &decision.Type, &decision.TargetID, &decision.ModeratorID, &decision.Action, &decision.Status, &decision.Reason, &decision.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &decision, nil
+}
+
+// Sets the status of the content and records the decision
+func setContentStatus(ctx context.Context, tx *sql.Tx, contentType string, id uuid.UUID, moderatorID *uuid.UUID, action string, status string, reason string) (*ModerationDecision, error) {
+	table, err := contentTable(contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET status = $1 WHERE id = $2`, table), status, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return nil, fmt.Errorf("No %s found", contentType)
+	}
+
+	query := `INSERT INTO moderation_decisions (target_type, target_id, moderator_id, action, status, reason, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING ` + moderationDecisionColumns
+
+	return scanModerationDecision(tx.QueryRowContext(ctx, query, contentType, id, moderatorID, action, status, reason, time.Now()))
+}
+
+// Flagged content awaiting a decision
+type ModerationItem struct {
+	Type       string    `json:"type"`
+	ID         uuid.UUID `json:"id"`
+	QuestionID uuid.UUID `json:"question_id"` // Same as ID for questions
+	UserID     uuid.UUID `json:"user_id"`
+	Body       string    `json:"body"`
+	Status     string    `json:"status"`
+	FlaggedAt  time.Time `json:"flagged_at"` // Of the oldest open flag
+	Flags      []*Flag   `json:"flags"`
+}
+
+type Moderation struct{}
+
+// Returns a page of the content with open flags, flagged the longest ago first
+// The returned cursor is nil on the last page
+func (m *Moderation) Queue(limit int, cursor *Cursor) ([]*ModerationItem, *Cursor, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	if limit <= 0 || limit > MaxPageLimit {
+		limit = DefaultPageLimit
+	}
+
+	args := []interface{}{ContentQuestion, ContentAnswer}
+	having := ""
+
+	if cursor != nil {
+		flaggedAt, err := time.Parse(time.RFC3339Nano, cursor.Value)
+		if err != nil || cursor.Sort != "flagged_at" {
+			return nil, nil, ErrInvalidCursor
+		}
+
+		args = append(args, flaggedAt, cursor.ID)
+		having = ` HAVING (MIN(f.created_at), f.target_id) > ($3, $4)`
+	}
+
+	args = append(args, limit+1)
+
+	query := fmt.Sprintf(`SELECT c.type, c.id, c.question_id, c.user_id, c.body, c.status, MIN(f.created_at) AS flagged_at,
+			json_agg(json_build_object('id', f.id, 'type', f.target_type, 'target_id', f.target_id, 'user_id', f.user_id,
+				'reason', f.reason, 'created_at', f.created_at) ORDER BY f.created_at)
+		FROM flags f JOIN (
+			SELECT $1::text AS type, id, id AS question_id, user_id, question AS body, status FROM questions
+			UNION ALL
+			SELECT $2::text, id, question_id, user_id, body, status FROM answers
+		) c ON c.type = f.target_type AND c.id = f.target_id
+		WHERE f.resolved_at IS NULL
+		GROUP BY c.type, c.id, c.question_id, c.user_id, c.body, c.status, f.target_id%s
+		ORDER BY flagged_at, f.target_id LIMIT $%d`, having, len(args))
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Error().Err(err).Msg("Error listing the moderation queue")
+		return nil, nil, err
+	}
+
+	items, err := scanAll(rows, func(row rowScanner) (*ModerationItem, error) {
+		var item ModerationItem
+		var flags []byte
+
+		err := row.Scan(&item.Type, &item.ID, &item.QuestionID, &item.UserID, &item.Body, &item.Status, &item.FlaggedAt, &flags)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(flags, &item.Flags); err != nil {
+			return nil, err
+		}
+
+		return &item, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(items) <= limit {
+		return items, nil, nil
+	}
+
+	items = items[:limit]
+	last := items[len(items)-1]
+
+	return items, &Cursor{Sort: "flagged_at", Value: last.FlaggedAt.Format(time.RFC3339Nano), ID: last.ID}, nil
+}
+
+// Applies the moderation action to the content and resolves its open flags
+func (m *Moderation) Decide(contentType string, id uuid.UUID, moderatorID uuid.UUID, action string, reason string) (*ModerationDecision, error) {
+	status, ok := ModerationActions[action]
+	if !ok {
+		return nil, fmt.Errorf("Invalid moderation action %q", action)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	decision, err := setContentStatus(ctx, tx, contentType, id, &moderatorID, action, status, reason)
+	if err != nil {
+		log.Error().Err(err).Msg("Error moderating content")
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE flags SET resolved_at = $1 WHERE target_type = $2 AND target_id = $3 AND resolved_at IS NULL`,
+		decision.CreatedAt, contentType, id)
+	if err != nil {
+		log.Error().Err(err).Msg("Error resolving flags")
+		return nil, err
+	}
+
+	return decision, tx.Commit()
+}
+
+// Returns the decisions taken on the content, oldest first
+func (m *Moderation) FindDecisions(contentType string, id uuid.UUID) ([]*ModerationDecision, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	query := `SELECT ` + moderationDecisionColumns + ` FROM moderation_decisions WHERE target_type = $1 AND target_id = $2 ORDER BY created_at`
+
+	rows, err := db.QueryContext(ctx, query, contentType, id)
+	if err != nil {
+		log.Error().Err(err).Msg("Error finding moderation decisions")
+		return nil, err
+	}
+
+	return scanAll(rows, scanModerationDecision)
+}
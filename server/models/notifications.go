@@ -0,0 +1,133 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// Kinds of notifications
+const (
+	NotificationMention = "mention" // Mentioned in a comment
+)
+
+// Something that happened to a user, with the content it is about
+type Notification struct {
+	ID         uuid.UUID  `json:"id"`
+	Type       string     `json:"type"`
+	ActorID    *uuid.UUID `json:"actor_id"` // User who caused it
+	QuestionID *uuid.UUID `json:"question_id"`
+	AnswerID   *uuid.UUID `json:"answer_id"`
+	CommentID  *uuid.UUID `json:"comment_id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ReadAt     *time.Time `json:"read_at"`
+}
+
+// Columns read by `scanNotification`
+const notificationColumns = `id, type, actor_id, question_id, answer_id, comment_id, created_at, read_at`
+
+func scanNotification(row rowScanner) (*Notification, error) {
+	var notification Notification
+	err := row.Scan(&notification.ID, &notification.Type, &notification.ActorID, &notification.QuestionID, &notification.AnswerID,
+		&notification.CommentID, &notification.CreatedAt, &notification.ReadAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &notification, nil
+}
+
+// Page of a user's notifications, newest first
+type NotificationListParams struct {
+	UserID uuid.UUID
+	Unread bool // Only the notifications not read yet
+	Limit  int
+	Cursor *Cursor
+}
+
+// Returns a page of the user's notifications using keyset pagination
+// The returned cursor is nil on the last page
+func (n *Notification) List(params NotificationListParams) ([]*Notification, *Cursor, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	if params.Limit <= 0 || params.Limit > MaxPageLimit {
+		params.Limit = DefaultPageLimit
+	}
+
+	var args []interface{}
+
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	conditions := []string{"user_id = " + arg(params.UserID)}
+
+	if params.Unread {
+		conditions = append(conditions, "read_at IS NULL")
+	}
+
+	if params.Cursor != nil {
+		createdAt, err := time.Parse(time.RFC3339Nano, params.Cursor.Value)
+		if err != nil || params.Cursor.Sort != "-created_at" {
+			return nil, nil, ErrInvalidCursor
+		}
+
+		conditions = append(conditions, fmt.Sprintf("(created_at, id) < (%s, %s)", arg(createdAt), arg(params.Cursor.ID)))
+	}
+
+	query := `SELECT ` + notificationColumns + ` FROM notifications WHERE ` + strings.Join(conditions, " AND ")
+	query += " ORDER BY created_at DESC, id DESC LIMIT " + arg(params.Limit+1)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Error().Err(err).Msg("Error listing notifications")
+		return nil, nil, err
+	}
+
+	notifications, err := scanAll(rows, scanNotification)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(notifications) <= params.Limit {
+		return notifications, nil, nil
+	}
+
+	notifications = notifications[:params.Limit]
+	last := notifications[len(notifications)-1]
+
+	return notifications, &Cursor{Sort: "-created_at", Value: last.CreatedAt.Format(time.RFC3339Nano), ID: last.ID}, nil
+}
+
+// Marks the user's notifications with the given IDs as read, all of them when `ids` is empty
+// Returns how many were unread
+func (n *Notification) MarkRead(userID uuid.UUID, ids []uuid.UUID) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	query := `UPDATE notifications SET read_at = $1 WHERE user_id = $2 AND read_at IS NULL`
+	args := []interface{}{time.Now(), userID}
+
+	if len(ids) > 0 {
+		query += ` AND id IN (` + placeholders(3, len(ids)) + `)`
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+
+	result, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		log.Error().Err(err).Msg("Error marking notifications as read")
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
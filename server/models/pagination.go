@@ -0,0 +1,51 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/gofrs/uuid"
+)
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+var ErrInvalidCursor = errors.New("Invalid cursor")
+
+// Position after the last row of a page, for keyset pagination
+// `Sort` ties the cursor to the ordering it was issued for
+type Cursor struct {
+	Sort  string    `json:"s"`
+	Value string    `json:"v"`
+	ID    uuid.UUID `json:"id"`
+}
+
+// Returns the opaque string form of the cursor
+func (c Cursor) Encode() string {
+	payload, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(payload)
+}
+
+// Parses a cursor returned by `Cursor.Encode`
+func DecodeCursor(encoded string) (*Cursor, error) {
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor Cursor
+	if err := json.Unmarshal(payload, &cursor); err != nil || cursor.ID == uuid.Nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
+
+// Escapes the LIKE wildcards in a prefix and appends one
+func likePrefix(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix) + "%"
+}
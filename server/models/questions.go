@@ -2,43 +2,85 @@ package models
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/gofrs/uuid"
+	"github.com/rs/zerolog/log"
 )
 
 type Question struct {
 	ID        uuid.UUID `json:"id,omitempty"`
 	Question  string    `json:"question,omitempty"`
-	Answer    string    `json:"answer,omitempty"`
 	CreatedAt time.Time `json:"created_at,omitempty"`
 	UpdatedAt time.Time `json:"updated_at,omitempty"`
 	UserID    uuid.UUID `json:"user_id,omitempty"`
+	Score     int       `json:"score"`
+
+	// Canonical names, synonyms are resolved when tagging
+	Tags []string `json:"tags"`
+
+	// Chosen by the asker among the answers, nil until then
+	AcceptedAnswerID *uuid.UUID `json:"accepted_answer_id"`
+
+	Status string `json:"status"` // Set by moderation, only published questions are listed
+
+	// First comments on the question and the number of them, only set by the detail endpoint
+	Comments     []*Comment `json:"comments,omitempty"`
+	CommentCount *int       `json:"comment_count,omitempty"`
 }
 
+// Columns read by `scanQuestion`
+const questionColumns = `id, question, created_at, updated_at, user_id, score, accepted_answer_id, status`
+
+func scanQuestion(row rowScanner) (*Question, error) {
+	var question Question
+	err := row.Scan(&question.ID, &question.Question, &question.CreatedAt, &question.UpdatedAt, &question.UserID, &question.Score, &question.AcceptedAnswerID, &question.Status)
+	if err != nil {
+		return nil, err
+	}
+
+	return &question, nil
+}
+
+// Creates the question and its tags, tags that don't exist yet are created
 func (q *Question) Create(question Question) (*Question, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 
 	defer cancel()
 
-	query := `INSERT INTO questions (question, answer, created_at, updated_at, user_id) VALUES ($1, $2, $3, $4, $5) RETURNING *`
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	query := `INSERT INTO questions (question, created_at, updated_at, user_id) VALUES ($1, $2, $2, $3) RETURNING ` + questionColumns
 
-	_, err := db.ExecContext(
+	created, err := scanQuestion(tx.QueryRowContext(
 		ctx,
 		query,
 		question.Question,
-		question.Answer,
-		time.Now(),
 		time.Now(),
 		question.UserID,
-	)
+	))
 
 	if err != nil {
+		log.Error().Err(err).Msg("Error creating question")
 		return nil, err
 	}
 
-	return &question, nil
+	created.Tags, err = setQuestionTags(ctx, tx, created.ID, question.Tags)
+	if err != nil {
+		log.Error().Err(err).Msg("Error tagging question")
+		return nil, err
+	}
+
+	return created, tx.Commit()
 }
 
 func (q *Question) FindAll() ([]*Question, error) {
@@ -46,22 +88,16 @@ func (q *Question) FindAll() ([]*Question, error) {
 
 	defer cancel()
 
-	query := `SELECT id, question, answer, created_at, updated_at, user_id FROM questions`
+	query := `SELECT ` + questionColumns + ` FROM questions`
 
 	rows, err := db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
 
-	var questions []*Question
-	for rows.Next() {
-		var question Question
-		err := rows.Scan(&question.ID, &question.Question, &question.Answer, &question.CreatedAt, &question.UpdatedAt, &question.UserID)
-		if err != nil {
-			return nil, err
-		}
-
-		questions = append(questions, &question)
+	questions, err := scanAll(rows, scanQuestion)
+	if err != nil {
+		return nil, err
 	}
 
 	if len(questions) == 0 {
@@ -70,3 +106,194 @@ func (q *Question) FindAll() ([]*Question, error) {
 
 	return questions, nil
 }
+
+// Returns the questions asked by the user
+func (q *Question) FindByUserID(userID uuid.UUID) ([]*Question, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	query := `SELECT ` + questionColumns + ` FROM questions WHERE user_id = $1 ORDER BY created_at`
+
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	questions, err := scanAll(rows, scanQuestion)
+	if err != nil {
+		return nil, err
+	}
+
+	return questions, loadQuestionTags(ctx, db, questions)
+}
+
+// Returns the question with the given ID
+func (q *Question) FindByID(id uuid.UUID) (*Question, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	query := `SELECT ` + questionColumns + ` FROM questions WHERE id = $1`
+
+	question, err := scanQuestion(db.QueryRowContext(ctx, query, id))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("No question found")
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error finding question")
+		return nil, err
+	}
+
+	return question, loadQuestionTags(ctx, db, []*Question{question})
+}
+
+// Filters and page of a published question listing, newest first
+type QuestionListParams struct {
+	Limit  int
+	Cursor *Cursor
+	UserID *uuid.UUID
+	Tags   []string // Canonical names, questions must have all of them
+}
+
+// Returns a page of questions using keyset pagination
+// The returned cursor is nil on the last page
+func (q *Question) List(params QuestionListParams) ([]*Question, *Cursor, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	if params.Limit <= 0 || params.Limit > MaxPageLimit {
+		params.Limit = DefaultPageLimit
+	}
+
+	var args []interface{}
+
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	conditions := []string{"status = " + arg(StatusPublished)}
+
+	if params.UserID != nil {
+		conditions = append(conditions, "user_id = "+arg(*params.UserID))
+	}
+
+	if len(params.Tags) > 0 {
+		conditions = append(conditions, taggedWithAll("id", params.Tags, arg))
+	}
+
+	if params.Cursor != nil {
+		createdAt, err := time.Parse(time.RFC3339Nano, params.Cursor.Value)
+		if err != nil || params.Cursor.Sort != "-created_at" {
+			return nil, nil, ErrInvalidCursor
+		}
+
+		conditions = append(conditions, fmt.Sprintf("(created_at, id) < (%s, %s)", arg(createdAt), arg(params.Cursor.ID)))
+	}
+
+	query := `SELECT ` + questionColumns + ` FROM questions WHERE ` + strings.Join(conditions, " AND ")
+	query += " ORDER BY created_at DESC, id DESC LIMIT " + arg(params.Limit+1)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Error().Err(err).Msg("Error listing questions")
+		return nil, nil, err
+	}
+
+	questions, err := scanAll(rows, scanQuestion)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var next *Cursor
+	if len(questions) > params.Limit {
+		questions = questions[:params.Limit]
+		last := questions[len(questions)-1]
+		next = &Cursor{Sort: "-created_at", Value: last.CreatedAt.Format(time.RFC3339Nano), ID: last.ID}
+	}
+
+	if err := loadQuestionTags(ctx, db, questions); err != nil {
+		log.Error().Err(err).Msg("Error loading question tags")
+		return nil, nil, err
+	}
+
+	return questions, next, nil
+}
+
+// Replaces the text and tags of the question with the given ID, nil tags leave them unchanged
+// A revision by the editor is recorded when the text changes
+func (q *Question) Update(id uuid.UUID, question Question, editorID uuid.UUID) (*Question, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	updated, err := reviseQuestion(ctx, tx, id, question.Question, editorID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if question.Tags != nil {
+		updated.Tags, err = setQuestionTags(ctx, tx, id, question.Tags)
+	} else {
+		err = loadQuestionTags(ctx, tx, []*Question{updated})
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Error tagging question")
+		return nil, err
+	}
+
+	return updated, tx.Commit()
+}
+
+// Deletes the question with the given ID
+func (q *Question) DeleteByID(id uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, `DELETE FROM questions WHERE id = $1`, id)
+	if err != nil {
+		log.Error().Err(err).Msg("Error deleting question")
+		return err
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return errors.New("No question found")
+	}
+
+	return nil
+}
+
+// Marks the answer as the accepted one of the question with the given ID, nil clears it
+// The caller checks that the answer belongs to the question, the tags are not loaded
+func (q *Question) SetAcceptedAnswer(id uuid.UUID, answerID *uuid.UUID) (*Question, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	query := `UPDATE questions SET accepted_answer_id = $1 WHERE id = $2 RETURNING ` + questionColumns
+
+	question, err := scanQuestion(db.QueryRowContext(ctx, query, answerID, id))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("No question found")
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error accepting answer")
+		return nil, err
+	}
+
+	return question, nil
+}
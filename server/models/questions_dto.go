@@ -0,0 +1,66 @@
+package models
+
+import (
+	"github.com/gofrs/uuid"
+)
+
+// Input to create or update a question, the owner comes from the authenticated user
+// Tags are normalized by `Normalize` before validation, omitting them on update keeps the current ones
+type QuestionInput struct {
+	Question string   `json:"question" validate:"required,max=255"`
+	Tags     []string `json:"tags" validate:"max=5,dive,tag"`
+}
+
+// Input to create or update an answer, the author comes from the authenticated user
+type AnswerInput struct {
+	Body string `json:"body" validate:"required,max=30000"`
+}
+
+// Lowercases and trims the tags and drops the duplicates
+func (input *QuestionInput) Normalize() {
+	if input.Tags != nil {
+		input.Tags = NormalizeTags(input.Tags)
+	}
+}
+
+// Returns the question owned by userID from the input
+func (input QuestionInput) ToQuestion(userID uuid.UUID) Question {
+	return Question{Question: input.Question, UserID: userID, Tags: input.Tags}
+}
+
+// Returns the answer to questionID written by userID from the input
+func (input AnswerInput) ToAnswer(questionID uuid.UUID, userID uuid.UUID) Answer {
+	return Answer{QuestionID: questionID, UserID: userID, Body: input.Body}
+}
+
+// Input to vote on a question or answer
+type VoteInput struct {
+	Value int `json:"value" validate:"oneof=-1 1"`
+}
+
+// Input to flag a question or answer for moderators
+type FlagInput struct {
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+// Input of a moderator's decision on a question or answer
+type ModerationInput struct {
+	Action string `json:"action" validate:"required,oneof=approve hide delete"`
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+// Input to create or edit a comment, the parent can't be changed by an edit
+type CommentInput struct {
+	Body     string     `json:"body" validate:"required,max=600"`
+	ParentID *uuid.UUID `json:"parent_id"`
+}
+
+// Returns the comment on the question, or on one of its answers, written by userID from the input
+func (input CommentInput) ToComment(questionID uuid.UUID, answerID *uuid.UUID, userID uuid.UUID) Comment {
+	return Comment{QuestionID: questionID, AnswerID: answerID, ParentID: input.ParentID, UserID: &userID, Body: input.Body}
+}
+
+// Input to mark notifications as read, no IDs marks all of them
+type NotificationReadInput struct {
+	IDs []uuid.UUID `json:"ids" validate:"max=100"`
+}
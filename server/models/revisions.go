@@ -0,0 +1,177 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/rs/zerolog/log"
+
+	"server/helpers"
+)
+
+var ErrRevisionNotFound = errors.New("No revision found")
+
+// Edit of a question's text
+type QuestionRevision struct {
+	ID         uuid.UUID  `json:"id"`
+	QuestionID uuid.UUID  `json:"question_id"`
+	UserID     *uuid.UUID `json:"user_id"` // Editor, nil once purged
+	Before     string     `json:"before"`
+	After      string     `json:"after"`
+	RollbackOf *uuid.UUID `json:"rollback_of"` // Revision undone by this one
+	CreatedAt  time.Time  `json:"created_at"`
+
+	Diff []helpers.DiffOp `json:"diff"`
+}
+
+// Columns read by `scanQuestionRevision`
+const questionRevisionColumns = `id, question_id, user_id, before, after, rollback_of, created_at`
+
+func scanQuestionRevision(row rowScanner) (*QuestionRevision, error) {
+	var revision QuestionRevision
+	err := row.Scan(&revision.ID, &revision.QuestionID, &revision.UserID, &revision.Before, &revision.After, &revision.RollbackOf, &revision.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	revision.Diff = helpers.DiffWords(revision.Before, revision.After)
+
+	return &revision, nil
+}
+
+// Replaces the text of the question and records the revision if it changed
+func reviseQuestion(ctx context.Context, tx *sql.Tx, id uuid.UUID, text string, editorID uuid.UUID, rollbackOf *uuid.UUID) (*Question, error) {
+	// Locking the question keeps concurrent edits from recording the same before text
+	var before string
+
+	err := tx.QueryRowContext(ctx, `SELECT question FROM questions WHERE id = $1 FOR UPDATE`, id).Scan(&before)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("No question found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	query := `UPDATE questions SET question = $1, updated_at = $2 WHERE id = $3 RETURNING ` + questionColumns
+
+	updated, err := scanQuestion(tx.QueryRowContext(ctx, query, text, now, id))
+	if err != nil {
+		log.Error().Err(err).Msg("Error updating question")
+		return nil, err
+	}
+
+	if before == text {
+		return updated, nil
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO question_revisions (question_id, user_id, before, after, rollback_of, created_at) VALUES ($1, $2, $3, $4, $5, $6)`,
+		id, editorID, before, text, rollbackOf, now)
+	if err != nil {
+		log.Error().Err(err).Msg("Error recording question revision")
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// Page of a question's revisions, newest first
+type RevisionListParams struct {
+	QuestionID uuid.UUID
+	Limit      int
+	Cursor     *Cursor
+}
+
+// Returns a page of the revisions of the question with their diffs using keyset pagination
+// The returned cursor is nil on the last page
+func (q *Question) ListRevisions(params RevisionListParams) ([]*QuestionRevision, *Cursor, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	if params.Limit <= 0 || params.Limit > MaxPageLimit {
+		params.Limit = DefaultPageLimit
+	}
+
+	var args []interface{}
+
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	conditions := []string{"question_id = " + arg(params.QuestionID)}
+
+	if params.Cursor != nil {
+		createdAt, err := time.Parse(time.RFC3339Nano, params.Cursor.Value)
+		if err != nil || params.Cursor.Sort != "-created_at" {
+			return nil, nil, ErrInvalidCursor
+		}
+
+		conditions = append(conditions, fmt.Sprintf("(created_at, id) < (%s, %s)", arg(createdAt), arg(params.Cursor.ID)))
+	}
+
+	query := `SELECT ` + questionRevisionColumns + ` FROM question_revisions WHERE ` + strings.Join(conditions, " AND ")
+	query += " ORDER BY created_at DESC, id DESC LIMIT " + arg(params.Limit+1)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Error().Err(err).Msg("Error listing question revisions")
+		return nil, nil, err
+	}
+
+	revisions, err := scanAll(rows, scanQuestionRevision)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(revisions) <= params.Limit {
+		return revisions, nil, nil
+	}
+
+	revisions = revisions[:params.Limit]
+	last := revisions[len(revisions)-1]
+
+	return revisions, &Cursor{Sort: "-created_at", Value: last.CreatedAt.Format(time.RFC3339Nano), ID: last.ID}, nil
+}
+
+// Undoes the revision and every later one by restoring the text it replaced
+// The rollback is recorded as a new revision by the editor
+func (q *Question) Rollback(id uuid.UUID, revisionID uuid.UUID, editorID uuid.UUID) (*Question, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	var before string
+
+	err = tx.QueryRowContext(ctx, `SELECT before FROM question_revisions WHERE id = $1 AND question_id = $2`, revisionID, id).Scan(&before)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRevisionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := reviseQuestion(ctx, tx, id, before, editorID, &revisionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := loadQuestionTags(ctx, tx, []*Question{updated}); err != nil {
+		return nil, err
+	}
+
+	return updated, tx.Commit()
+}
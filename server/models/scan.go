@@ -0,0 +1,26 @@
+package models
+
+import "database/sql"
+
+// Implemented by both `*sql.Row` and `*sql.Rows`, so a model has a single
+// scan function for its column list whatever the query returns
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// Scans every row with the model's scan function and closes the rows
+func scanAll[T any](rows *sql.Rows, scan func(row rowScanner) (*T, error)) ([]*T, error) {
+	defer rows.Close()
+
+	items := []*T{}
+	for rows.Next() {
+		item, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
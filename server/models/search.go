@@ -0,0 +1,141 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// Delimit the matched terms in the snippets computed by ts_headline, see `markSnippet`
+// They are removed from the bodies so users can't forge them
+const (
+	headlineStartSel = "\x02"
+	headlineStopSel  = "\x03"
+)
+
+const searchHeadlineOptions = `StartSel=` + headlineStartSel + `, StopSel=` + headlineStopSel + `, MaxWords=35, MinWords=15, MaxFragments=2`
+
+var snippetMarks = strings.NewReplacer(headlineStartSel, "<mark>", headlineStopSel, "</mark>")
+
+// Question or answer matching a search
+type SearchResult struct {
+	Type       string    `json:"type"` // question or answer
+	ID         uuid.UUID `json:"id"`
+	QuestionID uuid.UUID `json:"question_id"` // Same as ID for questions
+	UserID     uuid.UUID `json:"user_id"`
+	Snippet    string    `json:"snippet"`
+	Rank       float32   `json:"rank"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Terms, filters and page of a search, best match first
+type SearchParams struct {
+	Query  string // Web search syntax: quoted phrases, `or` and `-` to exclude
+	Tags   []string
+	UserID *uuid.UUID
+	Limit  int
+	Cursor *Cursor
+}
+
+type Search struct{}
+
+// Returns a page of the published questions and answers matching the query, ranked together
+// Answers are filtered by the tags of their question. The returned cursor is nil on the last page
+func (s *Search) Find(params SearchParams) ([]*SearchResult, *Cursor, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	if params.Limit <= 0 || params.Limit > MaxPageLimit {
+		params.Limit = DefaultPageLimit
+	}
+
+	var conditions []string
+	var args []interface{}
+
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	query := arg(params.Query)
+
+	if params.UserID != nil {
+		conditions = append(conditions, "user_id = "+arg(*params.UserID))
+	}
+
+	if len(params.Tags) > 0 {
+		conditions = append(conditions, taggedWithAll("question_id", params.Tags, arg))
+	}
+
+	if params.Cursor != nil {
+		rank, err := strconv.ParseFloat(params.Cursor.Value, 32)
+		if err != nil || params.Cursor.Sort != "-rank" {
+			return nil, nil, ErrInvalidCursor
+		}
+
+		conditions = append(conditions, fmt.Sprintf("(rank, id) < (%s::real, %s)", arg(float32(rank)), arg(params.Cursor.ID)))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	// The snippets are only computed for the rows of the page, ts_headline is expensive
+	statement := fmt.Sprintf(`WITH search AS (SELECT websearch_to_tsquery('english', %s) AS query),
+		matches AS (
+			SELECT '%s' AS type, q.id, q.id AS question_id, q.user_id, q.question AS body, q.created_at, ts_rank(q.search_vector, search.query) AS rank
+			FROM questions q, search WHERE q.search_vector @@ search.query AND q.status = '%s'
+			UNION ALL
+			SELECT '%s', a.id, a.question_id, a.user_id, a.body, a.created_at, ts_rank(a.search_vector, search.query)
+			FROM answers a JOIN questions q ON q.id = a.question_id, search
+			WHERE a.search_vector @@ search.query AND a.status = '%s' AND q.status = '%s'
+		)
+		SELECT page.type, page.id, page.question_id, page.user_id, ts_headline('english', translate(page.body, '%s', ''), search.query, '%s'), page.rank, page.created_at
+		FROM (SELECT * FROM matches%s ORDER BY rank DESC, id DESC LIMIT %s) page, search
+		ORDER BY page.rank DESC, page.id DESC`,
+		query, ContentQuestion, StatusPublished, ContentAnswer, StatusPublished, StatusPublished, headlineStartSel+headlineStopSel, searchHeadlineOptions, where, arg(params.Limit+1))
+
+	rows, err := db.QueryContext(ctx, statement, args...)
+	if err != nil {
+		log.Error().Err(err).Msg("Error searching")
+		return nil, nil, err
+	}
+
+	results, err := scanAll(rows, func(row rowScanner) (*SearchResult, error) {
+		var result SearchResult
+		err := row.Scan(&result.Type, &result.ID, &result.QuestionID, &result.UserID, &result.Snippet, &result.Rank, &result.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Snippet = markSnippet(result.Snippet)
+
+		return &result, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(results) <= params.Limit {
+		return results, nil, nil
+	}
+
+	results = results[:params.Limit]
+	last := results[len(results)-1]
+
+	return results, &Cursor{Sort: "-rank", Value: strconv.FormatFloat(float64(last.Rank), 'g', -1, 32), ID: last.ID}, nil
+}
+
+// Returns the HTML escaped snippet with the matched terms wrapped in <mark>
+// The bodies are user input, the marks are the only markup of the snippet
+func markSnippet(snippet string) string {
+	return snippetMarks.Replace(html.EscapeString(snippet))
+}
@@ -0,0 +1,416 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+const MaxQuestionTags = 5
+
+var (
+	ErrDuplicateTag = errors.New("Tag or synonym already exists")
+	ErrTagNotFound  = errors.New("No tag found")
+)
+
+type Tag struct {
+	ID    uuid.UUID `json:"id"`
+	Name  string    `json:"name"`
+	Count int       `json:"count"` // Questions tagged with it
+}
+
+// Alternative name of a tag
+type TagSynonym struct {
+	Name      string    `json:"name"`
+	Tag       string    `json:"tag"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Satisfied by both the pool and transactions
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Lowercases, trims and dedupes tag names, keeping their order
+func NormalizeTags(names []string) []string {
+	normalized := []string{}
+
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		if name != "" && !containsString(normalized, name) {
+			normalized = append(normalized, name)
+		}
+	}
+
+	return normalized
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns `$start, $start+1, ...` for n arguments
+func placeholders(start int, n int) string {
+	list := make([]string, n)
+	for i := range list {
+		list[i] = "$" + strconv.Itoa(start+i)
+	}
+
+	return strings.Join(list, ", ")
+}
+
+func stringArgs(values []string) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+
+	return args
+}
+
+// Replaces the synonyms among the names by their tag, the result is deduped and sorted
+func canonicalTags(ctx context.Context, q queryer, names []string) ([]string, error) {
+	names = NormalizeTags(names)
+	if len(names) == 0 {
+		return names, nil
+	}
+
+	query := `SELECT s.name, t.name FROM tag_synonyms s JOIN tags t ON t.id = s.tag_id WHERE s.name IN (` + placeholders(1, len(names)) + `)`
+
+	rows, err := q.QueryContext(ctx, query, stringArgs(names)...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	synonyms := map[string]string{}
+	for rows.Next() {
+		var synonym, tag string
+		if err := rows.Scan(&synonym, &tag); err != nil {
+			return nil, err
+		}
+
+		synonyms[synonym] = tag
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	canonical := []string{}
+	for _, name := range names {
+		if tag, ok := synonyms[name]; ok {
+			name = tag
+		}
+
+		if !containsString(canonical, name) {
+			canonical = append(canonical, name)
+		}
+	}
+
+	sort.Strings(canonical)
+
+	return canonical, nil
+}
+
+// Returns the names with synonyms replaced by their tag
+func (t *Tag) Canonical(names []string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	return canonicalTags(ctx, db, names)
+}
+
+// Replaces the tags of the question, creating the missing ones
+// Returns the canonical names the question is now tagged with
+func setQuestionTags(ctx context.Context, tx *sql.Tx, questionID uuid.UUID, names []string) ([]string, error) {
+	_, err := tx.ExecContext(ctx, `DELETE FROM question_tags WHERE question_id = $1`, questionID)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err = canonicalTags(ctx, tx, names)
+	if err != nil || len(names) == 0 {
+		return names, err
+	}
+
+	values := make([]string, len(names))
+	for i := range names {
+		values[i] = fmt.Sprintf("($%d, $1)", i+2)
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO tags (name, created_at) VALUES `+strings.Join(values, ", ")+` ON CONFLICT (name) DO NOTHING`,
+		append([]interface{}{time.Now()}, stringArgs(names)...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO question_tags (question_id, tag_id) SELECT $1, id FROM tags WHERE name IN (`+placeholders(2, len(names))+`)`,
+		append([]interface{}{questionID}, stringArgs(names)...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
+
+// Returns a condition matching the rows whose question, in `column`, has all the canonical tags
+// `arg` adds an argument to the query and returns its placeholder
+func taggedWithAll(column string, tags []string, arg func(value interface{}) string) string {
+	names := make([]string, len(tags))
+	for i, name := range tags {
+		names[i] = arg(name)
+	}
+
+	return fmt.Sprintf(`%s IN (SELECT qt.question_id FROM question_tags qt JOIN tags t ON t.id = qt.tag_id
+		WHERE t.name IN (%s) GROUP BY qt.question_id HAVING COUNT(*) = %s)`, column, strings.Join(names, ", "), arg(len(names)))
+}
+
+// Sets the `Tags` of the questions
+func loadQuestionTags(ctx context.Context, q queryer, questions []*Question) error {
+	if len(questions) == 0 {
+		return nil
+	}
+
+	byID := make(map[uuid.UUID]*Question, len(questions))
+	args := make([]interface{}, 0, len(questions))
+
+	for _, question := range questions {
+		question.Tags = []string{}
+		byID[question.ID] = question
+		args = append(args, question.ID)
+	}
+
+	query := `SELECT qt.question_id, t.name FROM question_tags qt JOIN tags t ON t.id = qt.tag_id
+		WHERE qt.question_id IN (` + placeholders(1, len(args)) + `) ORDER BY t.name`
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var questionID uuid.UUID
+		var name string
+
+		if err := rows.Scan(&questionID, &name); err != nil {
+			return err
+		}
+
+		if question, ok := byID[questionID]; ok {
+			question.Tags = append(question.Tags, name)
+		}
+	}
+
+	return rows.Err()
+}
+
+// Prefix and page of a tag listing, most used first
+type TagListParams struct {
+	Limit  int
+	Cursor *Cursor
+	Prefix string
+}
+
+// Returns a page of tags with their usage counts using keyset pagination
+// The returned cursor is nil on the last page
+func (t *Tag) List(params TagListParams) ([]*Tag, *Cursor, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	if params.Limit <= 0 || params.Limit > MaxPageLimit {
+		params.Limit = DefaultPageLimit
+	}
+
+	var conditions []string
+	var args []interface{}
+
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	// Only published questions are counted
+	inner := `SELECT t.id, t.name, COUNT(qt.question_id) AS count FROM tags t
+		LEFT JOIN (question_tags qt JOIN questions q ON q.id = qt.question_id AND q.status = ` + arg(StatusPublished) + `) ON qt.tag_id = t.id`
+	if params.Prefix != "" {
+		inner += ` WHERE t.name LIKE ` + arg(likePrefix(strings.ToLower(params.Prefix)))
+	}
+	inner += ` GROUP BY t.id, t.name`
+
+	if params.Cursor != nil {
+		count, err := strconv.Atoi(params.Cursor.Value)
+		if err != nil || params.Cursor.Sort != "-count" {
+			return nil, nil, ErrInvalidCursor
+		}
+
+		conditions = append(conditions, fmt.Sprintf("(count, id) < (%s, %s)", arg(count), arg(params.Cursor.ID)))
+	}
+
+	query := `SELECT id, name, count FROM (` + inner + `) counts`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY count DESC, id DESC LIMIT " + arg(params.Limit+1)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Error().Err(err).Msg("Error listing tags")
+		return nil, nil, err
+	}
+
+	tags, err := scanAll(rows, func(row rowScanner) (*Tag, error) {
+		var tag Tag
+		if err := row.Scan(&tag.ID, &tag.Name, &tag.Count); err != nil {
+			return nil, err
+		}
+
+		return &tag, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(tags) <= params.Limit {
+		return tags, nil, nil
+	}
+
+	tags = tags[:params.Limit]
+	last := tags[len(tags)-1]
+
+	return tags, &Cursor{Sort: "-count", Value: strconv.Itoa(last.Count), ID: last.ID}, nil
+}
+
+// Returns the synonyms of the tag
+func (t *Tag) FindSynonyms(name string) ([]*TagSynonym, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	query := `SELECT s.name, t.name, s.created_at FROM tag_synonyms s JOIN tags t ON t.id = s.tag_id WHERE t.name = $1 ORDER BY s.name`
+
+	rows, err := db.QueryContext(ctx, query, strings.ToLower(name))
+	if err != nil {
+		log.Error().Err(err).Msg("Error finding tag synonyms")
+		return nil, err
+	}
+
+	return scanAll(rows, scanTagSynonym)
+}
+
+func scanTagSynonym(row rowScanner) (*TagSynonym, error) {
+	var synonym TagSynonym
+	if err := row.Scan(&synonym.Name, &synonym.Tag, &synonym.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	return &synonym, nil
+}
+
+// Makes `synonym` resolve to the tag. An existing tag with the synonym's name is merged
+// into it: its questions are retagged and its own synonyms move over
+func (t *Tag) AddSynonym(name string, synonym string) (*TagSynonym, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	name, synonym = strings.ToLower(name), strings.ToLower(synonym)
+	if name == synonym {
+		return nil, ErrDuplicateTag
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	var tagID uuid.UUID
+
+	err = tx.QueryRowContext(ctx, `SELECT id FROM tags WHERE name = $1 FOR UPDATE`, name).Scan(&tagID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTagNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var mergedID uuid.UUID
+
+	err = tx.QueryRowContext(ctx, `SELECT id FROM tags WHERE name = $1 FOR UPDATE`, synonym).Scan(&mergedID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	if mergedID != uuid.Nil {
+		merges := []string{
+			`INSERT INTO question_tags (question_id, tag_id) SELECT question_id, $1 FROM question_tags WHERE tag_id = $2 ON CONFLICT DO NOTHING`,
+			`UPDATE tag_synonyms SET tag_id = $1 WHERE tag_id = $2`,
+			`DELETE FROM tags WHERE id = $2`,
+		}
+
+		for _, query := range merges {
+			if _, err := tx.ExecContext(ctx, query, tagID, mergedID); err != nil {
+				log.Error().Err(err).Msg("Error merging tags")
+				return nil, err
+			}
+		}
+	}
+
+	query := `INSERT INTO tag_synonyms (name, tag_id, created_at) VALUES ($1, $2, $3) RETURNING name, $4::text, created_at`
+
+	created, err := scanTagSynonym(tx.QueryRowContext(ctx, query, synonym, tagID, time.Now(), name))
+
+	if isUniqueViolation(err) {
+		return nil, ErrDuplicateTag
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error creating tag synonym")
+		return nil, err
+	}
+
+	return created, tx.Commit()
+}
+
+// Removes the synonym of the tag, questions keep the tag
+func (t *Tag) DeleteSynonym(name string, synonym string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	query := `DELETE FROM tag_synonyms WHERE name = $1 AND tag_id = (SELECT id FROM tags WHERE name = $2)`
+
+	result, err := db.ExecContext(ctx, query, strings.ToLower(synonym), strings.ToLower(name))
+	if err != nil {
+		log.Error().Err(err).Msg("Error deleting tag synonym")
+		return err
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return errors.New("No tag synonym found")
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/rs/zerolog/log"
+
+	"server/helpers"
+)
+
+// A user's account at an external identity provider
+type UserIdentity struct {
+	ID        uuid.UUID `json:"id,omitempty"`
+	UserID    uuid.UUID `json:"user_id,omitempty"`
+	Provider  string    `json:"provider,omitempty"`
+	Subject   string    `json:"subject,omitempty"`
+	Email     string    `json:"email,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitempty"`
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+}
+
+// Columns read by `scanUserIdentity`
+const userIdentityColumns = `id, user_id, provider, subject, COALESCE(email, ''), created_at, updated_at`
+
+func scanUserIdentity(row rowScanner) (*UserIdentity, error) {
+	var identity UserIdentity
+	err := row.Scan(
+		&identity.ID,
+		&identity.UserID,
+		&identity.Provider,
+		&identity.Subject,
+		&identity.Email,
+		&identity.CreatedAt,
+		&identity.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &identity, nil
+}
+
+// Links an external identity to a user
+func (i *UserIdentity) Create(identity UserIdentity) (*UserIdentity, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	query := `INSERT INTO user_identities (user_id, provider, subject, email, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $5) RETURNING ` + userIdentityColumns
+
+	created, err := scanUserIdentity(db.QueryRowContext(
+		ctx,
+		query,
+		identity.UserID,
+		identity.Provider,
+		identity.Subject,
+		helpers.NormalizeEmail(identity.Email),
+		time.Now(),
+	))
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error creating user identity")
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// Returns the identity with the given provider and subject
+// Returns nil without an error if it has not been linked yet
+func (i *UserIdentity) FindByProviderSubject(provider string, subject string) (*UserIdentity, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	query := `SELECT ` + userIdentityColumns + ` FROM user_identities WHERE provider = $1 AND subject = $2`
+
+	identity, err := scanUserIdentity(db.QueryRowContext(ctx, query, provider, subject))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error finding user identity")
+		return nil, err
+	}
+
+	return identity, nil
+}
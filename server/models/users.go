@@ -2,8 +2,11 @@ package models
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"fmt"
 	"github.com/rs/zerolog/log"
+	"strings"
 	"time"
 
 	"github.com/gofrs/uuid"
@@ -14,28 +17,48 @@ type User struct {
 	ID        uuid.UUID `json:"id,omitempty"`
 	Name      string    `json:"name,omitempty" validate:"required"`
 	Email     string    `json:"email,omitempty" validate:"required,email"`
-	Password  string    `json:"password,omitempty" validate:"required"`
+	Password  string    `json:"-" validate:"required"` // Never serialized, see `PublicUser`
 	CreatedAt time.Time `json:"created_at,omitempty"`
 	UpdatedAt time.Time `json:"updated_at,omitempty"`
-}
 
-func (u *User) Create(user User) (*User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	// Earned from the votes on the user's questions and answers, see `VoteTarget`
+	Reputation int `json:"reputation"`
+}
 
-	defer cancel()
+// Columns read by `scanUser`, the password hash is only selected where it is needed
+const userColumns = `id, name, email, created_at, updated_at, reputation`
 
-	// Check if user already exists
-	dupe, err := u.FindByEmail(user.Email)
+// Columns read by `scanUserWithPassword`
+const userColumnsWithPassword = `id, name, email, password, created_at, updated_at, reputation`
 
+func scanUser(row rowScanner) (*User, error) {
+	var user User
+	err := row.Scan(&user.ID, &user.Name, &user.Email, &user.CreatedAt, &user.UpdatedAt, &user.Reputation)
 	if err != nil {
-		log.Error().Err(err).Msg("Error finding user")
-		// return nil, errors.New("Error finding user")
+		return nil, err
 	}
 
-	if dupe != nil {
-		return nil, errors.New("User already exists")
+	return &user, nil
+}
+
+func scanUserWithPassword(row rowScanner) (*User, error) {
+	var user User
+	err := row.Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt, &user.Reputation)
+	if err != nil {
+		return nil, err
 	}
 
+	return &user, nil
+}
+
+func (u *User) Create(user User) (*User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	// Duplicates are rejected by the unique index on the email
+	user.Email = helpers.NormalizeEmail(user.Email)
+
 	// Create user
 	hasedPassword, err := helpers.HashPassword(user.Password)
 	if err != nil {
@@ -45,24 +68,29 @@ func (u *User) Create(user User) (*User, error) {
 
 	user.Password = hasedPassword
 
-	query := `INSERT INTO users (name, email, password, created_at, updated_at) VALUES ($1, $2, $3, $4, $5) RETURNING *`
+	query := `INSERT INTO users (name, email, password, created_at, updated_at) VALUES ($1, $2, $3, $4, $5) RETURNING ` + userColumns
 
-	_, err = db.ExecContext(
+	now := time.Now()
+	created, err := scanUser(db.QueryRowContext(
 		ctx,
 		query,
 		user.Name,
 		user.Email,
 		user.Password,
-		time.Now(),
-		time.Now(),
-	)
+		now,
+		now,
+	))
+
+	if isUniqueViolation(err) {
+		return nil, ErrDuplicateEmail
+	}
 
 	if err != nil {
 		log.Error().Err(err).Msg("Error creating user")
 		return nil, err
 	}
 
-	return &user, nil
+	return created, nil
 }
 
 func (u *User) FindAll() ([]*User, error) {
@@ -70,7 +98,7 @@ func (u *User) FindAll() ([]*User, error) {
 
 	defer cancel()
 
-	query := `SELECT id, name, email, password, created_at, updated_at FROM users`
+	query := `SELECT ` + userColumns + ` FROM users WHERE deleted_at IS NULL`
 
 	rows, err := db.QueryContext(ctx, query)
 	if err != nil {
@@ -78,72 +106,210 @@ func (u *User) FindAll() ([]*User, error) {
 		return nil, err
 	}
 
-	var users []*User
-	for rows.Next() {
-		var user User
-		err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt)
-		if err != nil {
-			log.Error().Err(err).Msg("Error scanning users")
-			return nil, err
-		}
-
-		users = append(users, &user)
+	users, err := scanAll(rows, scanUser)
+	if err != nil {
+		log.Error().Err(err).Msg("Error scanning users")
+		return nil, err
 	}
 
 	if len(users) == 0 {
-		return nil, errors.New("No user found")
+		return nil, ErrUserNotFound
 	}
 
 	return users, nil
 }
 
+// Columns users can be sorted by, keyed by the `sort` parameter
+var userSortColumns = map[string]string{
+	"created_at": "created_at",
+	"name":       "name",
+	"email":      "email",
+}
+
+// Filters, ordering and page of a user listing
+type UserListParams struct {
+	Limit         int
+	Cursor        *Cursor
+	NamePrefix    string
+	Email         string // Exact, case-insensitive match
+	EmailPrefix   string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Sort          string // Column, prefixed with `-` for descending order
+}
+
+// Checks the sort parameter against the whitelist
+func ValidUserSort(sort string) bool {
+	_, ok := userSortColumns[strings.TrimPrefix(sort, "-")]
+	return ok
+}
+
+// Returns a page of users using keyset pagination
+// The returned cursor is nil on the last page
+func (u *User) List(params UserListParams) ([]*User, *Cursor, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	if params.Sort == "" {
+		params.Sort = "created_at"
+	}
+
+	column, ok := userSortColumns[strings.TrimPrefix(params.Sort, "-")]
+	if !ok {
+		return nil, nil, errors.New("Invalid sort")
+	}
+
+	direction, comparison := "ASC", ">"
+	if strings.HasPrefix(params.Sort, "-") {
+		direction, comparison = "DESC", "<"
+	}
+
+	if params.Limit <= 0 || params.Limit > MaxPageLimit {
+		params.Limit = DefaultPageLimit
+	}
+
+	conditions := []string{"deleted_at IS NULL"}
+	var args []interface{}
+
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if params.NamePrefix != "" {
+		conditions = append(conditions, "name ILIKE "+arg(likePrefix(params.NamePrefix)))
+	}
+	if params.Email != "" {
+		conditions = append(conditions, "LOWER(email) = "+arg(helpers.NormalizeEmail(params.Email)))
+	}
+	if params.EmailPrefix != "" {
+		conditions = append(conditions, "LOWER(email) LIKE "+arg(likePrefix(helpers.NormalizeEmail(params.EmailPrefix))))
+	}
+	if params.CreatedAfter != nil {
+		conditions = append(conditions, "created_at >= "+arg(*params.CreatedAfter))
+	}
+	if params.CreatedBefore != nil {
+		conditions = append(conditions, "created_at < "+arg(*params.CreatedBefore))
+	}
+
+	if params.Cursor != nil {
+		if params.Cursor.Sort != params.Sort {
+			return nil, nil, ErrInvalidCursor
+		}
+
+		var value interface{} = params.Cursor.Value
+		if column == "created_at" {
+			createdAt, err := time.Parse(time.RFC3339Nano, params.Cursor.Value)
+			if err != nil {
+				return nil, nil, ErrInvalidCursor
+			}
+			value = createdAt
+		}
+
+		conditions = append(conditions, fmt.Sprintf("(%s, id) %s (%s, %s)", column, comparison, arg(value), arg(params.Cursor.ID)))
+	}
+
+	query := `SELECT ` + userColumns + ` FROM users WHERE ` + strings.Join(conditions, " AND ")
+	query += fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT %s", column, direction, direction, arg(params.Limit+1))
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Error().Err(err).Msg("Error listing users")
+		return nil, nil, err
+	}
+
+	users, err := scanAll(rows, scanUser)
+	if err != nil {
+		log.Error().Err(err).Msg("Error scanning users")
+		return nil, nil, err
+	}
+
+	if len(users) <= params.Limit {
+		return users, nil, nil
+	}
+
+	users = users[:params.Limit]
+	last := users[len(users)-1]
+
+	next := &Cursor{Sort: params.Sort, ID: last.ID}
+	switch column {
+	case "created_at":
+		next.Value = last.CreatedAt.Format(time.RFC3339Nano)
+	case "name":
+		next.Value = last.Name
+	case "email":
+		next.Value = last.Email
+	}
+
+	return users, next, nil
+}
+
+// Returns the user with the given email, compared case insensitively
 func (u *User) FindByEmail(email string) (*User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 
 	defer cancel()
 
-	query := `SELECT id, name, email, password, created_at, updated_at FROM users WHERE email = $1`
+	query := `SELECT ` + userColumnsWithPassword + ` FROM users WHERE LOWER(email) = $1 AND deleted_at IS NULL`
 
-	rows, err := db.QueryContext(ctx, query, email)
+	rows, err := db.QueryContext(ctx, query, helpers.NormalizeEmail(email))
 	if err != nil {
 		log.Error().Err(err).Msg("Error finding user")
 		return nil, err
 	}
 
-	var users []*User
-	for rows.Next() {
-		var user User
-		err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt)
-		if err != nil {
-			log.Error().Err(err).Msg("Error scanning user")
-			return nil, err
-		}
-
-		users = append(users, &user)
+	users, err := scanAll(rows, scanUserWithPassword)
+	if err != nil {
+		log.Error().Err(err).Msg("Error scanning user")
+		return nil, err
 	}
 
 	if len(users) == 0 {
-		return nil, errors.New("No user found")
+		return nil, ErrUserNotFound
 	}
 
-	u.ID = users[0].ID
-	u.Name = users[0].Name
-	u.Email = users[0].Email
-	u.Password = users[0].Password
-	u.CreatedAt = users[0].CreatedAt
-	u.UpdatedAt = users[0].UpdatedAt
+	return users[0], nil
+}
+
+func (u *User) FindByID(id uuid.UUID) (*User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	query := `SELECT ` + userColumnsWithPassword + ` FROM users WHERE id = $1 AND deleted_at IS NULL`
+
+	user, err := scanUserWithPassword(db.QueryRowContext(ctx, query, id))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
 
-	return u, nil
+	if err != nil {
+		log.Error().Err(err).Msg("Error finding user")
+		return nil, err
+	}
+
+	return user, nil
 }
 
+// Updates the name of the user with the given email
+// Passwords are changed through `Patch`, see `POST /api/v1/me/password`
 func (u *User) UpdateByEmail(user User) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 
 	defer cancel()
 
-	query := `UPDATE users SET name = $1, email = $2, password = $3, updated_at = $4 WHERE email = $5`
+	var current User
+
+	currentUser, err := current.FindByEmail(user.Email)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE users SET name = $1, updated_at = $2 WHERE id = $3 AND deleted_at IS NULL`
 
-	_, err := db.ExecContext(ctx, query, user.Name, user.Email, user.Password, time.Now(), user.Email)
+	_, err = db.ExecContext(ctx, query, user.Name, time.Now(), currentUser.ID)
 	if err != nil {
 		log.Error().Err(err).Msg("Error updating user")
 		return err
@@ -151,3 +317,367 @@ func (u *User) UpdateByEmail(user User) error {
 
 	return nil
 }
+
+// Soft deletes the user with the given ID, it is hidden from every other query
+// until it is restored or purged by `PurgeDeleted`
+func (u *User) DeleteByID(id uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	query := `UPDATE users SET deleted_at = $1 WHERE id = $2 AND deleted_at IS NULL`
+
+	result, err := db.ExecContext(ctx, query, time.Now(), id)
+	if err != nil {
+		log.Error().Err(err).Msg("Error deleting user")
+		return err
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// Returns the soft deleted user with the given ID
+func (u *User) FindDeletedByID(id uuid.UUID) (*User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1 AND deleted_at IS NOT NULL`
+
+	user, err := scanUser(db.QueryRowContext(ctx, query, id))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error finding deleted user")
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// Restores the soft deleted user with the given ID
+func (u *User) Restore(id uuid.UUID) (*User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	query := `UPDATE users SET deleted_at = NULL, updated_at = $1 WHERE id = $2 AND deleted_at IS NOT NULL RETURNING ` + userColumns
+
+	user, err := scanUser(db.QueryRowContext(ctx, query, time.Now(), id))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+
+	if isUniqueViolation(err) {
+		return nil, ErrDuplicateEmail
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error restoring user")
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// Hard deletes the users soft deleted before `before`, along with their questions and answers
+// Their comments become tombstones. Returns the emails of the purged users
+func (u *User) PurgeDeleted(before time.Time) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM answers WHERE user_id IN (SELECT id FROM users WHERE deleted_at < $1)`, before)
+	if err != nil {
+		log.Error().Err(err).Msg("Error purging answers")
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM questions WHERE user_id IN (SELECT id FROM users WHERE deleted_at < $1)`, before)
+	if err != nil {
+		log.Error().Err(err).Msg("Error purging questions")
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE comments SET body = '', user_id = NULL, deleted_at = COALESCE(deleted_at, NOW()), updated_at = NOW()
+		WHERE user_id IN (SELECT id FROM users WHERE deleted_at < $1)`, before)
+	if err != nil {
+		log.Error().Err(err).Msg("Error purging comments")
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `DELETE FROM users WHERE deleted_at < $1 RETURNING email`, before)
+	if err != nil {
+		log.Error().Err(err).Msg("Error purging users")
+		return nil, err
+	}
+
+	var emails []string
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		emails = append(emails, email)
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return emails, tx.Commit()
+}
+
+// Outcome of `User.Erase`
+type Erasure struct {
+	Email            string // Email the user had before the erasure
+	QuestionsDeleted int64
+	AnswersDeleted   int64
+}
+
+// Anonymizes the user and deletes its questions, answers and linked identities
+// The anonymized row is soft deleted and purged after the retention period
+func (u *User) Erase(id uuid.UUID) (*Erasure, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	var erasure Erasure
+
+	err = tx.QueryRowContext(ctx, `SELECT email FROM users WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, id).Scan(&erasure.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM answers WHERE user_id = $1`, id)
+	if err != nil {
+		log.Error().Err(err).Msg("Error erasing answers")
+		return nil, err
+	}
+	erasure.AnswersDeleted, _ = result.RowsAffected()
+
+	result, err = tx.ExecContext(ctx, `DELETE FROM questions WHERE user_id = $1`, id)
+	if err != nil {
+		log.Error().Err(err).Msg("Error erasing questions")
+		return nil, err
+	}
+	erasure.QuestionsDeleted, _ = result.RowsAffected()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM user_identities WHERE user_id = $1`, id)
+	if err != nil {
+		log.Error().Err(err).Msg("Error erasing identities")
+		return nil, err
+	}
+
+	now := time.Now()
+
+	// Comments become tombstones so the replies to them stay in place
+	_, err = tx.ExecContext(ctx, `UPDATE comments SET body = '', user_id = NULL, deleted_at = COALESCE(deleted_at, $2), updated_at = $2
+		WHERE user_id = $1`, id, now)
+	if err != nil {
+		log.Error().Err(err).Msg("Error erasing comments")
+		return nil, err
+	}
+
+	// The email stays unique, the empty password never matches a bcrypt hash
+	query := `UPDATE users SET name = 'Erased user', email = $1, password = '', pending_email = NULL, avatar_sha256 = NULL,
+		disabled = TRUE, tokens_valid_after = $2, updated_at = $2, deleted_at = $2 WHERE id = $3`
+
+	_, err = tx.ExecContext(ctx, query, fmt.Sprintf("erased+%s@invalid", id), now, id)
+	if err != nil {
+		log.Error().Err(err).Msg("Error anonymizing user")
+		return nil, err
+	}
+
+	err = recordAuditEvent(ctx, tx, id, AuditUserErased, map[string]interface{}{
+		"questions_deleted": erasure.QuestionsDeleted,
+		"answers_deleted":   erasure.AnswersDeleted,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &erasure, tx.Commit()
+}
+
+// Changes to apply to a user, nil fields are left untouched
+type UserPatch struct {
+	Name         *string
+	Password     *string // Plain text, hashed before it is stored
+	PendingEmail *string // Applied by `ConfirmEmail` once verified
+}
+
+// Applies the patch to the user with the given ID and returns the updated user
+func (u *User) Patch(id uuid.UUID, patch UserPatch) (*User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	now := time.Now()
+	var sets []string
+	var args []interface{}
+
+	set := func(column string, value interface{}) {
+		args = append(args, value)
+		sets = append(sets, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	if patch.Name != nil {
+		set("name", *patch.Name)
+	}
+
+	if patch.Password != nil {
+		hashedPassword, err := helpers.HashPassword(*patch.Password)
+		if err != nil {
+			return nil, err
+		}
+
+		set("password", hashedPassword)
+		set("password_changed_at", now)
+	}
+
+	if patch.PendingEmail != nil {
+		set("pending_email", helpers.NormalizeEmail(*patch.PendingEmail))
+	}
+
+	set("updated_at", now)
+
+	args = append(args, id)
+	query := fmt.Sprintf(`UPDATE users SET %s WHERE id = $%d AND deleted_at IS NULL RETURNING %s`, strings.Join(sets, ", "), len(args), userColumns)
+
+	user, err := scanUser(db.QueryRowContext(ctx, query, args...))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error patching user")
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// Replaces the email of the user with its pending email, if it still is `email`
+func (u *User) ConfirmEmail(id uuid.UUID, email string) (*User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	query := `UPDATE users SET email = pending_email, pending_email = NULL, updated_at = $1 WHERE id = $2 AND pending_email = $3 AND deleted_at IS NULL RETURNING ` + userColumns
+
+	user, err := scanUser(db.QueryRowContext(ctx, query, time.Now(), id, helpers.NormalizeEmail(email)))
+
+	if isUniqueViolation(err) {
+		return nil, ErrDuplicateEmail
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("No pending email change found")
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error confirming email")
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// Fields of a user that decide whether its issued tokens are still honoured
+type UserAuthStatus struct {
+	ID                uuid.UUID  `json:"id"`
+	Email             string     `json:"email"`
+	Disabled          bool       `json:"disabled"`
+	PasswordChangedAt *time.Time `json:"password_changed_at,omitempty"`
+	TokensValidAfter  *time.Time `json:"tokens_valid_after,omitempty"`
+}
+
+// Returns the auth status of the user with the given email
+// Returns nil without an error if no such user exists
+func (u *User) FindAuthStatus(email string) (*UserAuthStatus, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	query := `SELECT id, email, disabled, password_changed_at, tokens_valid_after FROM users WHERE LOWER(email) = $1 AND deleted_at IS NULL`
+
+	var status UserAuthStatus
+	err := db.QueryRowContext(ctx, query, helpers.NormalizeEmail(email)).Scan(
+		&status.ID,
+		&status.Email,
+		&status.Disabled,
+		&status.PasswordChangedAt,
+		&status.TokensValidAfter,
+	)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error finding user auth status")
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+// Returns the roles stored for the user with the given email, sorted by name
+func (u *User) FindRoles(email string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	query := `SELECT r.role FROM user_roles r JOIN users u ON u.id = r.user_id WHERE LOWER(u.email) = $1 AND u.deleted_at IS NULL ORDER BY r.role`
+
+	rows, err := db.QueryContext(ctx, query, helpers.NormalizeEmail(email))
+	if err != nil {
+		log.Error().Err(err).Msg("Error finding user roles")
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var roles []string
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
@@ -0,0 +1,147 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"server/helpers"
+)
+
+// Bulk operations run longer than single row queries
+const bulkTimeout = 10 * time.Minute
+
+// Rows inserted per statement by `UserImport.Insert`
+const ImportBatchSize = 500
+
+// Inserts users in batches within a single transaction
+// Nothing is persisted until `Commit`
+type UserImport struct {
+	tx     *sql.Tx
+	cancel context.CancelFunc
+	ctx    context.Context
+	dryRun bool // Rolled back, passwords are not hashed
+}
+
+// Starts a bulk import transaction, a dry run only checks which users would be inserted
+func (u *User) BeginImport(dryRun bool) (*UserImport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), bulkTimeout)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return &UserImport{tx: tx, cancel: cancel, ctx: ctx, dryRun: dryRun}, nil
+}
+
+// Hashes the password of an imported user, a random one if it is empty
+// Dry runs are rolled back, hashing would only slow them down
+func (i *UserImport) hashPassword(password string) (string, error) {
+	if i.dryRun {
+		return "", nil
+	}
+
+	if password == "" {
+		random, err := helpers.RandomToken(32)
+		if err != nil {
+			return "", err
+		}
+		password = random
+	}
+
+	return helpers.HashPassword(password)
+}
+
+// Inserts the users, skipping those whose email is already taken
+// Returns the emails of the inserted users
+func (i *UserImport) Insert(users []User) (map[string]bool, error) {
+	inserted := map[string]bool{}
+	if len(users) == 0 {
+		return inserted, nil
+	}
+
+	args := []interface{}{time.Now()}
+	values := make([]string, 0, len(users))
+
+	for _, user := range users {
+		hashedPassword, err := i.hashPassword(user.Password)
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, user.Name, helpers.NormalizeEmail(user.Email), hashedPassword)
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d, $1, $1)", len(args)-2, len(args)-1, len(args)))
+	}
+
+	query := `INSERT INTO users (name, email, password, created_at, updated_at) VALUES ` + strings.Join(values, ", ") +
+		` ON CONFLICT (LOWER(email)) WHERE deleted_at IS NULL DO NOTHING RETURNING email`
+
+	rows, err := i.tx.QueryContext(i.ctx, query, args...)
+	if err != nil {
+		log.Error().Err(err).Msg("Error importing users")
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return nil, err
+		}
+
+		inserted[email] = true
+	}
+
+	return inserted, rows.Err()
+}
+
+// Persists the imported users
+func (i *UserImport) Commit() error {
+	defer i.cancel()
+
+	return i.tx.Commit()
+}
+
+// Discards the imported users
+func (i *UserImport) Rollback() error {
+	defer i.cancel()
+
+	return i.tx.Rollback()
+}
+
+// Calls fn for every user, in creation order, without loading them all in memory
+func (u *User) Export(fn func(user *User) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), bulkTimeout)
+
+	defer cancel()
+
+	query := `SELECT ` + userColumns + ` FROM users WHERE deleted_at IS NULL ORDER BY created_at, id`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		log.Error().Err(err).Msg("Error exporting users")
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
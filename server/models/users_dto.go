@@ -0,0 +1,91 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// Input to create a user
+type CreateUserInput struct {
+	Name     string `json:"name" validate:"required"`
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
+
+// Input to update the user with the given email
+type UpdateUserInput struct {
+	Name  string `json:"name" validate:"required"`
+	Email string `json:"email" validate:"required,email"`
+
+	// Rejected, passwords are changed with the current one through `POST /api/v1/me/password`
+	Password string `json:"password,omitempty"`
+}
+
+// Public view of a user returned by the API
+// Never add credential material such as password hashes here
+type PublicUser struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Reputation int `json:"reputation"`
+}
+
+// Returns the user to create from the input
+func (input CreateUserInput) User() User {
+	return User{Name: input.Name, Email: input.Email, Password: input.Password}
+}
+
+// Returns the updated user from the input
+func (input UpdateUserInput) User() User {
+	return User{Name: input.Name, Email: input.Email}
+}
+
+// Returns the public view of the user
+func (u *User) Public() PublicUser {
+	return PublicUser{
+		ID:        u.ID,
+		Name:      u.Name,
+		Email:     u.Email,
+		CreatedAt: u.CreatedAt,
+		UpdatedAt: u.UpdatedAt,
+
+		Reputation: u.Reputation,
+	}
+}
+
+// Returns the public views of the users
+func PublicUsers(users []*User) []PublicUser {
+	publicUsers := make([]PublicUser, 0, len(users))
+
+	for _, user := range users {
+		publicUsers = append(publicUsers, user.Public())
+	}
+
+	return publicUsers
+}
+
+// Patchable representation of a user, the document merge and JSON patches apply to
+// The password is write-only and absent from the original document
+type UserPatchDocument struct {
+	Name     string  `json:"name" validate:"required"`
+	Email    string  `json:"email" validate:"required,email"`
+	Password *string `json:"password,omitempty" validate:"omitempty,min=1"`
+}
+
+// Body of `POST /api/v1/me/password`
+type ChangePasswordInput struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,nefield=CurrentPassword"`
+}
+
+// A row of a bulk user import
+// Users imported without a password must reset it before signing in with one
+type ImportUserInput struct {
+	Name     string `json:"name" validate:"required"`
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password,omitempty"`
+}
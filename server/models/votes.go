@@ -0,0 +1,195 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+var ErrOwnVote = errors.New("You can't vote on your own content")
+
+// Content users vote on, with the reputation its author earns per vote
+type VoteTarget struct {
+	Name        string // Singular, for error messages
+	table       string
+	votesTable  string
+	votesColumn string
+
+	UpvoteReputation   int
+	DownvoteReputation int
+}
+
+var (
+	QuestionVotes = VoteTarget{
+		Name:               "question",
+		table:              "questions",
+		votesTable:         "question_votes",
+		votesColumn:        "question_id",
+		UpvoteReputation:   5,
+		DownvoteReputation: -2,
+	}
+	AnswerVotes = VoteTarget{
+		Name:               "answer",
+		table:              "answers",
+		votesTable:         "answer_votes",
+		votesColumn:        "answer_id",
+		UpvoteReputation:   10,
+		DownvoteReputation: -2,
+	}
+)
+
+// Returns the reputation the author earns for a vote of the given value, 0 for no vote
+func (t VoteTarget) reputation(value int) int {
+	switch {
+	case value > 0:
+		return t.UpvoteReputation
+	case value < 0:
+		return t.DownvoteReputation
+	}
+
+	return 0
+}
+
+// State of an item after a vote
+type VoteResult struct {
+	Score int `json:"score"`
+	Vote  int `json:"vote"` // Vote of the user, 1, -1 or 0 for none
+}
+
+type Vote struct{}
+
+// Sets the vote of the user on the item, 1 or -1, 0 retracts it
+// The item's score and its author's reputation are updated in the same transaction,
+// repeating a vote leaves them unchanged
+func (v *Vote) Cast(target VoteTarget, id uuid.UUID, userID uuid.UUID, value int) (*VoteResult, error) {
+	if value < -1 || value > 1 {
+		return nil, errors.New("Invalid vote")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	// Locking the item serializes the votes on it, so the previous vote read below stays current
+	var authorID uuid.UUID
+	var score int
+
+	err = tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT user_id, score FROM %s WHERE id = $1 FOR UPDATE`, target.table), id).Scan(&authorID, &score)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("No %s found", target.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if authorID == userID {
+		return nil, ErrOwnVote
+	}
+
+	var previous int
+
+	err = tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT value FROM %s WHERE %s = $1 AND user_id = $2`, target.votesTable, target.votesColumn), id, userID).Scan(&previous)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	if previous == value {
+		return &VoteResult{Score: score, Vote: value}, nil
+	}
+
+	now := time.Now()
+
+	if value == 0 {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE %s = $1 AND user_id = $2`, target.votesTable, target.votesColumn), id, userID)
+	} else {
+		query := fmt.Sprintf(`INSERT INTO %s (%s, user_id, value, created_at, updated_at) VALUES ($1, $2, $3, $4, $4)
+			ON CONFLICT (%s, user_id) DO UPDATE SET value = EXCLUDED.value, updated_at = EXCLUDED.updated_at`, target.votesTable, target.votesColumn, target.votesColumn)
+
+		_, err = tx.ExecContext(ctx, query, id, userID, value, now)
+	}
+	if err != nil {
+		log.Error().Err(err).Msgf("Error voting on %s", target.Name)
+		return nil, err
+	}
+
+	err = tx.QueryRowContext(ctx, fmt.Sprintf(`UPDATE %s SET score = score + $1 WHERE id = $2 RETURNING score`, target.table), value-previous, id).Scan(&score)
+	if err != nil {
+		log.Error().Err(err).Msgf("Error updating %s score", target.Name)
+		return nil, err
+	}
+
+	if delta := target.reputation(value) - target.reputation(previous); delta != 0 {
+		_, err = tx.ExecContext(ctx, `UPDATE users SET reputation = reputation + $1 WHERE id = $2`, delta, authorID)
+		if err != nil {
+			log.Error().Err(err).Msg("Error updating reputation")
+			return nil, err
+		}
+	}
+
+	return &VoteResult{Score: score, Vote: value}, tx.Commit()
+}
+
+// Recomputes the scores and reputations from the votes, returns the number of rows fixed
+// They drift when votes are removed by cascades, such as the purge of a user
+func (v *Vote) Reconcile() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), bulkTimeout)
+
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	var fixed int64
+
+	for _, target := range []VoteTarget{QuestionVotes, AnswerVotes} {
+		total := fmt.Sprintf(`COALESCE((SELECT SUM(value) FROM %s WHERE %s = %s.id), 0)`, target.votesTable, target.votesColumn, target.table)
+
+		result, err := tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET score = %s WHERE score <> %s`, target.table, total, total))
+		if err != nil {
+			log.Error().Err(err).Msgf("Error reconciling %s scores", target.Name)
+			return 0, err
+		}
+
+		affected, _ := result.RowsAffected()
+		fixed += affected
+	}
+
+	received := func(target VoteTarget) string {
+		return fmt.Sprintf(`SELECT t.user_id, CASE WHEN v.value > 0 THEN %d ELSE %d END AS reputation FROM %s v JOIN %s t ON t.id = v.%s`,
+			target.UpvoteReputation, target.DownvoteReputation, target.votesTable, target.table, target.votesColumn)
+	}
+
+	query := fmt.Sprintf(`WITH totals AS (
+			SELECT user_id, SUM(reputation) AS reputation FROM (%s UNION ALL %s) received GROUP BY user_id
+		)
+		UPDATE users SET reputation = COALESCE(totals.reputation, 0)
+		FROM users u LEFT JOIN totals ON totals.user_id = u.id
+		WHERE users.id = u.id AND users.reputation <> COALESCE(totals.reputation, 0)`, received(QuestionVotes), received(AnswerVotes))
+
+	result, err := tx.ExecContext(ctx, query)
+	if err != nil {
+		log.Error().Err(err).Msg("Error reconciling reputations")
+		return 0, err
+	}
+
+	affected, _ := result.RowsAffected()
+	fixed += affected
+
+	return fixed, tx.Commit()
+}
@@ -3,6 +3,7 @@ package redis
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -34,6 +35,11 @@ func InitRedisClient() (*redis.Client, error) {
 	return client, nil
 }
 
+// Sets the client used by the cache functions, e.g. to point them at a test server
+func SetClient(client *redis.Client) {
+	redisClient = client
+}
+
 // Test Redis
 func Test() {
 	set, err := redisClient.SetNX(ctx, "test-key", "test-value", 100*time.Second).Result()
@@ -91,3 +97,63 @@ func DeleteCache(key string) error {
 
 	return nil
 }
+
+// Set a Key, Value pair in Redis, replacing any existing value
+func UpdateCache(key string, value string, ttl time.Duration) error {
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+
+	err := redisClient.Set(ctx, key, value, ttl).Err()
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error setting key")
+		return err
+	}
+
+	return nil
+}
+
+// Get the remaining time to live of a key, 0 if it does not exist or never expires
+func GetTTL(key string) (time.Duration, error) {
+	ttl, err := redisClient.TTL(ctx, key).Result()
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error getting key TTL")
+		return 0, err
+	}
+
+	if ttl < 0 {
+		return 0, nil
+	}
+
+	return ttl, nil
+}
+
+// Increment the counter stored at key, creating it if needed, and return its new value
+func Increment(key string) (int64, error) {
+	value, err := redisClient.Incr(ctx, key).Result()
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error incrementing key")
+		return 0, err
+	}
+
+	return value, nil
+}
+
+// Get the counter stored at key, 0 if it does not exist
+func GetCounter(key string) (int64, error) {
+	value, err := redisClient.Get(ctx, key).Int64()
+
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error getting counter")
+		return 0, err
+	}
+
+	return value, nil
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/go-chi/cors"
 	"github.com/go-chi/httprate"
 	"github.com/go-chi/jwtauth/v5"
+	"github.com/rs/zerolog/log"
 	"github.com/unrolled/secure"
 
 	// "github.com/go-chi/oauth"
@@ -25,6 +26,7 @@ import (
 	"server/env"
 	"server/handlers"
 	middlewareCustom "server/middleware"
+	"server/storage"
 
 	// "server/models"
 	_ "server/docs"
@@ -32,13 +34,37 @@ import (
 
 var tokenAuth *jwtauth.JWTAuth
 
-func init() {
-	tokenAuth = authorization.InitJWTAuth()
-}
+// Matches user IDs only, other path segments fall through to the deprecated email routes
+const userIDPattern = "/{id:[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}}"
+
+// When the routes keyed by email are removed
+var emailRoutesSunset = time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)
 
 // Returns a router with all routes configured
 func Routes() http.Handler {
+	tokenAuth = authorization.InitJWTAuth()
+
+	err := authentication.InitAuthenticators(env.DefaultConfig)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error configuring authentication backends")
+	}
+
+	err = authentication.InitExternalProviders(env.DefaultConfig.OAUTH_PROVIDERS)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error configuring external identity providers")
+	}
+
+	err = storage.InitStore(env.DefaultConfig.STORAGE)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error configuring file storage")
+	}
 
+	return Router(tokenAuth)
+}
+
+// Returns the router with all routes, verifying access tokens with `tokenAuth`
+// The authentication backends and the file store are configured by `Routes`
+func Router(tokenAuth *jwtauth.JWTAuth) http.Handler {
 	//INFO: Refer [to](https://github.com/unrolled/secure?tab=readme-ov-file#default-options)
 	secureMiddleware := secure.New(secure.Options{
 		IsDevelopment:         env.DefaultConfig.ENVIRONMENT == "development",
@@ -68,6 +94,9 @@ func Routes() http.Handler {
 			r.With(httprate.LimitByIP(3, 30*time.Minute)).Post("/token", authentication.GenerateToken)
 			r.With(httprate.LimitByIP(3, 30*time.Minute)).Get("/token/refresh", authentication.RefreshToken)
 			r.With(httprate.LimitByIP(3, 30*time.Minute)).Post("/token/revoke", authentication.RevokeToken)
+
+			r.Get("/external/{provider}/start", authentication.StartExternalLogin)
+			r.With(httprate.LimitByIP(10, time.Minute)).Get("/external/{provider}/callback", authentication.ExternalLoginCallback)
 		})
 	})
 
@@ -79,20 +108,131 @@ func Routes() http.Handler {
 		httpSwagger.URL("http://localhost:5000/swagger/doc.json"), //The url pointing to API definition
 	))
 
-	router.Group(func(r chi.Router) {
-		router.Route("/api/v1/users", func(r chi.Router) {
-			// r.Get("/", handlers.GetAllUsers)
-			r.With(middlewareCustom.CacheMiddleware(0)).Get("/", handlers.GetAllUsers) //Response is cached
-			r.Post("/", handlers.CreateUser)
-			r.Get("/{email}", handlers.FindUserByEmail)
-			r.Put("/", handlers.UpdateUserByEmail)
+	router.Route("/api/v1/users", func(r chi.Router) {
+		// Tokens are single use and sent to the new address
+		r.With(httprate.LimitByIP(10, time.Minute)).Post("/verify-email", handlers.VerifyEmail)
+
+		//Rate limit by IP for 3 requests per 30 minutes
+		r.With(httprate.LimitByIP(3, 30*time.Minute)).Post("/check-password", handlers.CheckUserPassword)
 
-			//Rate limit by IP for 3 requests per 30 minutes
-			r.With(httprate.LimitByIP(3, 30*time.Minute)).Post("/check-password", handlers.CheckUserPassword)
+		r.Get(userIDPattern+"/avatar", handlers.GetUserAvatar)
 
+		r.Group(func(r chi.Router) {
+			r.Use(jwtauth.Verifier(tokenAuth))
+			r.Use(middlewareCustom.Authenticator)
+			r.Use(middlewareCustom.RBACMiddleware)
+
+			// Admins only
+			r.Group(func(r chi.Router) {
+				r.Use(middlewareCustom.RBACMiddlewareProtectedRoute(authorization.RoleAdmin))
+				r.Get("/", handlers.GetAllUsers) // Not cached, every user write would have to clear it
+				r.Post("/", handlers.CreateUser)
+			})
+
+			// Users may only access themselves, admins anyone
+			r.Group(func(r chi.Router) {
+				r.Use(middlewareCustom.RequireSelfOrAdmin)
+				r.Get(userIDPattern, handlers.GetUser)
+				r.Patch(userIDPattern, handlers.PatchUser)
+				r.Delete(userIDPattern, handlers.DeleteUser)
+			})
+
+			// Keyed by email, superseded by the ID routes found through the collection
+			r.Group(func(r chi.Router) {
+				r.Use(middlewareCustom.Deprecated(emailRoutesSunset, "/api/v1/users"))
+				r.With(middlewareCustom.RequireSelfOrAdmin).Get("/{email}", handlers.FindUserByEmail)
+				r.Put("/", handlers.UpdateUserByEmail) // Ownership is checked against the body
+			})
 		})
 	})
 
+	if env.DefaultConfig.SELF_REGISTRATION {
+		router.With(httprate.LimitByIP(5, time.Hour)).Post("/api/v1/register", handlers.Register)
+	}
+
+	router.Route("/api/v1/questions", func(r chi.Router) {
+		// Public, signed in authors and moderators also see the content hidden from others
+		r.Group(func(r chi.Router) {
+			r.Use(jwtauth.Verifier(tokenAuth))
+			r.Use(middlewareCustom.OptionalAuthenticator)
+
+			r.Get("/", handlers.GetAllQuestions)
+			r.Get("/{id}", handlers.GetQuestion)
+			r.Get("/{id}/revisions", handlers.GetQuestionRevisions)
+			r.Get("/{id}/attachments", handlers.GetAttachments)
+			r.Get("/{id}/comments", handlers.GetQuestionComments)
+			r.Get("/{id}/answers", handlers.GetAnswers)
+			r.Get("/{id}/answers/{answerID}", handlers.GetAnswer)
+			r.Get("/{id}/answers/{answerID}/comments", handlers.GetAnswerComments)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(jwtauth.Verifier(tokenAuth))
+			r.Use(middlewareCustom.Authenticator)
+			r.Use(middlewareCustom.RBACMiddleware)
+
+			r.Post("/", handlers.CreateQuestion)
+			r.Put("/{id}", handlers.UpdateQuestion)
+			r.Delete("/{id}", handlers.DeleteQuestion)
+			r.Post("/{id}/revisions/{revisionID}/rollback", handlers.RollbackQuestion)
+			r.With(httprate.LimitByIP(30, time.Hour)).Post("/{id}/attachments", handlers.UploadAttachment)
+			r.Delete("/{id}/attachments/{attachmentID}", handlers.DeleteAttachment)
+
+			r.Post("/{id}/answers", handlers.CreateAnswer)
+			r.Put("/{id}/answers/{answerID}", handlers.UpdateAnswer)
+			r.Delete("/{id}/answers/{answerID}", handlers.DeleteAnswer)
+			r.Put("/{id}/answers/{answerID}/accept", handlers.AcceptAnswer)
+			r.Delete("/{id}/answers/{answerID}/accept", handlers.UnacceptAnswer)
+
+			r.Put("/{id}/vote", handlers.VoteQuestion)
+			r.Delete("/{id}/vote", handlers.UnvoteQuestion)
+			r.Put("/{id}/answers/{answerID}/vote", handlers.VoteAnswer)
+			r.Delete("/{id}/answers/{answerID}/vote", handlers.UnvoteAnswer)
+
+			r.With(httprate.LimitByIP(60, time.Hour)).Post("/{id}/comments", handlers.CreateQuestionComment)
+			r.With(httprate.LimitByIP(60, time.Hour)).Post("/{id}/answers/{answerID}/comments", handlers.CreateAnswerComment)
+			r.Put("/{id}/comments/{commentID}", handlers.UpdateComment)
+			r.Delete("/{id}/comments/{commentID}", handlers.DeleteComment)
+
+			r.With(httprate.LimitByIP(20, time.Hour)).Post("/{id}/flag", handlers.FlagQuestion)
+			r.With(httprate.LimitByIP(20, time.Hour)).Post("/{id}/answers/{answerID}/flag", handlers.FlagAnswer)
+		})
+	})
+
+	router.With(httprate.LimitByIP(60, time.Minute)).Get("/api/v1/search", handlers.Search)
+
+	// Signed downloads of the local storage backend
+	router.Get(storage.LocalFilesPath+"/*", handlers.DownloadFile)
+
+	router.Route("/api/v1/tags", func(r chi.Router) {
+		r.Get("/", handlers.GetTags)
+		r.Get("/{name}/synonyms", handlers.GetTagSynonyms)
+	})
+
+	// Profile of the authenticated user
+	router.Route("/api/v1/me", func(r chi.Router) {
+		r.Use(jwtauth.Verifier(tokenAuth))
+		r.Use(middlewareCustom.Authenticator)
+		r.Use(middlewareCustom.RBACMiddleware)
+
+		r.Get("/", handlers.GetMe)
+		r.Patch("/", handlers.PatchMe)
+		r.Delete("/", handlers.DeleteMe)
+		r.With(httprate.LimitByIP(5, 15*time.Minute)).Post("/password", handlers.ChangeMyPassword)
+
+		// Data subject requests
+		r.With(httprate.LimitByIP(3, time.Hour)).Post("/export", handlers.RequestDataExport)
+		r.Get("/export/{jobID}", handlers.GetDataExport)
+		r.Get("/export/{jobID}/download", handlers.DownloadDataExport)
+		r.Post("/erase", handlers.EraseMe)
+
+		r.With(httprate.LimitByIP(10, time.Hour)).Put("/avatar", handlers.PutMyAvatar)
+		r.Delete("/avatar", handlers.DeleteMyAvatar)
+
+		r.Get("/notifications", handlers.GetMyNotifications)
+		r.Post("/notifications/read", handlers.ReadMyNotifications)
+	})
+
 	// Protected routes
 	router.Group(func(r chi.Router) {
 		router.Route("/api/v1/admin", func(r chi.Router) {
@@ -100,12 +240,27 @@ func Routes() http.Handler {
 			//2. Authenticate token
 			//3. Populate roles from token into context
 			r.Use(jwtauth.Verifier(tokenAuth))
-			r.Use(jwtauth.Authenticator) //TODO: Add custom Authenticator to verify token against DB
+			r.Use(middlewareCustom.Authenticator)
 			r.Use(middlewareCustom.RBACMiddleware)
 
-			r.With(middlewareCustom.RBACMiddlewareProtectedRoute("admin")).Get("/", func(w http.ResponseWriter, r *http.Request) {
-				_, claims, _ := jwtauth.FromContext(r.Context())
-				w.Write([]byte(fmt.Sprintf("Hello, %v you are authorized to view this.", claims["user_id"])))
+			r.With(middlewareCustom.RBACMiddlewareProtectedRoute(authorization.RoleAdmin)).Get("/", func(w http.ResponseWriter, r *http.Request) {
+				principal, _ := authorization.FromContext(r.Context())
+				w.Write([]byte(fmt.Sprintf("Hello, %v you are authorized to view this.", principal.Email)))
+			})
+
+			r.With(middlewareCustom.RBACMiddlewareProtectedRoute(authorization.RoleAdmin)).Post("/users"+userIDPattern+"/restore", handlers.RestoreUser)
+			r.With(middlewareCustom.RBACMiddlewareProtectedRoute(authorization.RoleAdmin)).Post("/users/import", handlers.ImportUsers)
+			r.With(middlewareCustom.RBACMiddlewareProtectedRoute(authorization.RoleAdmin)).Get("/users/export", handlers.ExportUsers)
+
+			r.With(middlewareCustom.RBACMiddlewareProtectedRoute(authorization.RoleAdmin)).Post("/tags/{name}/synonyms", handlers.AddTagSynonym)
+			r.With(middlewareCustom.RBACMiddlewareProtectedRoute(authorization.RoleAdmin)).Delete("/tags/{name}/synonyms/{synonym}", handlers.DeleteTagSynonym)
+
+			// Moderators review flagged content
+			r.Route("/moderation", func(r chi.Router) {
+				r.Use(middlewareCustom.RequireModerator)
+				r.Get("/", handlers.GetModerationQueue)
+				r.Post("/{type:questions|answers}/{id}", handlers.ModerateContent)
+				r.Get("/{type:questions|answers}/{id}/decisions", handlers.GetModerationDecisions)
 			})
 		})
 	})
@@ -0,0 +1,156 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+
+	"server/env"
+	"server/models"
+	"server/redis"
+)
+
+const (
+	testUserID     = "9b2c1e0e-6f55-4c4b-9a0b-3f1f4a8b2c11"
+	testQuestionID = "0f8e7d6c-5b4a-4c3d-9e2f-1a0b9c8d7e6f"
+	testSecret     = "test-secret"
+)
+
+// Returns the application router backed by a mocked database and Redis
+func setupRoutesTest(t *testing.T) (http.Handler, sqlmock.Sqlmock) {
+	dbMock, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating DB mock: %s", err)
+	}
+	t.Cleanup(func() { dbMock.Close() })
+
+	models.New(dbMock)
+
+	redisServer := miniredis.RunT(t)
+	redis.SetClient(goredis.NewClient(&goredis.Options{Addr: redisServer.Addr()}))
+
+	t.Setenv("JWT_SECRET", testSecret)
+
+	previous := env.DefaultConfig
+	env.DefaultConfig.STORAGE = env.StorageConfig{BACKEND: "local", DIR: t.TempDir(), URL_SECRET: testSecret}
+	t.Cleanup(func() { env.DefaultConfig = previous })
+
+	return Routes(), mock
+}
+
+// Returns a request with the access token of the user, whose auth status is looked up once
+func asUser(t *testing.T, mock sqlmock.Sqlmock, r *http.Request, email string, roles ...string) *http.Request {
+	_, token, err := tokenAuth.Encode(map[string]interface{}{
+		"sub":   email,
+		"roles": roles,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		t.Fatalf("Error encoding token: %s", err)
+	}
+
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE LOWER\\(email\\)").WithArgs(email).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "disabled", "password_changed_at", "tokens_valid_after"}).
+			AddRow(testUserID, email, false, nil, nil))
+
+	r.Header.Set("Authorization", "Bearer "+token)
+	r.Host = "localhost:5000"
+
+	return r
+}
+
+func newRequest(method string, target string) *http.Request {
+	r := httptest.NewRequest(method, target, nil)
+	r.Host = "localhost:5000"
+
+	return r
+}
+
+func TestHiddenQuestionThroughRoutes(t *testing.T) {
+	tests := []struct {
+		name   string
+		signIn bool
+		token  string
+		status int
+	}{
+		{name: "anonymous", status: http.StatusNotFound},
+		{name: "invalid token is ignored", token: "not-a-token", status: http.StatusNotFound},
+		{name: "author", signIn: true, status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock := setupRoutesTest(t)
+
+			r := newRequest(http.MethodGet, "/api/v1/questions/"+testQuestionID+"?comments=0")
+			if tt.signIn {
+				r = asUser(t, mock, r, "alice@example.com")
+			}
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+
+			now := time.Now()
+			mock.ExpectQuery("SELECT (.+) FROM questions WHERE id").WithArgs(testQuestionID).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "question", "created_at", "updated_at", "user_id", "score", "accepted_answer_id", "status"}).
+					AddRow(testQuestionID, "What is Go?", now, now, testUserID, 0, nil, models.StatusHidden))
+			mock.ExpectQuery("SELECT (.+) FROM question_tags").WithArgs(testQuestionID).WillReturnRows(sqlmock.NewRows([]string{"question_id", "name"}))
+			if tt.status == http.StatusOK {
+				mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM comments").WithArgs(testQuestionID).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			}
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, r)
+
+			assert.Equal(t, tt.status, rec.Code, rec.Body.String())
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestUserRoutesRequireAuthentication(t *testing.T) {
+	otherUserID := "7a1d2c3b-4e5f-4a6b-8c7d-9e0f1a2b3c4d"
+
+	routes := []struct{ method, target string }{
+		{http.MethodGet, "/api/v1/users"},
+		{http.MethodPost, "/api/v1/users"},
+		{http.MethodGet, "/api/v1/users/" + otherUserID},
+		{http.MethodPatch, "/api/v1/users/" + otherUserID},
+		{http.MethodDelete, "/api/v1/users/" + otherUserID},
+		{http.MethodGet, "/api/v1/users/bob@example.com"},
+		{http.MethodPut, "/api/v1/users"},
+		{http.MethodPost, "/api/v1/admin/users/" + otherUserID + "/restore"},
+	}
+
+	for _, route := range routes {
+		t.Run(route.method+" "+route.target, func(t *testing.T) {
+			router, mock := setupRoutesTest(t)
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, newRequest(route.method, route.target))
+
+			assert.Equal(t, http.StatusUnauthorized, rec.Code, rec.Body.String())
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+
+	// Signed in users only reach themselves
+	for _, method := range []string{http.MethodGet, http.MethodPatch, http.MethodDelete} {
+		t.Run(method+" another user", func(t *testing.T) {
+			router, mock := setupRoutesTest(t)
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, asUser(t, mock, newRequest(method, "/api/v1/users/"+otherUserID), "alice@example.com"))
+
+			assert.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
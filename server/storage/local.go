@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidKey = errors.New("Invalid file key")
+	ErrInvalidURL = errors.New("Invalid or expired URL")
+)
+
+// Stores files in a directory, downloads are served by the API with HMAC signed URLs
+type LocalStore struct {
+	Dir     string
+	BaseURL string // Path of the download handler
+
+	secret []byte
+}
+
+// Returns a store rooted at `dir`, which is created if it does not exist
+func NewLocalStore(dir string, baseURL string, secret string) (*LocalStore, error) {
+	if secret == "" {
+		return nil, errors.New("the local storage backend requires a URL secret")
+	}
+
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+
+	return &LocalStore{Dir: dir, BaseURL: strings.TrimSuffix(baseURL, "/"), secret: []byte(secret)}, nil
+}
+
+// Returns the path of the key, rejecting keys that would escape the directory
+func (s *LocalStore) path(key string) (string, error) {
+	if key == "" || path.Clean(key) != key || path.IsAbs(key) || key == ".." || strings.HasPrefix(key, "../") {
+		return "", ErrInvalidKey
+	}
+
+	return filepath.Join(s.Dir, filepath.FromSlash(key)), nil
+}
+
+func (s *LocalStore) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	target, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0o750); err != nil {
+		return err
+	}
+
+	// Written next to the target and renamed, readers never see a partial file
+	file, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(file.Name())
+
+	written, err := io.Copy(file, body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if written != size {
+		return fmt.Errorf("wrote %d bytes of %d", written, size)
+	}
+
+	return os.Rename(file.Name(), target)
+}
+
+func (s *LocalStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	target, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(target)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+
+	return file, err
+}
+
+func (s *LocalStore) Exists(ctx context.Context, key string) (bool, error) {
+	target, err := s.path(key)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = os.Stat(target)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	target, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(target)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+func (s *LocalStore) SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	if _, err := s.path(key); err != nil {
+		return "", err
+	}
+
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+
+	query := url.Values{"expires": {expires}, "signature": {s.sign(key, expires)}}
+
+	return s.BaseURL + "/" + key + "?" + query.Encode(), nil
+}
+
+// Checks the signature and expiry of a URL returned by `SignedURL`
+func (s *LocalStore) Verify(key string, expires string, signature string) error {
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return ErrInvalidURL
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(s.sign(key, expires))) {
+		return ErrInvalidURL
+	}
+
+	return nil
+}
+
+func (s *LocalStore) sign(key string, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(key + "\n" + expires))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
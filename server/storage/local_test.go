@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalStoreRoundTrip(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir(), LocalFilesPath, "secret")
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	key := HashKey("9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08")
+
+	assert.NoError(t, store.Put(ctx, key, strings.NewReader("test"), 4, "text/plain"))
+
+	exists, err := store.Exists(ctx, key)
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	body, err := store.Open(ctx, key)
+	assert.NoError(t, err)
+	content, _ := io.ReadAll(body)
+	body.Close()
+	assert.Equal(t, "test", string(content))
+
+	assert.Error(t, store.Put(ctx, "short", strings.NewReader("test"), 5, "text/plain"), "truncated uploads are not stored")
+
+	exists, err = store.Exists(ctx, "short")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	assert.NoError(t, store.Delete(ctx, key))
+	assert.NoError(t, store.Delete(ctx, key), "deleting a missing file is not an error")
+
+	_, err = store.Open(ctx, key)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestLocalStoreRejectsEscapingKeys(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir(), LocalFilesPath, "secret")
+	assert.NoError(t, err)
+
+	for _, key := range []string{"", "../secret", "/etc/passwd", "a/../../b", "a//b"} {
+		_, err := store.Open(context.Background(), key)
+		assert.ErrorIs(t, err, ErrInvalidKey, key)
+	}
+}
+
+func TestLocalStoreSignedURL(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir(), LocalFilesPath, "secret")
+	assert.NoError(t, err)
+
+	signed, err := store.SignedURL(context.Background(), "sha256/ab/abc", time.Minute)
+	assert.NoError(t, err)
+
+	u, err := url.Parse(signed)
+	assert.NoError(t, err)
+	assert.Equal(t, LocalFilesPath+"/sha256/ab/abc", u.Path)
+
+	expires, signature := u.Query().Get("expires"), u.Query().Get("signature")
+
+	assert.NoError(t, store.Verify("sha256/ab/abc", expires, signature))
+	assert.ErrorIs(t, store.Verify("sha256/ab/abd", expires, signature), ErrInvalidURL, "the key is signed")
+	assert.ErrorIs(t, store.Verify("sha256/ab/abc", expires+"0", signature), ErrInvalidURL, "the expiry is signed")
+
+	past := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	assert.ErrorIs(t, store.Verify("sha256/ab/abc", past, store.sign("sha256/ab/abc", past)), ErrInvalidURL, "expired")
+}
@@ -0,0 +1,303 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/env"
+)
+
+const (
+	s3Algorithm = "AWS4-HMAC-SHA256"
+	s3DateTime  = "20060102T150405Z"
+	s3Date      = "20060102"
+
+	// The body is not hashed, the request is still signed and goes over TLS
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+	// Longest validity of a presigned URL allowed by S3
+	s3MaxURLTTL = 7 * 24 * time.Hour
+)
+
+// Stores files in a bucket of an S3 compatible server, requests are signed with AWS Signature Version 4
+type S3Store struct {
+	Endpoint  *url.URL
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool // Bucket in the path rather than the host name
+
+	Client *http.Client
+
+	now func() time.Time
+}
+
+// Returns a store for the bucket configured by `$STORAGE_S3_*`
+func NewS3Store(config env.StorageConfig) (*S3Store, error) {
+	if config.S3_ENDPOINT == "" || config.S3_BUCKET == "" || config.S3_ACCESS_KEY == "" || config.S3_SECRET_KEY == "" {
+		return nil, errors.New("the s3 storage backend requires $STORAGE_S3_ENDPOINT, $STORAGE_S3_BUCKET, $STORAGE_S3_ACCESS_KEY and $STORAGE_S3_SECRET_KEY")
+	}
+
+	endpoint, err := url.Parse(config.S3_ENDPOINT)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid $STORAGE_S3_ENDPOINT %q", config.S3_ENDPOINT)
+	}
+
+	return &S3Store{
+		Endpoint:  endpoint,
+		Region:    config.S3_REGION,
+		Bucket:    config.S3_BUCKET,
+		AccessKey: config.S3_ACCESS_KEY,
+		SecretKey: config.S3_SECRET_KEY,
+		PathStyle: config.S3_PATH_STYLE,
+		Client:    &http.Client{Timeout: time.Minute},
+		now:       time.Now,
+	}, nil
+}
+
+// Returns the URL of the object stored under the key
+func (s *S3Store) objectURL(key string) *url.URL {
+	u := *s.Endpoint
+	u.RawQuery = ""
+
+	if s.PathStyle {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.Bucket + "/" + key
+	} else {
+		u.Host = s.Bucket + "." + u.Host
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + key
+	}
+
+	u.RawPath = s3Escape(u.Path, false)
+
+	return &u
+}
+
+// Sends a request on the object signed in the Authorization header
+func (s *S3Store) do(ctx context.Context, method string, key string, body io.Reader, size int64, contentType string) (*http.Response, error) {
+	u := s.objectURL(key)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now().UTC()
+
+	req.ContentLength = size
+	req.Header.Set("X-Amz-Date", now.Format(s3DateTime))
+	req.Header.Set("X-Amz-Content-Sha256", s3UnsignedPayload)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	signedHeaders := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if contentType != "" {
+		signedHeaders = append(signedHeaders, "content-type")
+	}
+
+	headers := req.Header.Clone()
+	headers.Set("Host", u.Host)
+
+	signature := s.signature(method, u.EscapedPath(), url.Values{}, headers, signedHeaders, s3UnsignedPayload, now)
+
+	sort.Strings(signedHeaders)
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.AccessKey, s.scope(now), strings.Join(signedHeaders, ";"), signature))
+
+	return s.Client.Do(req)
+}
+
+// Returns an error describing an unexpected response
+func s3Error(resp *http.Response) error {
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	return fmt.Errorf("s3 responded %s: %s", resp.Status, strings.TrimSpace(string(message)))
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	resp, err := s.do(ctx, http.MethodPut, key, body, size, contentType)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp)
+	}
+
+	return nil
+}
+
+func (s *S3Store) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, 0, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, s3Error(resp)
+	}
+
+	return resp.Body, nil
+}
+
+func (s *S3Store) Exists(ctx context.Context, key string) (bool, error) {
+	resp, err := s.do(ctx, http.MethodHead, key, nil, 0, "")
+	if err != nil {
+		return false, err
+	}
+
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, s3Error(resp)
+	}
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, 0, "")
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s3Error(resp)
+	}
+
+	return nil
+}
+
+// Returns a presigned GET URL, S3 checks the signature and expiry
+func (s *S3Store) SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	if ttl <= 0 || ttl > s3MaxURLTTL {
+		return "", fmt.Errorf("URLs are valid for up to %s", s3MaxURLTTL)
+	}
+
+	u := s.objectURL(key)
+	now := s.now().UTC()
+
+	query := url.Values{
+		"X-Amz-Algorithm":     {s3Algorithm},
+		"X-Amz-Credential":    {s.AccessKey + "/" + s.scope(now)},
+		"X-Amz-Date":          {now.Format(s3DateTime)},
+		"X-Amz-Expires":       {strconv.Itoa(int(ttl.Seconds()))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+
+	headers := http.Header{"Host": {u.Host}}
+
+	query.Set("X-Amz-Signature", s.signature(http.MethodGet, u.EscapedPath(), query, headers, []string{"host"}, s3UnsignedPayload, now))
+	u.RawQuery = s3CanonicalQuery(query)
+
+	return u.String(), nil
+}
+
+// Returns the credential scope of requests signed at `t`
+func (s *S3Store) scope(t time.Time) string {
+	return t.Format(s3Date) + "/" + s.Region + "/s3/aws4_request"
+}
+
+// Computes the Signature Version 4 of a request, `headers` must include the host
+func (s *S3Store) signature(method string, escapedPath string, query url.Values, headers http.Header, signedHeaders []string, payloadHash string, t time.Time) string {
+	signed := make([]string, len(signedHeaders))
+	for i, name := range signedHeaders {
+		signed[i] = strings.ToLower(name)
+	}
+	sort.Strings(signed)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range signed {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers.Get(name)) + "\n")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		escapedPath,
+		s3CanonicalQuery(query),
+		canonicalHeaders.String(),
+		strings.Join(signed, ";"),
+		payloadHash,
+	}, "\n")
+
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{s3Algorithm, t.Format(s3DateTime), s.scope(t), hex.EncodeToString(hash[:])}, "\n")
+
+	key := s3HMAC([]byte("AWS4"+s.SecretKey), t.Format(s3Date))
+	key = s3HMAC(key, s.Region)
+	key = s3HMAC(key, "s3")
+	key = s3HMAC(key, "aws4_request")
+
+	return hex.EncodeToString(s3HMAC(key, stringToSign))
+}
+
+func s3HMAC(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+
+	return mac.Sum(nil)
+}
+
+// Returns the query sorted by name with both names and values escaped
+func s3CanonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var pairs []string
+	for _, name := range names {
+		values := append([]string(nil), query[name]...)
+		sort.Strings(values)
+
+		for _, value := range values {
+			pairs = append(pairs, s3Escape(name, true)+"="+s3Escape(value, true))
+		}
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+// Percent-encodes everything but unreserved characters, and `/` unless `encodeSlash` is set
+func s3Escape(s string, encodeSlash bool) string {
+	var escaped strings.Builder
+
+	for _, b := range []byte(s) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9', b == '-', b == '_', b == '.', b == '~':
+			escaped.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			escaped.WriteByte(b)
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+
+	return escaped.String()
+}
@@ -0,0 +1,71 @@
+// Pluggable stores for uploaded files, addressed by key
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"server/env"
+)
+
+var ErrNotFound = errors.New("No file found")
+
+// Stores files under keys made of `/` separated segments
+type BlobStore interface {
+	// Stores the content under the key, replacing any previous one. `size` is the length of the content
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	// Returns the content stored under the key, `ErrNotFound` if there is none
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	// Deletes the content stored under the key, deleting a missing key is not an error
+	Delete(ctx context.Context, key string) error
+	// Returns a URL downloading the content until it expires after `ttl`
+	SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error)
+}
+
+// Path the download handler of the local backend is mounted at
+const LocalFilesPath = "/api/v1/files"
+
+var store BlobStore
+
+// Configures the store from `env.StorageConfig`
+func InitStore(config env.StorageConfig) error {
+	switch config.BACKEND {
+	case "local":
+		local, err := NewLocalStore(config.DIR, LocalFilesPath, config.URL_SECRET)
+		if err != nil {
+			return err
+		}
+
+		store = local
+	case "s3":
+		s3, err := NewS3Store(config)
+		if err != nil {
+			return err
+		}
+
+		store = s3
+	default:
+		return fmt.Errorf("unknown storage backend %q", config.BACKEND)
+	}
+
+	return nil
+}
+
+// Returns the configured store
+func Store() BlobStore {
+	return store
+}
+
+// Sets the store, e.g. to point it at a test directory
+func SetStore(s BlobStore) {
+	store = s
+}
+
+// Returns the key of the content with the hex encoded SHA-256 hash, identical uploads share it
+func HashKey(sum string) string {
+	return "sha256/" + sum[:2] + "/" + sum
+}
@@ -5,3 +5,9 @@ type JsonResponse struct {
 	Message string `json:"message"`
 	Data interface{} `json:"data,omitresponse"`
 }
+
+// A page of a cursor paginated listing
+type Page struct {
+	Data       interface{} `json:"data"`
+	NextCursor *string     `json:"next_cursor"`
+}